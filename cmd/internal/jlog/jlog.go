@@ -1,10 +1,14 @@
 package jlog
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,76 +18,345 @@ import (
 )
 
 type Output struct {
-	NoElideDuplicates  bool     `long:"no-elide" description:"Disable eliding repeated fields.  By default, fields that have the same value as the line above them have their values replaced with '↑'." env:"JLOG_NO_ELIDE_DUPLICATES"`
-	RelativeTimestamps bool     `short:"r" long:"relative" description:"Print timestamps as a duration since the program started instead of absolute timestamps." env:"JLOG_RELATIVE_TIMESTAMPS"`
-	TimeFormat         string   `short:"t" long:"time-format" description:"A go time.Format string describing how to format timestamps, or one of 'rfc3339(milli|micro|nano)', 'unix', 'stamp(milli|micro|nano)', or 'kitchen'." default:"stamp" env:"JLOG_TIME_FORMAT"`
-	OnlySubseconds     bool     `short:"s" long:"only-subseconds" description:"Display only the fractional part of times that are in the same second as the last log line.  Only works with the (milli|micro|nano) formats above.  (This can be revisited, but it's complicated.)" env:"JLOG_ONLY_SUBSECONDS"`
-	NoSummary          bool     `long:"no-summary" description:"Suppress printing the summary at the end." env:"JLOG_NO_SUMMARY"`
-	PriorityFields     []string `long:"priority" short:"p" description:"A list of fields to show first; repeatable." env:"JLOG_PRIORITY_FIELDS" env-delim:","`
-	HighlightFields    []string `long:"highlight" short:"H" description:"A list of fields to visually distinguish; repeatable." env:"JLOG_HIGHLIGHT_FIELDS" env-delim:"," default:"err" default:"error" default:"warn" default:"warning"` //nolint
-
-	AfterContext  int `long:"after-context" short:"A" default:"0" description:"Print this many filtered lines after a non-filtered line (like grep)."`
-	BeforeContext int `long:"before-context" short:"B" default:"0" description:"Print this many filtered lines before a non-filtered line (like grep)."`
-	Context       int `long:"context" short:"C" default:"0" description:"Print this many context lines around each match (like grep)."`
+	NoElideDuplicates    bool     `long:"no-elide" description:"Disable eliding repeated fields.  By default, fields that have the same value as the line above them have their values replaced with '↑'." env:"JLOG_NO_ELIDE_DUPLICATES"`
+	NoElideFields        []string `long:"no-elide-field" description:"Always show this field's value in full, even when it's the same as the line above; repeatable.  Good for IDs." env:"JLOG_NO_ELIDE_FIELDS" env-delim:","`
+	ReassertEvery        int      `long:"reassert-every" description:"When eliding repeated fields, show each field's value in full at least once every this many lines, so that it's never far to scroll up to see what '↑' means.  0 means no limit." env:"JLOG_REASSERT_EVERY"`
+	Dedupe               bool     `long:"dedupe" description:"Show a run of consecutive lines with the same level, message, and fields once, with a count like '(x20)'.  Times are ignored, and the first line's is shown.  Each line is shown once the next different line arrives." env:"JLOG_DEDUPE"`
+	Head                 int      `long:"head" description:"Stop reading after displaying this many lines, including any context lines.  With filters, this is the first N matching lines." env:"JLOG_HEAD"`
+	Tail                 int      `long:"tail" description:"Only display the last this many lines, including any context lines, once the input has been read.  Can't be used with --tui." env:"JLOG_TAIL"`
+	MaxErrorRepeats      int      `long:"max-error-repeats" description:"Stop with an error once the same error has been repeated this many times in a row, even with --lax, which doesn't print errors.  Repeated errors are printed once, with a count.  0 means never stop." env:"JLOG_MAX_ERROR_REPEATS"`
+	NoRawEcho            bool     `long:"no-raw-echo" description:"Don't copy lines that can't be parsed to the output as-is; only report them as errors on stderr.  Keeps the output free of malformed lines." env:"JLOG_NO_RAW_ECHO"`
+	RawOutput            bool     `long:"raw-output" description:"With --lax, copy lines that aren't JSON to the output exactly as they were read, instead of showing them as the message of an otherwise empty line.  They aren't filtered.  Good for logs with plain text banners mixed in." env:"JLOG_RAW_OUTPUT"`
+	RelativeTimestamps   bool     `short:"r" long:"relative" description:"Print timestamps as a duration since the program started instead of absolute timestamps." env:"JLOG_RELATIVE_TIMESTAMPS"`
+	RelativeToFirst      bool     `long:"relative-to-first" description:"Like -r, but print timestamps as a duration since the first log line, like +1.2s.  Good for reading old logs." env:"JLOG_RELATIVE_TO_FIRST"`
+	Timezone             string   `long:"timezone" description:"The time zone to show times in: 'local', 'utc', or a name like 'America/New_York'.  If unset, the local time zone (from $TZ) is used." env:"JLOG_TIMEZONE"`
+	TimeFormat           string   `short:"t" long:"time-format" description:"A go time.Format string describing how to format timestamps, or one of 'rfc3339(milli|micro|nano)', 'unix', 'stamp(milli|micro|nano)', or 'kitchen'." default:"stamp" env:"JLOG_TIME_FORMAT"`
+	UnknownTime          string   `long:"unknown-time" description:"What to show in place of the time on lines without one; an empty string leaves the column blank." default:"???" env:"JLOG_UNKNOWN_TIME"`
+	OnlySubseconds       bool     `short:"s" long:"only-subseconds" description:"Display only the fractional part of times that are in the same second as the last log line.  Only works with the (milli|micro|nano) formats above.  (This can be revisited, but it's complicated.)" env:"JLOG_ONLY_SUBSECONDS"`
+	NoSummary            bool     `long:"no-summary" description:"Suppress printing the summary at the end." env:"JLOG_NO_SUMMARY"`
+	SummaryFormat        string   `long:"summary-format" description:"How to print the summary, and any reports requested with --field-stats, --infer-schema, or --footer; 'text' is for people, and 'json' is a single JSON object for scripts." choice:"text" choice:"json" default:"text" env:"JLOG_SUMMARY_FORMAT"`
+	Footer               bool     `long:"footer" description:"After reading all input, print a report about the displayed lines: how many were at each level, the span of time they cover, the most common messages, and the number of errors." env:"JLOG_FOOTER"`
+	FieldStats           bool     `long:"field-stats" description:"After reading all input, print how many displayed lines each field appeared on, most frequent first.  Useful for picking -p fields for unfamiliar logs." env:"JLOG_FIELD_STATS"`
+	InferSchema          bool     `long:"infer-schema" description:"After reading all input, print each field's fill rate (the percentage of displayed lines it appeared on), the JSON types its values had, and an example value.  Useful for learning the shape of unfamiliar logs before writing jq programs." env:"JLOG_INFER_SCHEMA"`
+	PriorityFields       []string `long:"priority" short:"p" description:"A list of fields to show first; repeatable." env:"JLOG_PRIORITY_FIELDS" env-delim:","`
+	LineNumbers          bool     `short:"n" long:"line-numbers" description:"Prefix each line with its line number in the input, like 'grep -n'.  Separators between context regions show the first line they stand for.  Not supported by --output formats other than the default." env:"JLOG_LINE_NUMBERS"`
+	ShowOriginal         bool     `long:"show-original" description:"For lines whose fields were changed by the --jq program, show the original input on a dimmed line underneath." env:"JLOG_SHOW_ORIGINAL"`
+	FieldOrder           string   `long:"field-order" description:"The order to display fields in, after any priority fields; 'seen' keeps fields in the order they were first seen in, so they stay in the same place from line to line, and 'alpha' sorts the fields on every line by name." choice:"seen" choice:"alpha" default:"seen" env:"JLOG_FIELD_ORDER"`
+	FieldSort            string   `long:"field-sort" description:"How to sort fields that aren't placed by --priority or by the order they were first seen in: 'key' sorts them by name, 'value-length' puts short values first, and 'type' groups them by JSON type (null, bool, number, string, array, then object)." choice:"key" choice:"value-length" choice:"type" default:"key" env:"JLOG_FIELD_SORT"`
+	HighlightFields      []string `long:"highlight" short:"H" description:"A list of fields to visually distinguish; repeatable." env:"JLOG_HIGHLIGHT_FIELDS" env-delim:"," default:"err" default:"error" default:"warn" default:"warning"` //nolint
+	ShowSizes            []string `long:"show-sizes" description:"A list of fields to show the size of, as JSON, instead of their values, like 'payload[4.2KB]'; repeatable." env:"JLOG_SHOW_SIZES" env-delim:","`
+	LevelStyle           string   `long:"level-style" choice:"full" choice:"short" choice:"char" description:"How to label levels: 'full' (INFO), 'short' (INF), or 'char' (I), for denser output.  If unset, 'full' is used." env:"JLOG_LEVEL_STYLE"`
+	LevelNames           []string `long:"level-names" description:"Change the label shown for a level, as level=LABEL, like warn=WARNING; repeatable.  All labels are padded to the same width.  'unknown' sets the label for lines without a recognized level." env:"JLOG_LEVEL_NAMES" env-delim:","`
+	HighlightLevels      []string `long:"highlight-level" description:"A list of levels whose lines should be highlighted in their entirety, like 'error'; repeatable." env:"JLOG_HIGHLIGHT_LEVELS" env-delim:","`
+	ColorFields          []string `long:"color-field" description:"Color the value of a field according to a scheme, as field:scheme; repeatable.  The only scheme is 'http-status', which colors 2xx green, 3xx cyan, 4xx yellow, and 5xx red.  Pass an empty string to color no field values." env:"JLOG_COLOR_FIELDS" env-delim:"," default:"status:http-status"`
+	ColorBy              string   `long:"color-by" description:"Mark the start of each line with a bar colored by the value of this field, like trace_id, so that interleaved lines from the same request stand out.  Without color, a short hash of the value is shown instead." env:"JLOG_COLOR_BY"`
+	ArrayFormat          string   `long:"array-format" description:"How to show arrays in fields; 'json' shows them as JSON, and 'csv' shows arrays of strings, numbers, and booleans as their elements joined by --array-delimiter." choice:"json" choice:"csv" default:"json" env:"JLOG_ARRAY_FORMAT"`
+	ArrayDelimiter       string   `long:"array-delimiter" description:"With --array-format csv, the string to put between array elements." default:"," env:"JLOG_ARRAY_DELIMITER"`
+	MessageWidth         int      `long:"message-width" description:"If non-zero, truncate messages longer than this many characters." env:"JLOG_MESSAGE_WIDTH"`
+	ExpandFields         []string `long:"expand-field" description:"Show this field's value underneath the line as indented JSON, instead of compactly after the message; repeatable.  Good for large nested objects, like requests." env:"JLOG_EXPAND_FIELDS" env-delim:","`
+	StacktraceFields     []string `long:"stacktrace-field" description:"Show this field underneath the line with one stack frame per line, if it's a string with more than one line or an array of strings; repeatable.  Other values are shown inline.  Pass an empty string to show stack traces inline." default:"stacktrace" default:"stack" env:"JLOG_STACKTRACE_FIELDS" env-delim:","`
+	QuoteStrings         bool     `long:"quote-strings" description:"Display string values of fields in double quotes, so that the string \"42\" can be told apart from the number 42." env:"JLOG_QUOTE_STRINGS"`
+	MultilineMessages    bool     `long:"multiline-messages" description:"Display messages that contain newlines, like stack traces, across multiple lines, indented to line up with the start of the message, instead of replacing the newlines with '↩'." env:"JLOG_MULTILINE_MESSAGES"`
+	Wrap                 bool     `long:"wrap" description:"Instead of truncating messages longer than --message-width, wrap them onto indented continuation lines." env:"JLOG_WRAP"`
+	SqueezeWhitespace    bool     `long:"squeeze-whitespace" description:"Display runs of spaces and tabs in messages as a single space, and remove leading and trailing whitespace." env:"JLOG_SQUEEZE_WHITESPACE"`
+	KeepEdgeWhitespace   bool     `long:"keep-edge-whitespace" description:"With --squeeze-whitespace, display leading and trailing whitespace in messages as-is." env:"JLOG_KEEP_EDGE_WHITESPACE"`
+	OutputFile           string   `short:"o" long:"output-file" description:"Write the output to this file, replacing it if it exists, instead of to stdout.  Color is off unless forced with --color=always.  The summary and errors still go to stderr." env:"JLOG_OUTPUT_FILE"`
+	Pager                bool     `long:"pager" description:"When stdout is a terminal, send the output through $PAGER, or 'less -R' if that's unset." env:"JLOG_PAGER"`
+	NoPager              bool     `long:"no-pager" description:"Write the output directly to stdout, even if --pager is set, like in $JLOG_PAGER." env:"JLOG_NO_PAGER"`
+	OutputFormat         string   `long:"output" description:"How to format the output; 'default' is the usual human-readable format, 'markdown' is a GitHub-flavored Markdown table, and 'json-visible' is one JSON object per line containing only what would be displayed." choice:"default" choice:"markdown" choice:"json-visible" default:"default" env:"JLOG_OUTPUT"`
+	Columns              []string `long:"columns" description:"For table output, the columns to show, separated by commas; repeatable.  'time', 'level', and 'msg' are the parsed time, level, and message; anything else names a field.  (default: time,level,msg)  With the default output, the named fields are shown as aligned columns between the time and the message." env:"JLOG_COLUMNS" env-delim:","`
+	ColumnWidths         []string `long:"column-width" description:"Fix the width of a column from --columns, as field=width, like path=20; repeatable.  Longer values are truncated.  Otherwise, a column grows to fit the widest value seen so far." env:"JLOG_COLUMN_WIDTHS" env-delim:","`
+	JSONKeyOrder         string   `long:"json-key-order" description:"For JSON output, the order of fields after time, level, message, and any priority fields; 'sorted' sorts them by name, and 'seen' uses the order they were first seen in, like the default output." choice:"sorted" choice:"seen" default:"sorted" env:"JLOG_JSON_KEY_ORDER"`
+	JSONNumbersAsStrings bool     `long:"json-numbers-as-strings" description:"For JSON output, output numbers in fields as strings, for consumers that can't handle large numbers.  Filters still see numbers." env:"JLOG_JSON_NUMBERS_AS_STRINGS"`
+	CountBy              []string `long:"count-by" description:"Instead of displaying lines, count how many lines have each value of this field, and print the counts (most common first) once the input has been read.  Lines without the field are counted as '(none)'.  If repeated or comma-separated, lines are counted by the combination of the fields' values." env:"JLOG_COUNT_BY" env-delim:","`
+	Histogram            string   `long:"histogram" description:"Instead of displaying lines, count how many lines have a time in each interval of this length, like 1m, and print a bar chart of the counts once the input has been read.  Lines without a time are counted separately." env:"JLOG_HISTOGRAM"`
+	GroupBy              string   `long:"group-by" description:"Hold displayed lines back until the input has been read, then print the lines with each value of this field together, like all the lines of a request, under a header.  Groups are printed in the order they first appeared in.  The input is kept in memory, not limited by --buffer-limit; see --group-window." env:"JLOG_GROUP_BY"`
+	GroupWindow          int      `long:"group-window" description:"With --group-by, print the groups once this many lines have been held back, and start grouping again, to limit memory use on large or endless inputs.  A group may then be printed more than once." env:"JLOG_GROUP_WINDOW"`
+	JSONColor            bool     `long:"json-color" description:"For JSON output, color the level with ANSI escape sequences inside the JSON string, for viewers that display them.  Follows the same rules as the default output for deciding whether to use color." env:"JLOG_JSON_COLOR"`
+
+	AfterContext          int  `long:"after-context" short:"A" default:"0" description:"Print this many filtered lines after a non-filtered line (like grep)."`
+	BeforeContext         int  `long:"before-context" short:"B" default:"0" description:"Print this many filtered lines before a non-filtered line (like grep)."`
+	Context               int  `long:"context" short:"C" default:"0" description:"Print this many context lines around each match (like grep)."`
+	ContextSeparatorStats bool `long:"context-separator-stats" description:"Say how many lines were skipped between context regions, like '--- 1,240 lines ---', instead of just '---'." env:"JLOG_CONTEXT_SEPARATOR_STATS"`
 }
 
 type General struct {
-	MatchRegex   string             `short:"g" long:"regex" description:"A regular expression that removes lines from the output that don't match, like grep."`
-	NoMatchRegex string             `short:"G" long:"no-regex" description:"A regular expression that removes lines from the output that DO match, like 'grep -v'."`
-	RegexpScope  *parse.RegexpScope `short:"S" long:"regex-scope" description:"Where to apply the provided regex; (m)essage, (k)eys, or (v)alues. 'kmv' looks in all scopes, 'k' only searches keys, etc." default:"kmv"`
-	JQ           string             `short:"e" long:"jq" description:"A jq program to run on each record in the processed input; use this to ignore certain lines, add fields, etc.  Hint: 'select(condition)' will remove lines that don't match 'condition'."`
-	JQSearchPath []string           `long:"jq-search-path" env:"JLOG_JQ_SEARCH_PATH" description:"A list of directories in which to search for JQ modules.  A path entry named (not merely ending in) .jq is automatically loaded.  When set through the environment, use ':' as the delimiter (like $PATH)." default:"~/.jq" default:"~/.jlog/jq/.jq" default:"~/.jlog/jq" env-delim:":"` //nolint
-	NoColor      bool               `short:"M" long:"no-color" description:"Disable the use of color." env:"JLOG_FORCE_MONOCHROME"`
-	NoMonochrome bool               `short:"c" long:"no-monochrome" description:"Force the use of color." env:"JLOG_FORCE_COLOR"`
-	Profile      string             `long:"profile" description:"If set, collect a CPU profile and write it to this file."`
+	MatchRegex       string             `short:"g" long:"regex" description:"A regular expression that removes lines from the output that don't match, like grep."`
+	NoMatchRegex     string             `short:"G" long:"no-regex" description:"A regular expression that removes lines from the output that DO match, like 'grep -v'."`
+	HighlightMatch   bool               `long:"highlight-match" description:"With --regex, highlight matching lines instead of removing lines that don't match."`
+	MinLevel         string             `long:"min-level" description:"Remove lines with a level less severe than this one, like 'warn'.  Lines without a recognized level are kept." env:"JLOG_MIN_LEVEL"`
+	Sample           string             `long:"sample" description:"Only show 1 of every N lines, as 1/N, like 1/100; the first line, the N+1th, and so on.  Applies to the lines that pass the other filters." env:"JLOG_SAMPLE"`
+	DropUnknownLevel bool               `long:"drop-unknown-level" description:"Remove lines without a recognized level." env:"JLOG_DROP_UNKNOWN_LEVEL"`
+	LevelRanks       []string           `long:"level-rank" description:"Change how severe a level is considered to be when comparing levels, as level=rank; repeatable.  The default ranks are trace=1, debug=2, info=3, warn=4, error=5, panic=6, dpanic=7, and fatal=8.  Affects --min-level and comparisons like '$LVL<$WARN' in --jq." env:"JLOG_LEVEL_RANKS" env-delim:","`
+	RegexpScope      *parse.RegexpScope `short:"S" long:"regex-scope" description:"Where to apply the provided regex; (m)essage, (k)eys, or (v)alues. 'kmv' looks in all scopes, 'k' only searches keys, etc." default:"kmv"`
+	JQ               string             `short:"e" long:"jq" description:"A jq program to run on each record in the processed input; use this to ignore certain lines, add fields, etc.  Hint: 'select(condition)' will remove lines that don't match 'condition'."`
+	JQSearchPath     []string           `long:"jq-search-path" env:"JLOG_JQ_SEARCH_PATH" description:"A list of directories in which to search for JQ modules.  A path entry named (not merely ending in) .jq is automatically loaded.  When set through the environment, use ':' as the delimiter (like $PATH)." default:"~/.jq" default:"~/.jlog/jq/.jq" default:"~/.jlog/jq" env-delim:":"` //nolint
+	JQErrorMode      string             `long:"jq-error-mode" choice:"abort" choice:"skip" choice:"raw" description:"What to do when the --jq program fails on a line: 'abort' stops reading, 'skip' shows the line as if there were no program, and 'raw' prints the line as it was read.  Errors are counted either way.  If unset, 'abort' is used." env:"JLOG_JQ_ERROR_MODE"`
+	Color            string             `long:"color" choice:"always" choice:"never" choice:"auto" description:"Whether to use color; 'auto' uses color when writing to a terminal.  If unset, NO_COLOR disables color and CLICOLOR_FORCE forces it, and otherwise 'auto' is used." env:"JLOG_COLOR"`
+	NoColor          bool               `short:"M" long:"no-color" description:"Deprecated; the same as --color=never." env:"JLOG_FORCE_MONOCHROME"`
+	NoMonochrome     bool               `short:"c" long:"no-monochrome" description:"Deprecated; the same as --color=always." env:"JLOG_FORCE_COLOR"`
+	NoColorFields    bool               `long:"no-color-fields" description:"Don't color field names, but keep coloring the level, time, and message.  Fields selected with --highlight are still highlighted." env:"JLOG_NO_COLOR_FIELDS"`
+	Profile          string             `long:"profile" description:"If set, collect a CPU profile and write it to this file."`
+	Debug            bool               `long:"debug" description:"Print extra information for debugging jlog itself, like the full stack trace when processing a line panics." env:"JLOG_DEBUG"`
+	TUI              bool               `long:"tui" description:"Browse the logs in an interactive full-screen viewer, where the regex and jq filters can be edited while watching the results.  Requires a terminal."`
+	BufferLimit      int                `long:"buffer-limit" description:"For --tui, the number of bytes of input to keep in memory; anything more is kept in a temporary file.  0 means no limit.  --group-by always keeps its lines in memory, so it needs --group-window when this is set." env:"JLOG_BUFFER_LIMIT"`
 
 	Version bool `short:"v" long:"version" description:"Print version information and exit."`
 }
 
 type Input struct {
-	Lax            bool     `short:"l" long:"lax" description:"If true, suppress any validation errors including non-JSON log lines and missing timestamps, levels, and message.  We extract as many of those as we can, but if something is missing, the errors will be silently discarded." env:"JLOG_LAX"`
-	LevelKey       string   `long:"levelkey" description:"JSON key that holds the log level." env:"JLOG_LEVEL_KEY"`
-	NoLevelKey     bool     `long:"nolevelkey" description:"If set, don't look for a log level, and don't display levels." env:"JLOG_NO_LEVEL_KEY"`
-	TimestampKey   string   `long:"timekey" description:"JSON key that holds the log timestamp." env:"JLOG_TIMESTAMP_KEY"`
-	NoTimestampKey bool     `long:"notimekey" description:"If set, don't look for a time, and don't display times." env:"JLOG_NO_TIMESTAMP_KEY"`
-	MessageKey     string   `long:"messagekey" description:"JSON key that holds the log message." env:"JLOG_MESSAGE_KEY"`
-	NoMessageKey   bool     `long:"nomessagekey" description:"If set, don't look for a message, and don't display messages (time/level + fields only)." env:"JLOG_NO_MESSAGE_KEY"`
-	DeleteKeys     []string `long:"delete" description:"JSON keys to be deleted before JQ processing and output; repeatable." env:"JLOG_DELETE_KEYS" env-delim:","`
-	UpgradeKeys    []string `long:"upgrade" description:"JSON key (of type object) whose fields should be merged with any other fields; good for loggers that always put structed data in a separate key; repeatable.\n--upgrade b would transform as follows: {a:'a', b:{'c':'c'}} -> {a:'a', c:'c'}" env:"JLOG_UPGRADE_KEYS" env-delim:","`
+	Format                string   `long:"format" choice:"docker" choice:"journald" choice:"otlp" choice:"json-array" description:"Read logs in a well-known format that can't be guessed: 'docker' reads the output of Docker's json-file log driver, like /var/lib/docker/containers/*/*-json.log, 'journald' reads the output of 'journalctl -o json', 'otlp' reads OpenTelemetry logs in the OTLP/JSON encoding, like the collector's file exporter writes, and 'json-array' reads a single JSON array of log lines, like '[{...},{...}]', one element at a time.  Other flags, like --timekey, override the format's settings." env:"JLOG_FORMAT"`
+	Lax                   bool     `short:"l" long:"lax" description:"If true, suppress any validation errors including non-JSON log lines and missing timestamps, levels, and message.  We extract as many of those as we can, but if something is missing, the errors will be silently discarded." env:"JLOG_LAX"`
+	StrictAbort           bool     `long:"strict-abort" description:"Stop at the first line that isn't a JSON object, and exit with an error.  Useful for validating that input is entirely JSON." env:"JLOG_STRICT_ABORT"`
+	LevelKey              []string `long:"levelkey" description:"JSON key that holds the log level; repeatable.  If a line doesn't have the first key, the next one is tried, and so on." env:"JLOG_LEVEL_KEY" env-delim:","`
+	LevelFormat           string   `long:"level-format" choice:"string" choice:"bunyan" choice:"lager" choice:"syslog" choice:"zap-numeric" choice:"otlp" description:"How to interpret the value of the level key; requires --levelkey.  'string' understands names like 'info' or 'WARN', 'bunyan' and 'lager' understand those loggers' numeric levels, 'syslog' understands severities 0 through 7, 'zap-numeric' understands zapcore.Level numbers, and 'otlp' understands OpenTelemetry severity numbers 1 through 24.  If unset, 'string' is used." env:"JLOG_LEVEL_FORMAT"`
+	UnknownLevel          string   `long:"unknown-level" description:"The level to give lines whose level is missing or not recognized, like 'info'." env:"JLOG_UNKNOWN_LEVEL"`
+	LevelSubkey           string   `long:"level-subkey" description:"If the level key holds an object, like {\"name\":\"INFO\",\"value\":30}, the key inside that object that holds the log level." env:"JLOG_LEVEL_SUBKEY"`
+	NoLevelKey            bool     `long:"nolevelkey" description:"If set, don't look for a log level, and don't display levels." env:"JLOG_NO_LEVEL_KEY"`
+	LevelFromMessage      string   `long:"level-from-message" description:"For lines without a level key, a regex that finds the level in the message, like '^\\[(?P<level>\\w+)\\] '.  The named group 'level' holds the level." env:"JLOG_LEVEL_FROM_MESSAGE"`
+	StripLevelFromMessage bool     `long:"strip-level-from-message" description:"Remove the text matched by --level-from-message from the message." env:"JLOG_STRIP_LEVEL_FROM_MESSAGE"`
+	TimestampKey          []string `long:"timekey" description:"JSON key that holds the log timestamp; repeatable.  If a line doesn't have the first key, the next one is tried, and so on." env:"JLOG_TIMESTAMP_KEY" env-delim:","`
+	EpochUnit             string   `long:"epoch-unit" choice:"s" choice:"ms" choice:"us" choice:"ns" description:"The unit of numeric timestamps, as (s)econds, (m)illi(s)econds, (u)micro(s)econds, or (n)ano(s)econds since the Unix epoch; requires --timekey.  If unset, seconds are assumed." env:"JLOG_EPOCH_UNIT"`
+	InputTimeFormat       []string `long:"input-time-format" description:"A go time.Parse layout for string timestamps that aren't RFC3339, like '2006-01-02 15:04:05'; requires --timekey.  Repeatable; timestamps are tried as RFC3339 (or numbers), then with each layout in order." env:"JLOG_INPUT_TIME_FORMAT" env-delim:"|"`
+	InputTimezone         string   `long:"input-timezone" description:"The time zone of timestamps read with --input-time-format that don't say: 'local', 'utc', or a name like 'America/New_York'.  If unset, UTC is assumed." env:"JLOG_INPUT_TIMEZONE"`
+	LenientTime           bool     `long:"lenient-time" description:"Don't report lines without a time, or with a time that can't be parsed, as errors; show them without a time instead.  Unlike --lax, other problems are still reported." env:"JLOG_LENIENT_TIME"`
+	NoTimestampKey        bool     `long:"notimekey" description:"If set, don't look for a time, and don't display times." env:"JLOG_NO_TIMESTAMP_KEY"`
+	MessageKey            []string `long:"messagekey" description:"JSON key that holds the log message; repeatable.  If a line doesn't have the first key, the next one is tried, and so on." env:"JLOG_MESSAGE_KEY" env-delim:","`
+	NoMessageKey          bool     `long:"nomessagekey" description:"If set, don't look for a message, and don't display messages (time/level + fields only)." env:"JLOG_NO_MESSAGE_KEY"`
+	DeleteKeys            []string `long:"delete" description:"JSON keys to be deleted before JQ processing and output; repeatable.  Glob patterns like 'debug.*' delete every matching key.  Keys merged by --upgrade can be deleted too." env:"JLOG_DELETE_KEYS" env-delim:","`
+	RenameKeys            []string `long:"rename" description:"Display a key under a different name, as old=new, like http.request.method=method; repeatable.  Applied after --upgrade and --delete, and before jq.  If several keys are renamed to the same name, the one that sorts last wins." env:"JLOG_RENAME_KEYS" env-delim:","`
+	UpgradeKeys           []string `long:"upgrade" description:"JSON key (of type object) whose fields should be merged with any other fields; good for loggers that always put structed data in a separate key; repeatable.\n--upgrade b would transform as follows: {a:'a', b:{'c':'c'}} -> {a:'a', c:'c'}\nA dotted path like 'data.request' upgrades a key inside another object." env:"JLOG_UPGRADE_KEYS" env-delim:","`
+	ParseMessageJSON      bool     `long:"parse-message-json" description:"If a message ends with a JSON object, like 'request completed {\"status\":200}', remove the object from the message and show its keys as fields, as if they had been merged with --upgrade." env:"JLOG_PARSE_MESSAGE_JSON"`
+	ParseJSONFields       []string `long:"parse-json-field" description:"JSON key whose value is a JSON object or array encoded as a string, like '{\"a\":1}'; the string is replaced with what it encodes, so it's displayed as structured data and reachable from jq.  Applied before --upgrade.  Strings that aren't valid JSON are left alone.  Repeatable." env:"JLOG_PARSE_JSON_FIELDS" env-delim:","`
+	LowercaseKeys         bool     `long:"lowercase-keys" description:"Display keys in lower case, after --rename; nice with --format journald.  Keys whose lower case version is already taken are left alone." env:"JLOG_LOWERCASE_KEYS"`
+	KeepKeys              []string `long:"keep-keys" description:"Keys to keep displaying as fields after their value is used as the time, level, or message; repeatable.  For example, --keep-keys level shows the original level alongside the formatted one." env:"JLOG_KEEP_KEYS" env-delim:","`
+	StripANSI             bool     `long:"strip-ansi" description:"Remove ANSI escape sequences, like color codes, from messages and fields.  Some programs log text meant for a terminal, and the codes would otherwise show up as garbage." env:"JLOG_STRIP_ANSI"`
+	Root                  string   `long:"root" description:"Treat the input as a single JSON document, and show each element of the array at this path as a log line; '.items' handles 'kubectl get -o json', and '.' handles a top-level array." env:"JLOG_ROOT"`
+	MultiSchema           bool     `long:"multi-schema" description:"Guess the log format of each line separately, for input that mixes formats, like 'kubectl logs -l' across services.  Lines that can't be recognized on their own use the best-fitting format seen so far.  Normally the format guessed from the first recognizable line is used for the rest of the input.  Has no effect with --levelkey, --timekey, or --messagekey." env:"JLOG_MULTI_SCHEMA"`
+	OnLongLine            string   `long:"on-long-line" choice:"skip" choice:"truncate" choice:"error" default:"skip" description:"What to do with lines longer than 1MiB; 'skip' them, show the start of them unparsed ('truncate'), or stop with an 'error'.  All count as errors." env:"JLOG_ON_LONG_LINE"`
+	Source                string   `long:"source" description:"Read logs from this URL instead of stdin: an http:// or https:// URL, like a chunked response or a stream of server-sent events, a unix:///path URL of a Unix domain socket, or a file:///path URL of a named pipe.  Dropped connections and server errors are retried." env:"JLOG_SOURCE"`
+	SourceRetries         int      `long:"source-retries" description:"With --source, the number of times in a row to try connecting before giving up.  0 means forever." default:"10" env:"JLOG_SOURCE_RETRIES"`
+	SourceReconnect       bool     `long:"source-reconnect" description:"With --source, reconnect when the other end ends the stream normally, instead of treating that as the end of the logs.  Good for agents that restart, or named pipes with more than one writer over time." env:"JLOG_SOURCE_RECONNECT"`
+	InputFDs              []int    `long:"input-fd" description:"Also read logs from this inherited file descriptor, like 3 for '3< file' or a process substitution; repeatable.  Lines from all inputs, including stdin unless it's a terminal, are merged in time order, and labeled with an 'input' field like 'fd3'.  Each input should already be in time order."`
+	Jobs                  int      `long:"jobs" description:"Parse and filter lines on this many CPUs at once, for large inputs.  Output stays in input order.  Only takes effect along with --no-elide, and not with context (-A, -B, -C)." env:"JLOG_JOBS"`
 }
 
 func NewInputSchema(in Input) (*parse.InputSchema, error) { //nolint
+	var trimMessage bool
+	var presetTimeFormat parse.TimeParser
+	switch in.Format {
+	case "":
+	case "docker":
+		// {"log":"message\n","stream":"stdout","time":"2023-01-01T00:00:00.123456789Z"}
+		if len(in.TimestampKey) == 0 && !in.NoTimestampKey {
+			in.TimestampKey = []string{"time"}
+		}
+		if len(in.MessageKey) == 0 && !in.NoMessageKey {
+			in.MessageKey = []string{"log"}
+		}
+		if len(in.LevelKey) == 0 && in.LevelFromMessage == "" {
+			in.NoLevelKey = true
+		}
+		trimMessage = true
+	case "journald":
+		// {"__REALTIME_TIMESTAMP":"1700000000123456","PRIORITY":"6","MESSAGE":"message","_PID":"1",...}
+		if len(in.TimestampKey) == 0 && !in.NoTimestampKey {
+			in.TimestampKey = []string{"__REALTIME_TIMESTAMP"}
+			if in.EpochUnit == "" && len(in.InputTimeFormat) == 0 {
+				presetTimeFormat = parse.JournaldTimeParser
+			}
+		}
+		if len(in.MessageKey) == 0 && !in.NoMessageKey {
+			in.MessageKey = []string{"MESSAGE"}
+		}
+		if len(in.LevelKey) == 0 && in.LevelFromMessage == "" && !in.NoLevelKey {
+			in.LevelKey = []string{"PRIORITY"}
+			if in.LevelFormat == "" {
+				in.LevelFormat = "syslog"
+			}
+		}
+		// Fields starting with two underscores, like __CURSOR, are the journal's own
+		// bookkeeping.
+		in.DeleteKeys = append([]string{"__*"}, in.DeleteKeys...)
+	case "otlp":
+		// Each log record is flattened by NewInputReader.
+		if len(in.TimestampKey) == 0 && !in.NoTimestampKey {
+			in.TimestampKey = []string{parse.OTLPTimeKey, parse.OTLPObservedTimeKey}
+			if in.EpochUnit == "" && len(in.InputTimeFormat) == 0 {
+				presetTimeFormat = parse.OTLPTimeParser
+			}
+		}
+		if len(in.MessageKey) == 0 && !in.NoMessageKey {
+			in.MessageKey = []string{parse.OTLPBodyKey}
+		}
+		if len(in.LevelKey) == 0 && in.LevelFromMessage == "" && !in.NoLevelKey {
+			// The severity text is only there when the number isn't.
+			in.LevelKey = []string{parse.OTLPSeverityKey, parse.OTLPSeverityTextKey}
+			if in.LevelFormat == "" {
+				in.LevelFormat = "otlp"
+			}
+		}
+		if in.Root != "" {
+			return nil, errors.New("--root cannot be combined with --format otlp")
+		}
+	case "json-array":
+		// The array is flattened by NewInputReader; its elements are ordinary log lines.
+		if in.Root != "" {
+			return nil, errors.New("--root cannot be combined with --format json-array")
+		}
+	default:
+		return nil, fmt.Errorf("unknown --format %q", in.Format)
+	}
 	ins := &parse.InputSchema{
-		Strict: !in.Lax,
+		TrimMessage:        trimMessage,
+		LowercaseKeys:      in.LowercaseKeys,
+		ParseMessageJSON:   in.ParseMessageJSON,
+		ParseJSONFields:    in.ParseJSONFields,
+		StripANSI:          in.StripANSI,
+		LenientTime:        in.LenientTime,
+		Strict:             !in.Lax,
+		AbortOnInvalidJSON: in.StrictAbort,
+		MultiSchema:        in.MultiSchema,
+		Jobs:               in.Jobs,
+	}
+	switch in.OnLongLine {
+	case "truncate":
+		ins.LongLines = parse.LongLineTruncate
+	case "error":
+		ins.LongLines = parse.LongLineError
 	}
 	if in.NoLevelKey {
 		ins.LevelKey = ""
 		ins.LevelFormat = parse.NoopLevelParser
 		ins.NoLevelKey = true
-	} else if k := in.LevelKey; k != "" {
-		ins.LevelKey = k
-		ins.LevelFormat = parse.DefaultLevelParser
+	} else if k := in.LevelKey; len(k) > 0 {
+		ins.LevelKey, ins.AltLevelKeys = k[0], k[1:]
+		switch in.LevelFormat {
+		case "", "string":
+			ins.LevelFormat = parse.DefaultLevelParser
+		case "bunyan":
+			ins.LevelFormat = parse.BunyanV0LevelParser
+		case "lager":
+			ins.LevelFormat = parse.LagerLevelParser
+		case "syslog":
+			ins.LevelFormat = parse.SyslogLevelParser
+		case "zap-numeric":
+			ins.LevelFormat = parse.ZapNumericLevelParser
+		case "otlp":
+			ins.LevelFormat = parse.OTLPSeverityLevelParser
+		default:
+			return nil, fmt.Errorf("unknown --level-format %q", in.LevelFormat)
+		}
+	} else if in.LevelFormat != "" {
+		return nil, errors.New("--level-format requires --levelkey")
+	}
+	ins.LevelSubkey = in.LevelSubkey
+	if in.UnknownLevel != "" {
+		lvl, err := parse.DefaultLevelParser(strings.ToLower(in.UnknownLevel))
+		if err != nil || lvl == parse.LevelUnknown {
+			return nil, fmt.Errorf("--unknown-level: unknown level %q", in.UnknownLevel)
+		}
+		ins.UnknownLevel = lvl
+	}
+	if in.LevelFromMessage != "" {
+		rx, err := regexp.Compile(in.LevelFromMessage)
+		if err != nil {
+			return nil, fmt.Errorf("compile --level-from-message: %w", err)
+		}
+		if rx.SubexpIndex("level") < 0 {
+			return nil, errors.New("--level-from-message needs a capture group named 'level', like (?P<level>\\w+)")
+		}
+		ins.LevelFromMessage = rx
+		ins.StripLevelFromMessage = in.StripLevelFromMessage
+	} else if in.StripLevelFromMessage {
+		return nil, errors.New("--strip-level-from-message requires --level-from-message")
 	}
 	if in.NoMessageKey {
 		ins.MessageKey = ""
 		ins.NoMessageKey = true
-	} else if k := in.MessageKey; k != "" {
-		ins.MessageKey = k
+	} else if k := in.MessageKey; len(k) > 0 {
+		ins.MessageKey, ins.AltMessageKeys = k[0], k[1:]
 	}
 	if in.NoTimestampKey {
 		ins.TimeKey = ""
 		ins.TimeFormat = parse.NoopTimeParser
 		ins.NoTimeKey = true
-	} else if k := in.TimestampKey; k != "" {
-		ins.TimeKey = k
+	} else if k := in.TimestampKey; len(k) > 0 {
+		ins.TimeKey, ins.AltTimeKeys = k[0], k[1:]
 		ins.TimeFormat = parse.DefaultTimeParser
+		if presetTimeFormat != nil {
+			ins.TimeFormat = presetTimeFormat
+		}
 	}
+	if in.EpochUnit != "" {
+		if len(in.TimestampKey) == 0 || in.NoTimestampKey {
+			return nil, errors.New("--epoch-unit requires --timekey")
+		}
+		units := map[string]time.Duration{"s": time.Second, "ms": time.Millisecond, "us": time.Microsecond, "ns": time.Nanosecond}
+		unit, ok := units[in.EpochUnit]
+		if !ok {
+			return nil, fmt.Errorf("unknown --epoch-unit %q", in.EpochUnit)
+		}
+		ins.TimeFormat = parse.EpochTimeParser(unit)
+	}
+	if len(in.InputTimeFormat) > 0 {
+		if len(in.TimestampKey) == 0 || in.NoTimestampKey {
+			return nil, errors.New("--input-time-format requires --timekey")
+		}
+		zone := time.UTC
+		if in.InputTimezone != "" {
+			var err error
+			zone, err = loadZone(in.InputTimezone)
+			if err != nil {
+				return nil, fmt.Errorf("--input-timezone: %w", err)
+			}
+		}
+		// Numbers are still handled according to --epoch-unit.
+		parsers := []parse.TimeParser{ins.TimeFormat}
+		for _, layout := range in.InputTimeFormat {
+			parsers = append(parsers, parse.LayoutTimeParser(layout, zone))
+		}
+		ins.TimeFormat = parse.MultiTimeParser(parsers...)
+	} else if in.InputTimezone != "" {
+		return nil, errors.New("--input-timezone requires --input-time-format")
+	}
+	ins.PreserveKeys = in.KeepKeys
 	if u := in.UpgradeKeys; len(u) > 0 {
 		ins.UpgradeKeys = append(ins.UpgradeKeys, u...)
 	}
+	for _, r := range in.RenameKeys {
+		parts := strings.SplitN(r, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("--rename: %q should be in the form old=new", r)
+		}
+		if ins.RenameKeys == nil {
+			ins.RenameKeys = make(map[string]string)
+		}
+		ins.RenameKeys[parts[0]] = parts[1]
+	}
+	for _, k := range in.DeleteKeys {
+		if _, err := path.Match(k, ""); err != nil {
+			return nil, fmt.Errorf("--delete: bad pattern %q: %w", k, err)
+		}
+		ins.DeleteKeys = append(ins.DeleteKeys, k)
+	}
 	return ins, nil
 }
 
+// NewInputReader wraps r in any transformations necessary to produce a stream of log lines.
+func NewInputReader(r io.Reader, in Input) io.Reader {
+	if in.Format == "otlp" {
+		return parse.FlattenOTLPLogs(r)
+	}
+	if in.Root != "" {
+		return parse.FlattenJSONArray(r, in.Root)
+	}
+	if in.Format == "json-array" {
+		return parse.FlattenJSONArray(r, ".")
+	}
+	return r
+}
+
 func NewOutputFormatter(out Output, gen General) (*parse.OutputSchema, error) { //nolint
 	// This has a terrible variable name so that =s align below.
 	var subsecondFormt string
@@ -122,40 +395,303 @@ func NewOutputFormatter(out Output, gen General) (*parse.OutputSchema, error) {
 	case "kitchen":
 		out.TimeFormat = time.Kitchen
 	}
-	if out.RelativeTimestamps {
+	if out.RelativeTimestamps || out.RelativeToFirst {
 		out.TimeFormat = ""
 	}
 	if !out.OnlySubseconds {
 		subsecondFormt = ""
 	}
+	zone, err := loadZone(out.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("--timezone: %w", err)
+	}
+	if out.Head < 0 {
+		return nil, errors.New("--head must not be negative")
+	}
+	if out.Tail < 0 {
+		return nil, errors.New("--tail must not be negative")
+	}
+	if out.Head > 0 && out.Tail > 0 {
+		return nil, errors.New("--head cannot be combined with --tail")
+	}
+	if out.Tail > 0 && gen.TUI {
+		return nil, errors.New("--tail cannot be combined with --tui")
+	}
+	if out.GroupWindow < 0 {
+		return nil, errors.New("--group-window must not be negative")
+	}
+	if out.GroupWindow > 0 && out.GroupBy == "" {
+		return nil, errors.New("--group-window requires --group-by")
+	}
+	if out.GroupBy != "" && (out.Head > 0 || gen.TUI) {
+		return nil, errors.New("--group-by cannot be combined with --head or --tui")
+	}
+	if out.GroupBy != "" && out.GroupWindow == 0 && gen.BufferLimit > 0 {
+		// Grouped lines are always kept in memory, so the only way to limit them is a window.
+		return nil, errors.New("--group-by ignores --buffer-limit; add --group-window to limit how many lines are held back")
+	}
+	if out.ReassertEvery < 0 {
+		return nil, errors.New("--reassert-every must not be negative")
+	}
+	if out.RawOutput && out.NoRawEcho {
+		return nil, errors.New("--raw-output cannot be combined with --no-raw-echo")
+	}
+	if out.Wrap && out.MessageWidth <= 0 {
+		return nil, errors.New("--wrap requires a positive --message-width")
+	}
 
-	var wantColor = isatty.IsTerminal(os.Stdout.Fd())
-	switch {
-	case gen.NoColor && gen.NoMonochrome:
-		fmt.Fprintf(os.Stderr, "--no-color and --no-monochrome; if you're not sure, just let me decide!\n")
-	case gen.NoColor:
-		wantColor = false
-	case gen.NoMonochrome:
+	if out.OutputFile != "" && gen.TUI {
+		return nil, errors.New("--output-file cannot be combined with --tui")
+	}
+
+	color := gen.Color
+	if color == "" {
+		switch {
+		case gen.NoColor && gen.NoMonochrome:
+			fmt.Fprintf(os.Stderr, "--no-color and --no-monochrome; if you're not sure, just let me decide! (--color=auto)\n")
+		case gen.NoColor:
+			color = "never"
+		case gen.NoMonochrome:
+			color = "always"
+		// The flags override the conventional environment variables; see https://no-color.org/
+		// and https://bixense.com/clicolors/.
+		case os.Getenv("NO_COLOR") != "":
+			color = "never"
+		case os.Getenv("CLICOLOR_FORCE") != "" && os.Getenv("CLICOLOR_FORCE") != "0":
+			color = "always"
+		}
+	}
+	var wantColor bool
+	switch color {
+	case "", "auto":
+		wantColor = out.OutputFile == "" && isatty.IsTerminal(os.Stdout.Fd())
+	case "always":
 		wantColor = true
+	case "never":
+	default:
+		return nil, fmt.Errorf("unknown --color %q", color)
 	}
 
 	defaultOutput := &parse.DefaultOutputFormatter{
 		Aurora:               aurora.NewAurora(wantColor),
 		ElideDuplicateFields: !out.NoElideDuplicates,
+		ReassertInterval:     out.ReassertEvery,
 		AbsoluteTimeFormat:   out.TimeFormat,
+		RelativeToFirstLine:  out.RelativeToFirst,
 		SubSecondsOnlyFormat: subsecondFormt,
-		Zone:                 time.Local,
+		Zone:                 zone,
 		HighlightFields:      make(map[string]struct{}),
+		MessageWidth:         out.MessageWidth,
+		WrapMessages:         out.Wrap,
+		MultilineMessages:    out.MultilineMessages,
+		QuoteStrings:         out.QuoteStrings,
+		ExpandFields:         out.ExpandFields,
+		SqueezeWhitespace:    out.SqueezeWhitespace,
+		KeepEdgeWhitespace:   out.KeepEdgeWhitespace,
+		NoColorFields:        gen.NoColorFields,
+		JoinArrays:           out.ArrayFormat == "csv",
+		ArrayDelimiter:       out.ArrayDelimiter,
+		UnknownTimeMarker:    out.UnknownTime,
+		ColorBy:              out.ColorBy,
+	}
+	if out.UnknownTime == "" {
+		// The formatter treats an empty marker as the default.
+		defaultOutput.UnknownTimeMarker = " "
 	}
 	for _, k := range out.HighlightFields {
 		defaultOutput.HighlightFields[k] = struct{}{}
 	}
+	for _, k := range out.NoElideFields {
+		if defaultOutput.NoElideFields == nil {
+			defaultOutput.NoElideFields = make(map[string]struct{})
+		}
+		defaultOutput.NoElideFields[k] = struct{}{}
+	}
+	for _, fields := range out.ShowSizes {
+		for _, k := range strings.Split(fields, ",") {
+			if defaultOutput.SizeFields == nil {
+				defaultOutput.SizeFields = make(map[string]struct{})
+			}
+			defaultOutput.SizeFields[k] = struct{}{}
+		}
+	}
+	for _, spec := range out.ColorFields {
+		if spec == "" {
+			continue
+		}
+		parts := strings.SplitN(spec, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("--color-field %q: want field:scheme", spec)
+		}
+		colorize, ok := parse.FieldColorizers[parts[1]]
+		if !ok {
+			return nil, fmt.Errorf("--color-field %q: unknown scheme %q", spec, parts[1])
+		}
+		if defaultOutput.ColorFields == nil {
+			defaultOutput.ColorFields = make(map[string]parse.FieldColorizer)
+		}
+		defaultOutput.ColorFields[parts[0]] = colorize
+	}
+	for _, k := range out.StacktraceFields {
+		if k != "" {
+			defaultOutput.StacktraceFields = append(defaultOutput.StacktraceFields, k)
+		}
+	}
+	switch out.LevelStyle {
+	case "", "full":
+	case "short":
+		defaultOutput.LevelStyle = parse.LevelStyleShort
+	case "char":
+		defaultOutput.LevelStyle = parse.LevelStyleChar
+	default:
+		return nil, fmt.Errorf("unknown --level-style %q", out.LevelStyle)
+	}
+	for _, ln := range out.LevelNames {
+		parts := strings.SplitN(ln, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("--level-names: %q should be in the form level=LABEL", ln)
+		}
+		lvl, err := parse.DefaultLevelParser(strings.ToLower(parts[0]))
+		if err != nil || (lvl == parse.LevelUnknown && strings.ToLower(parts[0]) != "unknown") {
+			return nil, fmt.Errorf("--level-names: unknown level %q", parts[0])
+		}
+		if defaultOutput.LevelNames == nil {
+			defaultOutput.LevelNames = make(map[parse.Level]string)
+		}
+		defaultOutput.LevelNames[lvl] = parts[1]
+	}
+	for _, name := range out.HighlightLevels {
+		lvl, err := parse.DefaultLevelParser(strings.ToLower(name))
+		if err != nil || lvl == parse.LevelUnknown {
+			return nil, fmt.Errorf("--highlight-level: unknown level %q", name)
+		}
+		if defaultOutput.HighlightLevels == nil {
+			defaultOutput.HighlightLevels = make(map[parse.Level]bool)
+		}
+		defaultOutput.HighlightLevels[lvl] = true
+	}
+
+	var columns []string
+	for _, c := range out.Columns {
+		columns = append(columns, strings.Split(c, ",")...)
+	}
+	for _, c := range columns {
+		switch c {
+		case "time", "level", "msg":
+			// The default output always shows these first.
+		default:
+			defaultOutput.Columns = append(defaultOutput.Columns, c)
+		}
+	}
+	for _, cw := range out.ColumnWidths {
+		parts := strings.SplitN(cw, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("--column-width: %q should be in the form field=width", cw)
+		}
+		width, err := strconv.Atoi(parts[1])
+		if err != nil || width < 1 {
+			return nil, fmt.Errorf("--column-width: width for %q should be a positive number, not %q", parts[0], parts[1])
+		}
+		if defaultOutput.ColumnWidths == nil {
+			defaultOutput.ColumnWidths = make(map[string]int)
+		}
+		defaultOutput.ColumnWidths[parts[0]] = width
+	}
+
+	var formatter parse.OutputFormatter = defaultOutput
+	switch out.OutputFormat {
+	case "", "default":
+	case "markdown":
+		formatter = &parse.MarkdownFormatter{
+			Columns:            columns,
+			AbsoluteTimeFormat: out.TimeFormat,
+			Zone:               zone,
+		}
+	case "json-visible":
+		jsonOutput := &parse.JSONFormatter{
+			Zone:      zone,
+			SeenOrder: out.JSONKeyOrder == "seen",
+
+			NumbersAsStrings: out.JSONNumbersAsStrings,
+		}
+		if out.JSONColor {
+			jsonOutput.Aurora = aurora.NewAurora(wantColor)
+		}
+		formatter = jsonOutput
+	default:
+		return nil, fmt.Errorf("unknown output format %q", out.OutputFormat)
+	}
+	if len(out.CountBy) > 0 {
+		if formatter != defaultOutput {
+			return nil, errors.New("--count-by cannot be combined with --output")
+		}
+		var fields []string
+		for _, f := range out.CountBy {
+			for _, field := range strings.Split(f, ",") {
+				if field == "" {
+					return nil, fmt.Errorf("--count-by: empty field name in %q", f)
+				}
+				fields = append(fields, field)
+			}
+		}
+		formatter = &parse.CountFormatter{Fields: fields}
+	}
+	if out.Histogram != "" {
+		interval, err := time.ParseDuration(out.Histogram)
+		if err != nil {
+			return nil, fmt.Errorf("--histogram: %w", err)
+		}
+		if interval <= 0 {
+			return nil, errors.New("--histogram must be positive")
+		}
+		if formatter != defaultOutput {
+			return nil, errors.New("--histogram cannot be combined with --output or --count-by")
+		}
+		formatter = &parse.HistogramFormatter{
+			Interval:   interval,
+			Zone:       zone,
+			TimeFormat: out.TimeFormat,
+		}
+	}
+	if out.Dedupe && formatter != defaultOutput {
+		return nil, errors.New("--dedupe only works with the default output, not --output, --count-by, or --histogram")
+	}
+	if out.GroupBy != "" && formatter != defaultOutput {
+		return nil, errors.New("--group-by only works with the default output, not --output, --count-by, or --histogram")
+	}
+
+	var fieldSort parse.FieldSort
+	switch out.FieldSort {
+	case "", "key":
+	case "value-length":
+		fieldSort = parse.FieldSortValueLength
+	case "type":
+		fieldSort = parse.FieldSortType
+	default:
+		return nil, fmt.Errorf("unknown --field-sort %q", out.FieldSort)
+	}
 
 	outs := &parse.OutputSchema{
-		Formatter:      defaultOutput,
-		PriorityFields: out.PriorityFields,
-		AfterContext:   out.Context,
-		BeforeContext:  out.Context,
+		Formatter:             formatter,
+		PriorityFields:        out.PriorityFields,
+		AfterContext:          out.Context,
+		BeforeContext:         out.Context,
+		CountFields:           out.FieldStats,
+		InferSchema:           out.InferSchema,
+		SortFields:            out.FieldOrder == "alpha",
+		FieldSort:             fieldSort,
+		CollectStats:          out.Footer,
+		ShowOriginal:          out.ShowOriginal,
+		LineNumbers:           out.LineNumbers,
+		NoRawEcho:             out.NoRawEcho,
+		PassthroughNonJSON:    out.RawOutput,
+		MaxErrorRepeats:       out.MaxErrorRepeats,
+		Head:                  out.Head,
+		Tail:                  out.Tail,
+		ContextSeparatorStats: out.ContextSeparatorStats,
+		Dedupe:                out.Dedupe,
+		GroupBy:               out.GroupBy,
+		GroupWindow:           out.GroupWindow,
 	}
 
 	// Let -A and -B override -C.
@@ -169,6 +705,19 @@ func NewOutputFormatter(out Output, gen General) (*parse.OutputSchema, error) {
 	return outs, nil
 }
 
+// parseSample parses a sampling rate like "1/100".
+func parseSample(rate string) (int, error) {
+	parts := strings.SplitN(rate, "/", 2)
+	if len(parts) != 2 || parts[0] != "1" {
+		return 0, fmt.Errorf("%q should be in the form 1/N, like 1/100", rate)
+	}
+	n, err := strconv.Atoi(parts[1])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%q: N must be a positive integer", rate)
+	}
+	return n, nil
+}
+
 func NewFilterScheme(gen General) (*parse.FilterScheme, error) { //nolint
 	fsch := new(parse.FilterScheme)
 	if gen.MatchRegex != "" && gen.NoMatchRegex != "" {
@@ -186,12 +735,105 @@ func NewFilterScheme(gen General) (*parse.FilterScheme, error) { //nolint
 	if gen.RegexpScope != nil {
 		fsch.Scope = *gen.RegexpScope
 	}
+	switch gen.JQErrorMode {
+	case "", "abort":
+	case "skip":
+		fsch.JQErrorMode = parse.JQErrorSkip
+	case "raw":
+		fsch.JQErrorMode = parse.JQErrorRaw
+	default:
+		return nil, fmt.Errorf("unknown --jq-error-mode %q", gen.JQErrorMode)
+	}
+	if gen.HighlightMatch {
+		if gen.MatchRegex == "" {
+			return nil, errors.New("--highlight-match requires --regex")
+		}
+		fsch.HighlightMatches = true
+	}
+	for _, lr := range gen.LevelRanks {
+		parts := strings.SplitN(lr, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("--level-rank: %q should be in the form level=rank", lr)
+		}
+		lvl, err := parse.DefaultLevelParser(strings.ToLower(parts[0]))
+		if err != nil || lvl == parse.LevelUnknown {
+			return nil, fmt.Errorf("--level-rank: unknown level %q", parts[0])
+		}
+		rank, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("--level-rank: parse rank for %q: %w", parts[0], err)
+		}
+		if fsch.LevelRanks == nil {
+			fsch.LevelRanks = make(parse.LevelRanks)
+		}
+		fsch.LevelRanks[lvl] = rank
+	}
+	if gen.MinLevel != "" {
+		lvl, err := parse.DefaultLevelParser(strings.ToLower(gen.MinLevel))
+		if err != nil || lvl == parse.LevelUnknown {
+			return nil, fmt.Errorf("--min-level: unknown level %q", gen.MinLevel)
+		}
+		fsch.MinLevel = lvl
+	}
+	fsch.DropUnknownLevel = gen.DropUnknownLevel
+	if gen.Sample != "" {
+		n, err := parseSample(gen.Sample)
+		if err != nil {
+			return nil, fmt.Errorf("--sample: %w", err)
+		}
+		fsch.SampleEvery = n
+	}
 	return fsch, nil
 }
 
+// PrintPanicStack prints the stack trace of the panic that caused err, if there was one and --debug
+// is set.
+func PrintPanicStack(gen General, err error, w io.Writer) {
+	var pe *parse.PanicError
+	if gen.Debug && errors.As(err, &pe) {
+		fmt.Fprintf(w, "%s\n", pe.Stack)
+	}
+}
+
 func PrintOutputSummary(out Output, summary parse.Summary, w io.Writer) { //nolint
-	if out.NoSummary {
+	if out.SummaryFormat == "json" {
+		if out.NoSummary && !out.FieldStats && !out.InferSchema && !out.Footer {
+			return
+		}
+		j, err := json.Marshal(summary)
+		if err != nil {
+			fmt.Fprintf(w, "marshal summary: %v\n", err)
+			return
+		}
+		fmt.Fprintf(w, "%s\n", j)
 		return
 	}
-	fmt.Fprintf(w, "  "+summary.String()+"\n")
+	if !out.NoSummary {
+		fmt.Fprintf(w, "  "+summary.String()+"\n")
+	}
+	if out.FieldStats {
+		fmt.Fprintf(w, "  Fields seen:\n%s", summary.FieldStats("    "))
+	}
+	if out.InferSchema {
+		fmt.Fprintf(w, "  Schema:\n%s", summary.InferredSchema("    "))
+	}
+	if out.Footer {
+		zone, err := loadZone(out.Timezone)
+		if err != nil {
+			// NewOutputFormatter has already complained about this.
+			zone = time.Local
+		}
+		fmt.Fprint(w, summary.Footer("  ", zone))
+	}
+}
+
+// loadZone returns the time zone named by a flag like --timezone.
+func loadZone(name string) (*time.Location, error) {
+	switch strings.ToLower(name) {
+	case "", "local":
+		return time.Local, nil
+	case "utc":
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
 }
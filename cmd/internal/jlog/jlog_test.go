@@ -1,9 +1,15 @@
 package jlog
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/jessevdk/go-flags"
 	"github.com/jrockway/json-logs/pkg/parse"
 )
@@ -40,6 +46,314 @@ func TestFlagParsing(t *testing.T) {
 				"-l",
 			},
 		},
+		{
+			name:  "message width",
+			flags: []string{"--message-width", "80", "--wrap"},
+		},
+		{
+			name:  "level subkey",
+			flags: []string{"--levelkey", "level", "--level-subkey", "name"},
+		},
+		{
+			name:  "level format",
+			flags: []string{"--levelkey", "severity", "--level-format", "syslog"},
+		},
+		{
+			name:  "squeeze whitespace",
+			flags: []string{"--squeeze-whitespace", "--keep-edge-whitespace"},
+		},
+		{
+			name:  "highlight match",
+			flags: []string{"-g", "error", "--highlight-match"},
+		},
+		{
+			name:  "no color fields",
+			flags: []string{"-c", "--no-color-fields"},
+		},
+		{
+			name:  "color by",
+			flags: []string{"--color-by", "trace_id"},
+		},
+		{
+			name:  "highlight level",
+			flags: []string{"--highlight-level", "error", "--highlight-level", "WARN"},
+		},
+		{
+			name:  "color field",
+			flags: []string{"--color-field", "code:http-status"},
+		},
+		{
+			name:  "no color field",
+			flags: []string{"--color-field", ""},
+		},
+		{
+			name:  "root",
+			flags: []string{"--root", ".items"},
+		},
+		{
+			name:  "json array format",
+			flags: []string{"--format", "json-array"},
+		},
+		{
+			name:  "buffer limit",
+			flags: []string{"--buffer-limit", "1048576"},
+		},
+		{
+			name:  "keep keys",
+			flags: []string{"--keep-keys", "level,msg", "--keep-keys", "ts"},
+		},
+		{
+			name:  "array format",
+			flags: []string{"--array-format", "csv", "--array-delimiter", ";"},
+		},
+		{
+			name:  "strict abort",
+			flags: []string{"--strict-abort"},
+		},
+		{
+			name:  "field stats",
+			flags: []string{"--field-stats"},
+		},
+		{
+			name:  "infer schema",
+			flags: []string{"--infer-schema"},
+		},
+		{
+			name:  "debug",
+			flags: []string{"--debug"},
+		},
+		{
+			name:  "json summary",
+			flags: []string{"--summary-format", "json"},
+		},
+		{
+			name:  "min level",
+			flags: []string{"--min-level", "warn", "--level-rank", "debug=4", "--level-rank", "panic=100"},
+		},
+		{
+			name:  "count by",
+			flags: []string{"--count-by", "status"},
+		},
+		{
+			name:  "count by several fields",
+			flags: []string{"--count-by", "route,status", "--count-by", "method"},
+		},
+		{
+			name:  "parse message json",
+			flags: []string{"--parse-message-json"},
+		},
+		{
+			name:  "parse json field",
+			flags: []string{"--parse-json-field", "payload", "--parse-json-field", "body"},
+		},
+		{
+			name:  "raw output",
+			flags: []string{"--lax", "--raw-output"},
+		},
+		{
+			name:  "histogram",
+			flags: []string{"--histogram", "1m"},
+		},
+		{
+			name:  "group by",
+			flags: []string{"--group-by", "request_id", "--group-window", "10000"},
+		},
+		{
+			name:  "field order",
+			flags: []string{"--field-order", "alpha"},
+		},
+		{
+			name:  "field sort",
+			flags: []string{"--field-sort", "value-length"},
+		},
+		{
+			name:  "footer",
+			flags: []string{"--footer"},
+		},
+		{
+			name:  "epoch unit",
+			flags: []string{"--timekey", "ts", "--epoch-unit", "ms"},
+		},
+		{
+			name:  "unknown time",
+			flags: []string{"--unknown-time", ""},
+		},
+		{
+			name:  "show original",
+			flags: []string{"--show-original", "-e", ".a = 1"},
+		},
+		{
+			name:  "show sizes",
+			flags: []string{"--show-sizes", "payload,request", "--show-sizes", "response"},
+		},
+		{
+			name:  "alternate keys",
+			flags: []string{"--messagekey", "msg", "--messagekey", "message", "--levelkey", "level", "--levelkey", "severity", "--timekey", "ts", "--timekey", "time"},
+		},
+		{
+			name:  "docker format",
+			flags: []string{"--format", "docker"},
+		},
+		{
+			name:  "otlp format",
+			flags: []string{"--format", "otlp"},
+		},
+		{
+			name:  "journald format",
+			flags: []string{"--format", "journald", "--lowercase-keys"},
+		},
+		{
+			name:  "multi schema",
+			flags: []string{"--multi-schema"},
+		},
+		{
+			name:  "long lines",
+			flags: []string{"--on-long-line", "truncate"},
+		},
+		{
+			name:  "input fds",
+			flags: []string{"--input-fd", "3", "--input-fd", "4"},
+		},
+		{
+			name:  "level from message",
+			flags: []string{"--level-from-message", `^(?P<level>[A-Z]+): `, "--strip-level-from-message"},
+		},
+		{
+			name:  "strip ansi",
+			flags: []string{"--strip-ansi"},
+		},
+		{
+			name:  "relative to first",
+			flags: []string{"--relative-to-first"},
+		},
+		{
+			name:  "timezone",
+			flags: []string{"--timezone", "utc"},
+		},
+		{
+			name:  "input time format",
+			flags: []string{"--timekey", "time", "--input-time-format", "2006-01-02 15:04:05", "--input-time-format", "Jan _2, 2006 15:04:05", "--input-timezone", "America/New_York"},
+		},
+		{
+			name:  "lenient time",
+			flags: []string{"--lenient-time"},
+		},
+		{
+			name:  "unknown levels",
+			flags: []string{"--unknown-level", "info", "--drop-unknown-level", "--level-names", "warn=WARNING,unknown=???"},
+		},
+		{
+			name:  "level style",
+			flags: []string{"--level-style", "char"},
+		},
+		{
+			name:  "no elide field",
+			flags: []string{"--no-elide-field", "request_id", "--no-elide-field", "trace_id"},
+		},
+		{
+			name:  "reassert every",
+			flags: []string{"--reassert-every", "20"},
+		},
+		{
+			name:  "columns",
+			flags: []string{"--columns", "time,method,path", "--column-width", "path=20"},
+		},
+		{
+			name:  "no raw echo",
+			flags: []string{"--no-raw-echo"},
+		},
+		{
+			name:  "max error repeats",
+			flags: []string{"--max-error-repeats", "1000"},
+		},
+		{
+			name:  "jq error mode",
+			flags: []string{"--jq", ".a += 1", "--jq-error-mode", "skip"},
+		},
+		{
+			name:  "context separator stats",
+			flags: []string{"-C", "2", "--context-separator-stats"},
+		},
+		{
+			name:  "line numbers",
+			flags: []string{"-n"},
+		},
+		{
+			name:  "head",
+			flags: []string{"--head", "10", "-e", "select($LVL>=$ERROR)"},
+		},
+		{
+			name:  "tail",
+			flags: []string{"--tail", "10", "-C", "1"},
+		},
+		{
+			name:  "output file",
+			flags: []string{"-o", "/tmp/jlog.out"},
+		},
+		{
+			name:  "pager",
+			flags: []string{"--pager"},
+		},
+		{
+			name:  "color",
+			flags: []string{"--color", "always"},
+		},
+		{
+			name:  "color overrides deprecated flags",
+			flags: []string{"--color", "auto", "-M", "-c"},
+		},
+		{
+			name:  "multiline messages",
+			flags: []string{"--multiline-messages"},
+		},
+		{
+			name:  "expand field",
+			flags: []string{"--expand-field", "request", "--expand-field", "response"},
+		},
+		{
+			name:  "stacktrace field",
+			flags: []string{"--stacktrace-field", "trace"},
+		},
+		{
+			name:  "delete",
+			flags: []string{"--delete", "version", "--delete", "debug.*", "--upgrade", "data.request"},
+		},
+		{
+			name:  "rename",
+			flags: []string{"--rename", "http.request.method=method", "--rename", "msg2=message"},
+		},
+		{
+			name:  "source",
+			flags: []string{"--source", "http://localhost:8080/logs"},
+		},
+		{
+			name:  "unix socket source",
+			flags: []string{"--source", "unix:///run/agent.sock", "--source-reconnect", "--source-retries", "0"},
+		},
+		{
+			name:  "quote strings",
+			flags: []string{"--quote-strings"},
+		},
+		{
+			name:  "dedupe",
+			flags: []string{"--dedupe"},
+		},
+		{
+			name:  "sample",
+			flags: []string{"--sample", "1/100"},
+		},
+		{
+			name:  "jobs",
+			flags: []string{"--jobs", "4", "--no-elide"},
+		},
+		{
+			name:  "markdown",
+			flags: []string{"--output", "markdown", "--columns", "time,msg", "--columns", "foo"},
+		},
+		{
+			name:  "json visible",
+			flags: []string{"--output", "json-visible", "--json-key-order", "seen", "--json-color", "--json-numbers-as-strings"},
+		},
 	}
 
 	for _, test := range testData {
@@ -73,6 +387,20 @@ func TestFlagParsing(t *testing.T) {
 	}
 }
 
+func TestPrintPanicStack(t *testing.T) {
+	err := fmt.Errorf("input line 1: %w", &parse.PanicError{Value: "oh no", Stack: []byte("goroutine 1 [running]:")})
+	w := new(strings.Builder)
+	PrintPanicStack(General{}, err, w)
+	PrintPanicStack(General{Debug: true}, errors.New("not a panic"), w)
+	if got := w.String(); got != "" {
+		t.Errorf("expected no output without --debug or a panic; got %q", got)
+	}
+	PrintPanicStack(General{Debug: true}, err, w)
+	if got, want := w.String(), "goroutine 1 [running]:\n"; got != want {
+		t.Errorf("output:\n  got: %q\n want: %q", got, want)
+	}
+}
+
 func TestPrintOutputSummary(t *testing.T) {
 	w := new(strings.Builder)
 	PrintOutputSummary(Output{}, parse.Summary{}, w)
@@ -80,4 +408,627 @@ func TestPrintOutputSummary(t *testing.T) {
 	if got, want := w.String(), "  0 lines read; no parse errors.\n"; got != want {
 		t.Errorf("output:\n  got: %q\n want: %q", got, want)
 	}
+
+	w.Reset()
+	PrintOutputSummary(Output{NoSummary: true, FieldStats: true}, parse.Summary{FieldCounts: map[string]int{"a": 1}}, w)
+	if got, want := w.String(), "  Fields seen:\n    lines  field\n        1  a\n"; got != want {
+		t.Errorf("output with field stats:\n  got: %q\n want: %q", got, want)
+	}
+
+	w.Reset()
+	PrintOutputSummary(Output{NoSummary: true, InferSchema: true}, parse.Summary{Schema: &parse.InferredSchema{
+		Lines:  2,
+		Fields: map[string]*parse.FieldSchema{"a": {Lines: 1, Types: map[string]int{"number": 1}, Example: 42.0}},
+	}}, w)
+	if got, want := w.String(), "  Schema:\n    field  fill  types   example\n    a       50%  number  42\n"; got != want {
+		t.Errorf("output with schema:\n  got: %q\n want: %q", got, want)
+	}
+
+	w.Reset()
+	PrintOutputSummary(Output{SummaryFormat: "json"}, parse.Summary{Lines: 3, Errors: 1, Filtered: 1}, w)
+	PrintOutputSummary(Output{SummaryFormat: "json", NoSummary: true}, parse.Summary{}, w)
+	if got, want := w.String(), `{"lines":3,"errors":1,"filtered":1}`+"\n"; got != want {
+		t.Errorf("json output:\n  got: %q\n want: %q", got, want)
+	}
+
+	w.Reset()
+	PrintOutputSummary(Output{NoSummary: true, Footer: true}, parse.Summary{Errors: 1}, w)
+	if got, want := w.String(), "  Errors: 1\n"; got != want {
+		t.Errorf("output with footer:\n  got: %q\n want: %q", got, want)
+	}
+}
+
+func TestHighlightMatchRequiresRegex(t *testing.T) {
+	if _, err := NewFilterScheme(General{HighlightMatch: true}); err == nil {
+		t.Error("expected an error when --highlight-match is set without --regex")
+	}
+}
+
+func TestUnknownHighlightLevel(t *testing.T) {
+	if _, err := NewOutputFormatter(Output{HighlightLevels: []string{"loud"}}, General{}); err == nil {
+		t.Error("expected an error for an unknown --highlight-level")
+	}
+}
+
+func TestInvalidColorField(t *testing.T) {
+	for _, spec := range []string{"status", "status:rainbow"} {
+		if _, err := NewOutputFormatter(Output{ColorFields: []string{spec}}, General{}); err == nil {
+			t.Errorf("expected an error for --color-field %q", spec)
+		}
+	}
+}
+
+func TestNoColorField(t *testing.T) {
+	outs, err := NewOutputFormatter(Output{ColorFields: []string{""}}, General{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := outs.Formatter.(*parse.DefaultOutputFormatter).ColorFields; len(got) > 0 {
+		t.Errorf("color fields:\n  got: %v\n want: none", got)
+	}
+}
+
+func TestLevelRanks(t *testing.T) {
+	fsch, err := NewFilterScheme(General{MinLevel: "WARN", LevelRanks: []string{"debug=4", "panic=100"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fsch.MinLevel, parse.LevelWarn; got != want {
+		t.Errorf("min level:\n  got: %v\n want: %v", got, want)
+	}
+	if diff := cmp.Diff(fsch.LevelRanks, parse.LevelRanks{parse.LevelDebug: 4, parse.LevelPanic: 100}); diff != "" {
+		t.Errorf("level ranks:\n%s", diff)
+	}
+
+	for _, gen := range []General{
+		{MinLevel: "loud"},
+		{LevelRanks: []string{"debug"}},
+		{LevelRanks: []string{"loud=1"}},
+		{LevelRanks: []string{"debug=high"}},
+	} {
+		if _, err := NewFilterScheme(gen); err == nil {
+			t.Errorf("expected an error for %#v", gen)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	fsch, err := NewFilterScheme(General{Sample: "1/100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fsch.SampleEvery, 100; got != want {
+		t.Errorf("sample every:\n  got: %v\n want: %v", got, want)
+	}
+	for _, rate := range []string{"100", "2/100", "1/0", "1/x", "1/-1"} {
+		if _, err := NewFilterScheme(General{Sample: rate}); err == nil {
+			t.Errorf("%q: expected an error", rate)
+		}
+	}
+}
+
+func TestCountByConflictsWithOutput(t *testing.T) {
+	if _, err := NewOutputFormatter(Output{CountBy: []string{"status"}, OutputFormat: "markdown"}, General{}); err == nil {
+		t.Error("expected an error when --count-by is combined with --output")
+	}
+}
+
+func TestCountByFields(t *testing.T) {
+	outs, err := NewOutputFormatter(Output{CountBy: []string{"route,status", "method"}}, General{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, ok := outs.Formatter.(*parse.CountFormatter)
+	if !ok {
+		t.Fatalf("formatter: got %T, want *parse.CountFormatter", outs.Formatter)
+	}
+	if diff := cmp.Diff(f.Fields, []string{"route", "status", "method"}); diff != "" {
+		t.Errorf("fields:\n%s", diff)
+	}
+	if _, err := NewOutputFormatter(Output{CountBy: []string{"route,"}}, General{}); err == nil {
+		t.Error("expected an error for an empty field name")
+	}
+}
+
+func TestRawOutputConflictsWithNoRawEcho(t *testing.T) {
+	if _, err := NewOutputFormatter(Output{RawOutput: true, NoRawEcho: true}, General{}); err == nil {
+		t.Error("expected an error when --raw-output is combined with --no-raw-echo")
+	}
+}
+
+func TestHistogramConflicts(t *testing.T) {
+	for _, out := range []Output{
+		{Histogram: "1m", OutputFormat: "markdown"},
+		{Histogram: "1m", CountBy: []string{"status"}},
+		{Histogram: "-1m"},
+		{Histogram: "0s"},
+		{Histogram: "minute"},
+	} {
+		if _, err := NewOutputFormatter(out, General{}); err == nil {
+			t.Errorf("%#v: expected an error", out)
+		}
+	}
+}
+
+func TestDedupeConflicts(t *testing.T) {
+	for _, out := range []Output{
+		{Dedupe: true, OutputFormat: "json-visible"},
+		{Dedupe: true, CountBy: []string{"status"}},
+	} {
+		if _, err := NewOutputFormatter(out, General{}); err == nil {
+			t.Errorf("%#v: expected an error", out)
+		}
+	}
+}
+
+func TestGroupByConflicts(t *testing.T) {
+	for _, test := range []struct {
+		out Output
+		gen General
+	}{
+		{out: Output{GroupBy: "request_id", OutputFormat: "markdown"}},
+		{out: Output{GroupBy: "request_id", CountBy: []string{"status"}}},
+		{out: Output{GroupBy: "request_id", Head: 10}},
+		{out: Output{GroupBy: "request_id"}, gen: General{TUI: true}},
+		{out: Output{GroupBy: "request_id", GroupWindow: -1}},
+		{out: Output{GroupWindow: 100}},
+		{out: Output{GroupBy: "request_id"}, gen: General{BufferLimit: 1 << 20}},
+	} {
+		if _, err := NewOutputFormatter(test.out, test.gen); err == nil {
+			t.Errorf("%#v: expected an error", test.out)
+		}
+	}
+	if _, err := NewOutputFormatter(Output{GroupBy: "request_id", GroupWindow: 100}, General{BufferLimit: 1 << 20}); err != nil {
+		t.Errorf("--group-window with --buffer-limit: %v", err)
+	}
+}
+
+func TestLevelNames(t *testing.T) {
+	outs, err := NewOutputFormatter(Output{LevelNames: []string{"warn=WARNING", "unknown=?"}}, General{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[parse.Level]string{parse.LevelWarn: "WARNING", parse.LevelUnknown: "?"}
+	if diff := cmp.Diff(outs.Formatter.(*parse.DefaultOutputFormatter).LevelNames, want); diff != "" {
+		t.Errorf("level names:\n%s", diff)
+	}
+	for _, spec := range []string{"warn", "warn=", "loud=LOUD"} {
+		if _, err := NewOutputFormatter(Output{LevelNames: []string{spec}}, General{}); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+	if _, err := NewInputSchema(Input{UnknownLevel: "loud"}); err == nil {
+		t.Error("expected an error for an unknown --unknown-level")
+	}
+}
+
+func TestNegativeReassertEvery(t *testing.T) {
+	if _, err := NewOutputFormatter(Output{ReassertEvery: -1}, General{}); err == nil {
+		t.Error("expected an error for a negative --reassert-every")
+	}
+}
+
+func TestColor(t *testing.T) {
+	testData := []struct {
+		name    string
+		gen     General
+		env     map[string]string
+		want    bool
+		wantErr bool
+	}{
+		{name: "auto, not a terminal", gen: General{Color: "auto"}, want: false},
+		{name: "NO_COLOR", env: map[string]string{"NO_COLOR": "1", "CLICOLOR_FORCE": "1"}, want: false},
+		{name: "empty NO_COLOR", env: map[string]string{"NO_COLOR": "", "CLICOLOR_FORCE": "1"}, want: true},
+		{name: "CLICOLOR_FORCE", env: map[string]string{"CLICOLOR_FORCE": "1"}, want: true},
+		{name: "CLICOLOR_FORCE=0", env: map[string]string{"CLICOLOR_FORCE": "0"}, want: false},
+		{name: "flag overrides NO_COLOR", gen: General{Color: "always"}, env: map[string]string{"NO_COLOR": "1"}, want: true},
+		{name: "deprecated flag overrides CLICOLOR_FORCE", gen: General{NoColor: true}, env: map[string]string{"CLICOLOR_FORCE": "1"}, want: false},
+		{name: "always", gen: General{Color: "always"}, want: true},
+		{name: "never", gen: General{Color: "never", NoMonochrome: true}, want: false},
+		{name: "deprecated no-color", gen: General{NoColor: true}, want: false},
+		{name: "deprecated no-monochrome", gen: General{NoMonochrome: true}, want: true},
+		{name: "deprecated flags together", gen: General{NoColor: true, NoMonochrome: true}, want: false},
+		{name: "invalid", gen: General{Color: "sometimes"}, wantErr: true},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", "")
+			t.Setenv("CLICOLOR_FORCE", "")
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+			outs, err := NewOutputFormatter(Output{}, test.gen)
+			if err != nil {
+				if !test.wantErr {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if test.wantErr {
+				t.Fatal("expected an error")
+			}
+			f := outs.Formatter.(*parse.DefaultOutputFormatter)
+			if got := f.Aurora.Red("x").String() != "x"; got != test.want {
+				t.Errorf("color:\n  got: %v\n want: %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHeadTailErrors(t *testing.T) {
+	testData := []struct {
+		name string
+		out  Output
+		gen  General
+	}{
+		{name: "negative head", out: Output{Head: -1}},
+		{name: "negative tail", out: Output{Tail: -1}},
+		{name: "head and tail", out: Output{Head: 1, Tail: 1}},
+		{name: "tail and tui", out: Output{Tail: 1}, gen: General{TUI: true}},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewOutputFormatter(test.out, test.gen); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestColumns(t *testing.T) {
+	outs, err := NewOutputFormatter(Output{Columns: []string{"time,level,method", "path"}, ColumnWidths: []string{"path=20"}}, General{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := outs.Formatter.(*parse.DefaultOutputFormatter)
+	if diff := cmp.Diff(f.Columns, []string{"method", "path"}); diff != "" {
+		t.Errorf("columns:\n%s", diff)
+	}
+	if diff := cmp.Diff(f.ColumnWidths, map[string]int{"path": 20}); diff != "" {
+		t.Errorf("column widths:\n%s", diff)
+	}
+	for _, spec := range []string{"path", "path=wide", "path=0"} {
+		if _, err := NewOutputFormatter(Output{ColumnWidths: []string{spec}}, General{}); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestWrapRequiresWidth(t *testing.T) {
+	if _, err := NewOutputFormatter(Output{Wrap: true}, General{}); err == nil {
+		t.Error("expected an error when --wrap is set without --message-width")
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	testData := []struct {
+		zone string
+		want *time.Location
+	}{
+		{zone: "", want: time.Local},
+		{zone: "local", want: time.Local},
+		{zone: "UTC", want: time.UTC},
+		{zone: "America/New_York", want: ny},
+	}
+	for _, test := range testData {
+		outs, err := NewOutputFormatter(Output{Timezone: test.zone}, General{})
+		if err != nil {
+			t.Errorf("timezone %q: %v", test.zone, err)
+			continue
+		}
+		if got, want := outs.Formatter.(*parse.DefaultOutputFormatter).Zone.String(), test.want.String(); got != want {
+			t.Errorf("timezone %q: zone:\n  got: %v\n want: %v", test.zone, got, want)
+		}
+	}
+	if _, err := NewOutputFormatter(Output{Timezone: "Mars/Olympus_Mons"}, General{}); err == nil {
+		t.Error("expected an error for an unknown time zone")
+	}
+}
+
+func TestLevelFormat(t *testing.T) {
+	testData := []struct {
+		format  string
+		input   interface{}
+		want    parse.Level
+		wantErr bool
+	}{
+		{format: "", input: "warn", want: parse.LevelWarn},
+		{format: "string", input: "warn", want: parse.LevelWarn},
+		{format: "bunyan", input: float64(40), want: parse.LevelWarn},
+		{format: "lager", input: float64(2), want: parse.LevelError},
+		{format: "syslog", input: float64(4), want: parse.LevelWarn},
+		{format: "zap-numeric", input: float64(1), want: parse.LevelWarn},
+	}
+	for _, test := range testData {
+		ins, err := NewInputSchema(Input{LevelKey: []string{"level"}, LevelFormat: test.format})
+		if err != nil {
+			t.Fatalf("format %q: new input schema: %v", test.format, err)
+		}
+		got, err := ins.LevelFormat(test.input)
+		if err != nil {
+			t.Errorf("format %q: parse level: %v", test.format, err)
+		}
+		if got != test.want {
+			t.Errorf("format %q: level:\n  got: %v\n want: %v", test.format, got, test.want)
+		}
+	}
+	if _, err := NewInputSchema(Input{LevelFormat: "syslog"}); err == nil {
+		t.Error("expected an error when --level-format is set without --levelkey")
+	}
+}
+
+func TestEpochUnit(t *testing.T) {
+	ins, err := NewInputSchema(Input{TimestampKey: []string{"ts"}, EpochUnit: "ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ins.TimeFormat(float64(1500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(1, 500000000); !got.Equal(want) {
+		t.Errorf("time:\n  got: %v\n want: %v", got, want)
+	}
+	if _, err := NewInputSchema(Input{EpochUnit: "ms"}); err == nil {
+		t.Error("expected an error when --epoch-unit is set without --timekey")
+	}
+}
+
+func TestInputTimeFormat(t *testing.T) {
+	ins, err := NewInputSchema(Input{TimestampKey: []string{"ts"}, EpochUnit: "ms", InputTimeFormat: []string{"2006-01-02 15:04:05", "Jan _2, 2006 15:04:05"}, InputTimezone: "UTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range []interface{}{"1970-01-01 00:00:01.5", "Jan  1, 1970 00:00:01.5", "1970-01-01T00:00:01.5Z", float64(1500)} {
+		got, err := ins.TimeFormat(in)
+		if err != nil {
+			t.Errorf("%v: %v", in, err)
+			continue
+		}
+		if want := time.Unix(1, 500000000); !got.Equal(want) {
+			t.Errorf("%v: time:\n  got: %v\n want: %v", in, got, want)
+		}
+	}
+	if _, err := ins.TimeFormat("yesterday"); err == nil {
+		t.Error("expected an error for a time in none of the formats")
+	}
+
+	for _, in := range []Input{
+		{InputTimeFormat: []string{"2006-01-02 15:04:05"}},
+		{TimestampKey: []string{"ts"}, InputTimezone: "UTC"},
+		{TimestampKey: []string{"ts"}, InputTimeFormat: []string{"2006-01-02 15:04:05"}, InputTimezone: "Mars/Olympus_Mons"},
+	} {
+		if _, err := NewInputSchema(in); err == nil {
+			t.Errorf("%#v: expected an error", in)
+		}
+	}
+}
+
+func TestDockerFormat(t *testing.T) {
+	ins, err := NewInputSchema(Input{Format: "docker"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ins.Parse([]byte(`{"log":"hello, world\n","stream":"stderr","time":"2023-01-02T03:04:05.123456789Z"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := parse.ParsedLine{
+		Time:    time.Date(2023, 1, 2, 3, 4, 5, 123456789, time.UTC),
+		Message: "hello, world",
+		Fields:  map[string]interface{}{"stream": "stderr"},
+	}
+	if diff := cmp.Diff(got, want, cmpopts.IgnoreFields(parse.ParsedLine{}, "Raw")); diff != "" {
+		t.Errorf("parsed line:\n%s", diff)
+	}
+
+	// Explicit flags win.
+	ins, err = NewInputSchema(Input{Format: "docker", MessageKey: []string{"msg"}, LevelKey: []string{"level"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ins.MessageKey, "msg"; got != want {
+		t.Errorf("message key:\n  got: %v\n want: %v", got, want)
+	}
+	if ins.NoLevelKey {
+		t.Error("expected levels to be read with an explicit --levelkey")
+	}
+}
+
+func TestJournaldFormat(t *testing.T) {
+	// From journalctl -o json, trimmed a little.
+	input := []string{
+		`{"__CURSOR":"s=0c5b;i=1a2b;b=9f1e;m=3c2d;t=60a1;x=5e6f","__REALTIME_TIMESTAMP":"1700000000123456","__MONOTONIC_TIMESTAMP":"123456789","_BOOT_ID":"9f1e","PRIORITY":"6","SYSLOG_IDENTIFIER":"sshd","_PID":"1234","_COMM":"sshd","MESSAGE":"Accepted publickey for jrockway"}`,
+		`{"__CURSOR":"s=0c5b;i=1a2c;b=9f1e;m=3c2e;t=60a2;x=5e70","__REALTIME_TIMESTAMP":"1700000001000001","__MONOTONIC_TIMESTAMP":"123456790","_BOOT_ID":"9f1e","PRIORITY":"3","SYSLOG_IDENTIFIER":"kernel","MESSAGE":"usb 1-1: device descriptor read/64, error -71"}`,
+		`{"__CURSOR":"s=0c5b;i=1a2d;b=9f1e;m=3c2f;t=60a3;x=5e71","__REALTIME_TIMESTAMP":"1700000002000000","PRIORITY":"7","MESSAGE":"debugging","CODE_FILE":"main.c","code_file":"lower.c"}`,
+	}
+	want := []parse.ParsedLine{
+		{
+			Time:    time.Date(2023, 11, 14, 22, 13, 20, 123456000, time.UTC),
+			Level:   parse.LevelInfo,
+			Message: "Accepted publickey for jrockway",
+			Fields:  map[string]interface{}{"_boot_id": "9f1e", "syslog_identifier": "sshd", "_pid": "1234", "_comm": "sshd"},
+		},
+		{
+			Time:    time.Date(2023, 11, 14, 22, 13, 21, 1000, time.UTC),
+			Level:   parse.LevelError,
+			Message: "usb 1-1: device descriptor read/64, error -71",
+			Fields:  map[string]interface{}{"_boot_id": "9f1e", "syslog_identifier": "kernel"},
+		},
+		{
+			Time:    time.Date(2023, 11, 14, 22, 13, 22, 0, time.UTC),
+			Level:   parse.LevelDebug,
+			Message: "debugging",
+			// code_file was already taken.
+			Fields: map[string]interface{}{"CODE_FILE": "main.c", "code_file": "lower.c"},
+		},
+	}
+	ins, err := NewInputSchema(Input{Format: "journald", LowercaseKeys: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []parse.ParsedLine
+	for _, l := range input {
+		p, err := ins.Parse([]byte(l))
+		if err != nil {
+			t.Fatalf("parse %s: %v", l, err)
+		}
+		p.Time = p.Time.UTC()
+		got = append(got, p)
+	}
+	if diff := cmp.Diff(got, want, cmpopts.IgnoreFields(parse.ParsedLine{}, "Raw")); diff != "" {
+		t.Errorf("parsed lines:\n%s", diff)
+	}
+
+	// Keys aren't lower-cased unless asked.
+	ins, err = NewInputSchema(Input{Format: "journald"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ins.Parse([]byte(input[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(p.Fields, map[string]interface{}{"_BOOT_ID": "9f1e", "SYSLOG_IDENTIFIER": "kernel"}); diff != "" {
+		t.Errorf("fields:\n%s", diff)
+	}
+}
+
+func TestOTLPFormat(t *testing.T) {
+	input := `{"resourceLogs":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"api"}}]},"scopeLogs":[{"logRecords":[` +
+		`{"timeUnixNano":"1700000000123456789","severityNumber":17,"severityText":"ERROR","body":{"stringValue":"request failed"},"attributes":[{"key":"status","value":{"intValue":"500"}}]},` +
+		`{"observedTimeUnixNano":"1700000001000000000","severityText":"warn","body":{"stringValue":"slow request"}}` +
+		`]}]}]}`
+	want := []parse.ParsedLine{
+		{
+			Time:    time.Date(2023, 11, 14, 22, 13, 20, 123456789, time.UTC),
+			Level:   parse.LevelError,
+			Message: "request failed",
+			Fields:  map[string]interface{}{"service.name": "api", "status": float64(500)},
+		},
+		{
+			Time:    time.Date(2023, 11, 14, 22, 13, 21, 0, time.UTC),
+			Level:   parse.LevelWarn,
+			Message: "slow request",
+			Fields:  map[string]interface{}{"service.name": "api"},
+		},
+	}
+	in := Input{Format: "otlp"}
+	ins, err := NewInputSchema(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, err := io.ReadAll(NewInputReader(strings.NewReader(input), in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []parse.ParsedLine
+	for _, l := range strings.Split(strings.TrimSpace(string(lines)), "\n") {
+		p, err := ins.Parse([]byte(l))
+		if err != nil {
+			t.Fatalf("parse %s: %v", l, err)
+		}
+		p.Time = p.Time.UTC()
+		got = append(got, p)
+	}
+	if diff := cmp.Diff(got, want, cmpopts.IgnoreFields(parse.ParsedLine{}, "Raw")); diff != "" {
+		t.Errorf("parsed lines:\n%s", diff)
+	}
+
+	if _, err := NewInputSchema(Input{Format: "otlp", Root: ".items"}); err == nil {
+		t.Error("expected an error for --root with --format otlp")
+	}
+}
+
+func TestDeleteKeys(t *testing.T) {
+	ins, err := NewInputSchema(Input{DeleteKeys: []string{"version", "debug.*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ins.Parse([]byte(`{"ts":1,"level":"info","msg":"hi","version":2,"debug.a":1,"debug.b":2,"user":"me"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got.Fields, map[string]interface{}{"user": "me"}); diff != "" {
+		t.Errorf("fields:\n%s", diff)
+	}
+	if _, err := NewInputSchema(Input{DeleteKeys: []string{"debug.["}}); err == nil {
+		t.Error("expected an error for a bad pattern")
+	}
+}
+
+func TestRenameKeys(t *testing.T) {
+	ins, err := NewInputSchema(Input{RenameKeys: []string{"http.request.method=method"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(ins.RenameKeys, map[string]string{"http.request.method": "method"}); diff != "" {
+		t.Errorf("rename keys:\n%s", diff)
+	}
+	for _, r := range []string{"method", "=method", "method="} {
+		if _, err := NewInputSchema(Input{RenameKeys: []string{r}}); err == nil {
+			t.Errorf("%q: expected an error", r)
+		}
+	}
+}
+
+func TestLevelFromMessage(t *testing.T) {
+	ins, err := NewInputSchema(Input{Format: "docker", LevelFromMessage: `^\[(?P<level>\w+)\] `, StripLevelFromMessage: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ins.Parse([]byte(`{"log":"[WARN] disk is full\n","stream":"stderr","time":"2023-01-02T03:04:05Z"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := got.Level, parse.LevelWarn; got != want {
+		t.Errorf("level:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := got.Message, "disk is full"; got != want {
+		t.Errorf("message:\n  got: %v\n want: %v", got, want)
+	}
+
+	for _, in := range []Input{
+		{LevelFromMessage: `(`},
+		{LevelFromMessage: `^\[(\w+)\] `},
+		{StripLevelFromMessage: true},
+	} {
+		if _, err := NewInputSchema(in); err == nil {
+			t.Errorf("%#v: expected an error", in)
+		}
+	}
+}
+
+func TestInputReader(t *testing.T) {
+	r := NewInputReader(strings.NewReader(`{"items":[{"msg":"a"},{"msg":"b"}]}`), Input{Root: ".items"})
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"msg\":\"a\"}\n{\"msg\":\"b\"}\n"; string(got) != want {
+		t.Errorf("input:\n  got: %q\n want: %q", got, want)
+	}
+
+	r = NewInputReader(strings.NewReader(`[{"msg":"a"}, {"msg":"b"}]`), Input{Format: "json-array"})
+	got, err = io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"msg\":\"a\"}\n{\"msg\":\"b\"}\n"; string(got) != want {
+		t.Errorf("json-array input:\n  got: %q\n want: %q", got, want)
+	}
+
+	// Plain text often starts with '[', so without --format json-array or --root, the input is
+	// never treated as an array.
+	plain := strings.NewReader("[INFO] starting up\n{\"ts\":1,\"level\":\"info\",\"msg\":\"a\"}\n")
+	if got := NewInputReader(plain, Input{}); got != plain {
+		t.Error("expected input to be returned as-is without --root or --format")
+	}
+	if _, err := NewInputSchema(Input{Format: "json-array", Root: ".items"}); err == nil {
+		t.Error("expected an error combining --format json-array with --root")
+	}
 }
@@ -0,0 +1,372 @@
+package jlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Source is somewhere other than stdin to read logs from, for --source.
+type Source interface {
+	// Open starts streaming in the background, and returns a reader of the log lines.  Closing
+	// the reader stops streaming.
+	Open() io.ReadCloser
+}
+
+// NewSource returns the Source for a --source URL: http:// and https:// URLs are read with an
+// HTTPSource, and unix:// and file:// URLs with a LocalSource.
+func NewSource(in Input, log io.Writer) (Source, error) {
+	if in.SourceRetries < 0 {
+		return nil, errors.New("--source-retries must not be negative")
+	}
+	var s Source
+	var retry *Retry
+	switch {
+	case strings.HasPrefix(in.Source, "unix:"), strings.HasPrefix(in.Source, "file:"):
+		ls, err := NewLocalSource(in.Source, log)
+		if err != nil {
+			return nil, err
+		}
+		s, retry = ls, &ls.Retry
+	default:
+		hs, err := NewHTTPSource(in.Source, log)
+		if err != nil {
+			return nil, err
+		}
+		s, retry = hs, &hs.Retry
+	}
+	retry.MaxAttempts = in.SourceRetries
+	retry.Reconnect = in.SourceReconnect
+	return s, nil
+}
+
+// Retry controls how a source reconnects.
+type Retry struct {
+	MaxAttempts int           // MaxAttempts is the number of times in a row to try connecting before giving up.  0 means forever.
+	Backoff     time.Duration // Backoff is how long to wait before the first retry; later retries wait twice as long as the last, up to MaxBackoff.
+	MaxBackoff  time.Duration // MaxBackoff is the longest time to wait between retries.
+	Reconnect   bool          // Reconnect, if true, reconnects after a stream that ends normally, instead of ending the logs.
+	Log         io.Writer     // Log, if non-nil, receives a line about each retry.
+}
+
+// defaultRetry is the Retry that sources are created with.
+func defaultRetry(log io.Writer) Retry {
+	return Retry{
+		MaxAttempts: 10,
+		Backoff:     time.Second,
+		MaxBackoff:  30 * time.Second,
+		Log:         log,
+	}
+}
+
+// HTTPSource streams logs from an HTTP endpoint, for --source.  A response of type
+// text/event-stream is treated as server-sent events, and the data of each event is a log line;
+// any other response body is read as-is, which suits chunked responses.  Network errors, including
+// a connection that drops in the middle of the response, and server errors are retried; other
+// client errors are fatal, and a response that ends normally ends the logs, unless Reconnect is
+// set.  As the SSE spec requires, an event stream is reconnected to even when it ends normally,
+// until the server responds with 204 No Content.
+type HTTPSource struct {
+	URL    string       // URL is the endpoint to stream from.
+	Client *http.Client // Client makes the requests.  If nil, http.DefaultClient is used.
+	Retry
+
+	lastEventID string
+}
+
+// NewHTTPSource returns an HTTPSource with reasonable defaults for the CLI.
+func NewHTTPSource(u string, log io.Writer) (*HTTPSource, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, fmt.Errorf("parse url: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q; only http, https, unix, and file are supported", parsed.Scheme)
+	}
+	return &HTTPSource{
+		URL:   u,
+		Retry: defaultRetry(log),
+	}, nil
+}
+
+// errRetry wraps errors that are worth reconnecting after.
+type errRetry struct{ err error }
+
+func (e *errRetry) Error() string { return e.err.Error() }
+func (e *errRetry) Unwrap() error { return e.err }
+
+// errDone is returned by stream when there is nothing more to read.
+var errDone = errors.New("done")
+
+// Open implements Source.
+func (s *HTTPSource) Open() io.ReadCloser {
+	return openSource(&s.Retry, s.stream)
+}
+
+// openSource streams in the background, with retries.
+func openSource(r *Retry, stream func(ctx context.Context, w *lineWriter) error) io.ReadCloser {
+	ctx, cancel := context.WithCancel(context.Background())
+	pr, pw := io.Pipe()
+	go func() {
+		defer cancel()
+		pw.CloseWithError(r.run(ctx, pw, stream)) //nolint:errcheck
+	}()
+	return &sourceReader{PipeReader: pr, cancel: cancel}
+}
+
+type sourceReader struct {
+	*io.PipeReader
+	cancel func()
+}
+
+func (r *sourceReader) Close() error {
+	r.cancel()
+	return r.PipeReader.Close()
+}
+
+// run streams until the stream is done, a permanent error occurs, or MaxAttempts connections in a
+// row fail.
+func (s *Retry) run(ctx context.Context, w io.Writer, stream func(ctx context.Context, w *lineWriter) error) error {
+	backoff := s.Backoff
+	failures := 0
+	for {
+		lw := &lineWriter{w: w}
+		err := stream(ctx, lw)
+		if errors.Is(err, errDone) {
+			return nil
+		}
+		var retry *errRetry
+		if !errors.As(err, &retry) {
+			return err
+		}
+		if lw.partial {
+			// Don't let the start of the next line run into what was read of this one.
+			if _, err := w.Write([]byte("\n")); err != nil {
+				return err
+			}
+		}
+		if lw.wrote {
+			// We were connected long enough to read something, so start over.
+			failures, backoff = 0, s.Backoff
+		}
+		failures++
+		if s.MaxAttempts > 0 && failures >= s.MaxAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w", failures, err)
+		}
+		if s.Log != nil {
+			fmt.Fprintf(s.Log, "source: %v; reconnecting in %v\n", err, backoff)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > s.MaxBackoff {
+			backoff = s.MaxBackoff
+		}
+	}
+}
+
+// stream makes one request, and copies its logs to w.
+func (s *HTTPSource) stream(ctx context.Context, w *lineWriter) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream, application/x-ndjson, application/json;q=0.9, */*;q=0.8")
+	if s.lastEventID != "" {
+		req.Header.Set("Last-Event-ID", s.lastEventID)
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &errRetry{err: fmt.Errorf("request: %w", err)}
+	}
+	defer res.Body.Close()
+
+	eventStream := false
+	if t, _, err := mime.ParseMediaType(res.Header.Get("Content-Type")); err == nil && t == "text/event-stream" {
+		eventStream = true
+	}
+	switch {
+	case res.StatusCode == http.StatusNoContent:
+		return errDone
+	case res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests:
+		return &errRetry{err: fmt.Errorf("unexpected status %s", res.Status)}
+	case res.StatusCode != http.StatusOK:
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	if eventStream {
+		err = s.readEvents(res.Body, w)
+	} else {
+		_, err = io.Copy(w, res.Body)
+	}
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case err != nil && !errors.Is(err, w.err):
+		return &errRetry{err: fmt.Errorf("read: %w", err)}
+	case err != nil:
+		// Writing failed because the reader was closed; there's no point in continuing.
+		return err
+	case eventStream:
+		return &errRetry{err: errors.New("event stream ended")}
+	case s.Reconnect:
+		return &errRetry{err: errors.New("response ended")}
+	}
+	return errDone
+}
+
+// LocalSource streams logs from a Unix domain socket or a file, for --source unix:///path and
+// file:///path.  Files are meant to be named pipes, which can be reopened to wait for the next
+// writer once the current one is done.  Failing to connect, and errors while reading, are retried;
+// the other end closing the connection ends the logs, unless Reconnect is set.
+type LocalSource struct {
+	Path   string // Path is the path to the socket or file.
+	Socket bool   // Socket is true if Path is a Unix domain socket to connect to, rather than a file to open.
+	Retry
+}
+
+// NewLocalSource returns a LocalSource with reasonable defaults for the CLI.
+func NewLocalSource(u string, log io.Writer) (*LocalSource, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, fmt.Errorf("parse url: %w", err)
+	}
+	if parsed.Scheme != "unix" && parsed.Scheme != "file" {
+		return nil, fmt.Errorf("unsupported scheme %q; only unix and file are supported", parsed.Scheme)
+	}
+	// unix:///tmp/sock has an absolute path; unix://sock and unix:sock are relative.
+	p := parsed.Host + parsed.Path
+	if parsed.Opaque != "" {
+		p = parsed.Opaque
+	}
+	if p == "" {
+		return nil, fmt.Errorf("no path in %q", u)
+	}
+	return &LocalSource{
+		Path:   p,
+		Socket: parsed.Scheme == "unix",
+		Retry:  defaultRetry(log),
+	}, nil
+}
+
+// Open implements Source.
+func (s *LocalSource) Open() io.ReadCloser {
+	return openSource(&s.Retry, s.stream)
+}
+
+// stream connects to the socket or opens the file once, and copies its logs to w.
+func (s *LocalSource) stream(ctx context.Context, w *lineWriter) error {
+	var r io.ReadCloser
+	if s.Socket {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "unix", s.Path)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return &errRetry{err: fmt.Errorf("dial: %w", err)}
+		}
+		r = conn
+	} else {
+		// Opening a named pipe blocks until there's a writer.
+		f, err := os.Open(s.Path)
+		if err != nil {
+			return &errRetry{err: fmt.Errorf("open: %w", err)}
+		}
+		r = f
+	}
+	defer r.Close()
+
+	// Closing is the only way to interrupt a read that's waiting for data.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.Close()
+		case <-done:
+		}
+	}()
+
+	_, err := io.Copy(w, r)
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case err != nil && !errors.Is(err, w.err):
+		return &errRetry{err: fmt.Errorf("read: %w", err)}
+	case err != nil:
+		return err
+	case s.Reconnect:
+		return &errRetry{err: errors.New("connection closed")}
+	}
+	return errDone
+}
+
+// readEvents copies the data of each server-sent event in r to w, one line per line of data.
+// See https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation.
+func (s *HTTPSource) readEvents(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		field, value := scanner.Bytes(), []byte(nil)
+		if i := bytes.IndexByte(field, ':'); i >= 0 {
+			field, value = field[:i], bytes.TrimPrefix(field[i+1:], []byte(" "))
+		}
+		switch string(field) {
+		case "data":
+			line := make([]byte, len(value)+1)
+			copy(line, value)
+			line[len(value)] = '\n'
+			if _, err := w.Write(line); err != nil {
+				return err
+			}
+		case "id":
+			s.lastEventID = string(value)
+		case "retry":
+			if ms, err := strconv.Atoi(string(value)); err == nil && ms > 0 {
+				s.Backoff = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// lineWriter tracks whether the last thing written was a complete line.
+type lineWriter struct {
+	w       io.Writer
+	wrote   bool  // wrote is true if anything has been written.
+	partial bool  // partial is true if the last byte written wasn't a newline.
+	err     error // err is the error returned by w, if any.
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if n > 0 {
+		w.wrote = true
+		w.partial = p[n-1] != '\n'
+	}
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,286 @@
+package jlog
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHTTPSource(t *testing.T) {
+	testData := []struct {
+		name      string
+		responses []func(w http.ResponseWriter, req *http.Request)
+		reconnect bool
+		want      string
+		wantErr   string
+	}{
+		{
+			name: "plain",
+			responses: []func(w http.ResponseWriter, req *http.Request){
+				func(w http.ResponseWriter, req *http.Request) {
+					fmt.Fprintf(w, "{\"msg\":\"a\"}\n")
+					w.(http.Flusher).Flush()
+					fmt.Fprintf(w, "{\"msg\":\"b\"}\n")
+				},
+			},
+			want: "{\"msg\":\"a\"}\n{\"msg\":\"b\"}\n",
+		},
+		{
+			name: "retry after server error",
+			responses: []func(w http.ResponseWriter, req *http.Request){
+				func(w http.ResponseWriter, req *http.Request) {
+					http.Error(w, "try again", http.StatusServiceUnavailable)
+				},
+				func(w http.ResponseWriter, req *http.Request) {
+					fmt.Fprintf(w, "{\"msg\":\"a\"}\n")
+				},
+			},
+			want: "{\"msg\":\"a\"}\n",
+		},
+		{
+			name: "retry after dropped connection",
+			responses: []func(w http.ResponseWriter, req *http.Request){
+				func(w http.ResponseWriter, req *http.Request) {
+					// Promise more than we send, so the client sees an unexpected EOF.
+					w.Header().Set("Content-Length", "100")
+					fmt.Fprintf(w, "{\"msg\":\"a\"}\n{\"msg\"")
+				},
+				func(w http.ResponseWriter, req *http.Request) {
+					fmt.Fprintf(w, "{\"msg\":\"b\"}\n")
+				},
+			},
+			want: "{\"msg\":\"a\"}\n{\"msg\"\n{\"msg\":\"b\"}\n",
+		},
+		{
+			name:      "reconnect after normal end",
+			reconnect: true,
+			responses: []func(w http.ResponseWriter, req *http.Request){
+				func(w http.ResponseWriter, req *http.Request) {
+					fmt.Fprintf(w, "{\"msg\":\"a\"}\n")
+				},
+				func(w http.ResponseWriter, req *http.Request) {
+					fmt.Fprintf(w, "{\"msg\":\"b\"}\n")
+				},
+				func(w http.ResponseWriter, req *http.Request) {
+					w.WriteHeader(http.StatusNoContent)
+				},
+			},
+			want: "{\"msg\":\"a\"}\n{\"msg\":\"b\"}\n",
+		},
+		{
+			name: "client error",
+			responses: []func(w http.ResponseWriter, req *http.Request){
+				func(w http.ResponseWriter, req *http.Request) {
+					http.NotFound(w, req)
+				},
+			},
+			wantErr: "unexpected status 404 Not Found",
+		},
+		{
+			name: "give up",
+			responses: []func(w http.ResponseWriter, req *http.Request){
+				func(w http.ResponseWriter, req *http.Request) {
+					http.Error(w, "try again", http.StatusServiceUnavailable)
+				},
+				func(w http.ResponseWriter, req *http.Request) {
+					http.Error(w, "try again", http.StatusServiceUnavailable)
+				},
+				func(w http.ResponseWriter, req *http.Request) {
+					http.Error(w, "try again", http.StatusServiceUnavailable)
+				},
+			},
+			wantErr: "giving up after 3 attempts: unexpected status 503 Service Unavailable",
+		},
+		{
+			name: "server-sent events",
+			responses: []func(w http.ResponseWriter, req *http.Request){
+				func(w http.ResponseWriter, req *http.Request) {
+					w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+					fmt.Fprintf(w, ": comment\nid: 1\ndata: {\"msg\":\"a\"}\n\nevent: log\ndata:{\"msg\":\"b\"}\nid: 2\n\n")
+				},
+				func(w http.ResponseWriter, req *http.Request) {
+					if got, want := req.Header.Get("Last-Event-ID"), "2"; got != want {
+						http.Error(w, fmt.Sprintf("Last-Event-ID: got %q, want %q", got, want), http.StatusBadRequest)
+						return
+					}
+					w.Header().Set("Content-Type", "text/event-stream")
+					fmt.Fprintf(w, "data: {\"msg\":\"c\"}\n\n")
+				},
+				func(w http.ResponseWriter, req *http.Request) {
+					w.WriteHeader(http.StatusNoContent)
+				},
+			},
+			want: "{\"msg\":\"a\"}\n{\"msg\":\"b\"}\n{\"msg\":\"c\"}\n",
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			var mu sync.Mutex
+			n := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				mu.Lock()
+				i := n
+				n++
+				mu.Unlock()
+				if i >= len(test.responses) {
+					http.Error(w, "too many requests", http.StatusBadRequest)
+					return
+				}
+				test.responses[i](w, req)
+			}))
+			defer srv.Close()
+
+			s, err := NewHTTPSource(srv.URL, io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.MaxAttempts = 3
+			s.Backoff = time.Millisecond
+			s.MaxBackoff = time.Millisecond
+			s.Reconnect = test.reconnect
+			r := s.Open()
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			if err != nil {
+				if test.wantErr == "" || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("read: got error %v, want %q", err, test.wantErr)
+				}
+			} else if test.wantErr != "" {
+				t.Fatalf("read: expected error %q", test.wantErr)
+			}
+			if diff := cmp.Diff(string(got), test.want); diff != "" {
+				t.Errorf("logs:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLocalSource(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("socket", func(t *testing.T) {
+		sock := filepath.Join(dir, "sock")
+		l, err := net.Listen("unix", sock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			// Send two connections' worth of logs, then stop listening, so that
+			// reconnecting fails.
+			for _, logs := range []string{"{\"msg\":\"a\"}\n{\"msg\"", "{\"msg\":\"b\"}\n"} {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				io.WriteString(conn, logs) //nolint:errcheck
+				conn.Close()
+			}
+			l.Close()
+		}()
+
+		s, err := NewLocalSource("unix://"+sock, io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.MaxAttempts = 3
+		s.Backoff = time.Millisecond
+		s.MaxBackoff = time.Millisecond
+		s.Reconnect = true
+		r := s.Open()
+		defer r.Close()
+		got, err := io.ReadAll(r)
+		if err == nil || !strings.Contains(err.Error(), "giving up after 3 attempts: dial") {
+			t.Errorf("read: got error %v, want one about giving up", err)
+		}
+		if diff := cmp.Diff(string(got), "{\"msg\":\"a\"}\n{\"msg\"\n{\"msg\":\"b\"}\n"); diff != "" {
+			t.Errorf("logs:\n%s", diff)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		name := filepath.Join(dir, "logs")
+		if err := os.WriteFile(name, []byte("{\"msg\":\"a\"}\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		s, err := NewLocalSource("file://"+name, io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := s.Open()
+		defer r.Close()
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(string(got), "{\"msg\":\"a\"}\n"); diff != "" {
+			t.Errorf("logs:\n%s", diff)
+		}
+	})
+}
+
+func TestNewSource(t *testing.T) {
+	testData := []struct {
+		in      Input
+		want    Source
+		wantErr bool
+	}{
+		{
+			in:   Input{Source: "https://example.com/logs", SourceRetries: 3},
+			want: &HTTPSource{URL: "https://example.com/logs", Retry: Retry{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: 30 * time.Second}},
+		},
+		{
+			in:   Input{Source: "unix:///run/agent.sock", SourceReconnect: true},
+			want: &LocalSource{Path: "/run/agent.sock", Socket: true, Retry: Retry{Backoff: time.Second, MaxBackoff: 30 * time.Second, Reconnect: true}},
+		},
+		{
+			in:   Input{Source: "unix:agent.sock", SourceRetries: 10},
+			want: &LocalSource{Path: "agent.sock", Socket: true, Retry: Retry{MaxAttempts: 10, Backoff: time.Second, MaxBackoff: 30 * time.Second}},
+		},
+		{
+			in:   Input{Source: "file:///tmp/fifo", SourceRetries: 10},
+			want: &LocalSource{Path: "/tmp/fifo", Retry: Retry{MaxAttempts: 10, Backoff: time.Second, MaxBackoff: 30 * time.Second}},
+		},
+		{
+			in:      Input{Source: "unix://"},
+			wantErr: true,
+		},
+		{
+			in:      Input{Source: "https://example.com/logs", SourceRetries: -1},
+			wantErr: true,
+		},
+	}
+	for _, test := range testData {
+		got, err := NewSource(test.in, nil)
+		if err != nil {
+			if !test.wantErr {
+				t.Errorf("%q: unexpected error: %v", test.in.Source, err)
+			}
+			continue
+		}
+		if test.wantErr {
+			t.Errorf("%q: expected an error", test.in.Source)
+			continue
+		}
+		if diff := cmp.Diff(got, test.want, cmp.AllowUnexported(HTTPSource{})); diff != "" {
+			t.Errorf("%q: source:\n%s", test.in.Source, diff)
+		}
+	}
+}
+
+func TestNewHTTPSource(t *testing.T) {
+	for _, u := range []string{"ftp://example.com/logs", "example.com/logs", "http://%zz"} {
+		if _, err := NewHTTPSource(u, nil); err == nil {
+			t.Errorf("%q: expected an error", u)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+// Package tui implements an interactive, full-screen log viewer.  Logs are buffered as they are
+// read, and the user can scroll through them and edit the jq program and regex used to filter
+// them; every edit re-runs the normal parse/filter/format pipeline over the buffered input.
+package tui
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jrockway/json-logs/pkg/parse"
+	"golang.org/x/term"
+)
+
+// Filter is the initial filter configuration.  JQ and MatchRegex can be edited interactively;
+// NoMatchRegex and Scope stay fixed for the lifetime of the viewer.
+type Filter struct {
+	JQ           string
+	MatchRegex   string
+	NoMatchRegex string
+	Scope        parse.RegexpScope
+	JQOptions    *parse.JQOptions
+
+	HighlightMatches bool             // If true, lines matching MatchRegex are highlighted rather than kept.
+	MinLevel         parse.Level      // Lines less severe than this are removed.
+	LevelRanks       parse.LevelRanks // How levels compare to each other.
+}
+
+// editMode is the filter currently being edited at the prompt, if any.
+type editMode int
+
+const (
+	editNone editMode = iota
+	editRegex
+	editJQ
+)
+
+// viewer holds the state of the interactive viewer.  It knows nothing about the terminal, so that
+// it can be tested.
+type viewer struct {
+	ins    parse.InputSchema
+	outs   parse.OutputSchema
+	filter Filter
+
+	mu      sync.Mutex
+	input   *parse.LineBuffer // input holds every line read so far.
+	readErr error             // readErr is the error that ended reading, if not io.EOF.
+	eof     bool              // eof is true after all input has been read.
+	closed  bool              // closed is true after the input buffer has been released.
+
+	editing editMode // editing is the filter being edited.
+	edit    []rune   // edit is the text at the prompt.
+
+	lines   []string      // lines is the formatted output to display.
+	summary parse.Summary // summary is the summary of the last render.
+	status  string        // status is any error from the last render.
+	top     int           // top is the index of the first line on the screen.
+	follow  bool          // follow keeps the last line on the screen as new lines arrive.
+}
+
+func newViewer(ins *parse.InputSchema, outs *parse.OutputSchema, f Filter, bufferLimit int) *viewer {
+	return &viewer{
+		ins:    *ins,
+		outs:   *outs,
+		filter: f,
+		input:  &parse.LineBuffer{MemoryLimit: bufferLimit},
+		follow: true,
+	}
+}
+
+// add buffers a line of input.
+func (v *viewer) add(l []byte) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed || v.readErr != nil {
+		return
+	}
+	if err := v.input.Add(l); err != nil {
+		v.readErr = err
+	}
+}
+
+// read buffers the lines of r until it ends, calling changed after each one.  Lines that are too
+// long are handled by ReadLog when rendering, according to --on-long-line.
+func (v *viewer) read(r io.Reader, changed func()) {
+	err := parse.ReadLines(r, func(l []byte) {
+		v.add(l)
+		changed()
+	})
+	v.finish(err)
+	changed()
+}
+
+// close releases the input buffer.
+func (v *viewer) close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.closed = true
+	return v.input.Close()
+}
+
+// finish records that there is no more input.
+func (v *viewer) finish(err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.eof = true
+	if err != nil && !errors.Is(err, io.EOF) && v.readErr == nil {
+		v.readErr = err
+	}
+}
+
+// filterScheme builds a FilterScheme out of the current filters, or the ones being edited.
+func (v *viewer) filterScheme() (*parse.FilterScheme, error) {
+	jq, rx := v.filter.JQ, v.filter.MatchRegex
+	switch v.editing {
+	case editJQ:
+		jq = string(v.edit)
+	case editRegex:
+		rx = string(v.edit)
+	case editNone:
+	}
+	fs := &parse.FilterScheme{
+		Scope:            v.filter.Scope,
+		HighlightMatches: v.filter.HighlightMatches,
+		MinLevel:         v.filter.MinLevel,
+		LevelRanks:       v.filter.LevelRanks,
+	}
+	if err := fs.AddMatchRegex(rx); err != nil {
+		return nil, fmt.Errorf("regex: %v", err)
+	}
+	if err := fs.AddNoMatchRegex(v.filter.NoMatchRegex); err != nil {
+		return nil, fmt.Errorf("no-match regex: %v", err)
+	}
+	if err := fs.AddJQ(jq, v.filter.JQOptions); err != nil {
+		return nil, err // already has decent annotation
+	}
+	return fs, nil
+}
+
+// render re-runs the entire buffered input through the parse/filter/format pipeline.  If the
+// filters don't compile, the last good rendering is kept, and the problem is shown in the status
+// line.
+func (v *viewer) render() {
+	fs, err := v.filterScheme()
+	if err != nil {
+		v.status = err.Error()
+		return
+	}
+
+	// Both schemas are copied, because ReadLog modifies them (guessing the schema, and keeping
+	// state between lines).
+	ins := v.ins
+	ins.DeleteKeys = append([]string(nil), v.ins.DeleteKeys...)
+	ins.UpgradeKeys = append([]string(nil), v.ins.UpgradeKeys...)
+	outs := v.outs
+	var errs []string
+	outs.EmitErrorFn = func(msg string) { errs = append(errs, msg) }
+
+	v.mu.Lock()
+	in := v.input.Reader()
+	v.mu.Unlock()
+
+	out := new(bytes.Buffer)
+	v.summary, err = parse.ReadLog(in, out, &ins, &outs, fs)
+	v.lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(v.lines) == 1 && v.lines[0] == "" {
+		v.lines = nil
+	}
+	switch {
+	case err != nil:
+		v.status = err.Error()
+	case len(errs) > 0:
+		v.status = errs[len(errs)-1]
+	default:
+		v.status = ""
+	}
+}
+
+// scroll moves the view by n lines, given the number of lines that fit on the screen.
+func (v *viewer) scroll(n, height int) {
+	v.top += n
+	if max := len(v.lines) - height; v.top > max {
+		v.top = max
+	}
+	if v.top < 0 {
+		v.top = 0
+	}
+	v.follow = v.top+height >= len(v.lines)
+}
+
+// Keys that the viewer understands.  Escape sequences for the arrow keys are translated into
+// these by readKeys.
+const (
+	keyCtrlC     = 0x03
+	keyBackspace = 0x7f
+	keyCtrlH     = 0x08
+	keyEnter     = '\r'
+	keyEscape    = 0x1b
+	keyUp        = unicode.MaxRune + 1 + iota
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+)
+
+// handleKey handles a keypress, returning true if the viewer should exit.
+func (v *viewer) handleKey(k rune, height int) (quit bool) {
+	if k == keyCtrlC {
+		return true
+	}
+	if v.editing != editNone {
+		switch k {
+		case keyEnter:
+			if _, err := v.filterScheme(); err != nil {
+				// Don't let the user commit a filter that doesn't compile.
+				v.status = err.Error()
+				return false
+			}
+			if v.editing == editJQ {
+				v.filter.JQ = string(v.edit)
+			} else {
+				v.filter.MatchRegex = string(v.edit)
+			}
+			v.editing = editNone
+			v.edit = nil
+			v.render()
+		case keyEscape:
+			v.editing = editNone
+			v.edit = nil
+			v.render()
+		case keyBackspace, keyCtrlH:
+			if len(v.edit) > 0 {
+				v.edit = v.edit[:len(v.edit)-1]
+				v.render()
+			}
+		default:
+			if k <= unicode.MaxRune && unicode.IsPrint(k) {
+				v.edit = append(v.edit, k)
+				v.render()
+			}
+		}
+		if v.follow {
+			v.scroll(len(v.lines), height)
+		} else {
+			v.scroll(0, height)
+		}
+		return false
+	}
+
+	switch k {
+	case 'q':
+		return true
+	case '/':
+		v.editing = editRegex
+		v.edit = []rune(v.filter.MatchRegex)
+	case 'e', '|':
+		v.editing = editJQ
+		v.edit = []rune(v.filter.JQ)
+	case 'j', keyDown, keyEnter:
+		v.scroll(1, height)
+	case 'k', keyUp:
+		v.scroll(-1, height)
+	case ' ', 'f', keyPageDown:
+		v.scroll(height, height)
+	case 'b', keyPageUp:
+		v.scroll(-height, height)
+	case 'g', keyHome:
+		v.scroll(-len(v.lines), height)
+	case 'G', keyEnd:
+		v.scroll(len(v.lines), height)
+	}
+	return false
+}
+
+// statusLine returns the text of the bottom line of the screen.
+func (v *viewer) statusLine(height int) string {
+	if v.editing != editNone {
+		prompt := "regex> "
+		if v.editing == editJQ {
+			prompt = "jq> "
+		}
+		line := prompt + string(v.edit)
+		if v.status != "" {
+			line += "  [" + v.status + "]"
+		}
+		return line
+	}
+	v.mu.Lock()
+	eof := v.eof
+	readErr := v.readErr
+	v.mu.Unlock()
+
+	var parts []string
+	last := v.top + height
+	if last > len(v.lines) {
+		last = len(v.lines)
+	}
+	parts = append(parts, fmt.Sprintf("%d-%d/%d", v.top+1, last, len(v.lines)))
+	parts = append(parts, v.summary.String())
+	if !eof {
+		parts = append(parts, "reading")
+	}
+	if readErr != nil {
+		parts = append(parts, "read: "+readErr.Error())
+	}
+	if v.filter.MatchRegex != "" {
+		parts = append(parts, "regex: "+v.filter.MatchRegex)
+	}
+	if v.filter.JQ != "" {
+		parts = append(parts, "jq: "+v.filter.JQ)
+	}
+	if v.status != "" {
+		parts = append(parts, v.status)
+	}
+	parts = append(parts, "(/ regex, e jq, q quit)")
+	return strings.Join(parts, " | ")
+}
+
+// draw writes the visible part of the view to w.
+func (v *viewer) draw(w io.Writer, width, height int) {
+	buf := new(bytes.Buffer)
+	buf.WriteString("\x1b[H")
+	for i := 0; i < height; i++ {
+		if n := v.top + i; n < len(v.lines) {
+			buf.WriteString(v.lines[n])
+		}
+		buf.WriteString("\x1b[0m\x1b[K\r\n")
+	}
+	status := []rune(v.statusLine(height))
+	if len(status) > width {
+		status = status[:width]
+	}
+	buf.WriteString("\x1b[7m")
+	buf.WriteString(string(status))
+	buf.WriteString("\x1b[K\x1b[0m")
+	w.Write(buf.Bytes()) //nolint:errcheck
+}
+
+// readKeys reads keypresses from the terminal, translating escape sequences for the arrow and
+// paging keys.
+func readKeys(r io.Reader, keys chan<- rune) {
+	defer close(keys)
+	buf := make([]byte, 64)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		in := buf[:n]
+		if len(in) > 2 && in[0] == keyEscape && (in[1] == '[' || in[1] == 'O') {
+			switch string(in[2:]) {
+			case "A":
+				keys <- keyUp
+			case "B":
+				keys <- keyDown
+			case "5~":
+				keys <- keyPageUp
+			case "6~":
+				keys <- keyPageDown
+			case "H", "1~":
+				keys <- keyHome
+			case "F", "4~":
+				keys <- keyEnd
+			}
+			continue
+		}
+		for _, k := range string(in) {
+			keys <- k
+		}
+	}
+}
+
+// Run takes over the terminal and shows the logs read from r until the user quits.  The summary of
+// the final rendering is returned.  Input beyond bufferLimit bytes is buffered in a temporary file
+// rather than in memory; 0 means no limit.  r must not be the terminal that keys are read from;
+// since r is usually wrapped, the caller checks that.
+func Run(r io.Reader, ins *parse.InputSchema, outs *parse.OutputSchema, f Filter, bufferLimit int) (retSummary parse.Summary, retErr error) {
+	out := os.Stdout
+	if !term.IsTerminal(int(out.Fd())) {
+		return parse.Summary{}, errors.New("--tui requires that stdout is a terminal")
+	}
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return parse.Summary{}, fmt.Errorf("open terminal for keyboard input: %w", err)
+	}
+	defer tty.Close()
+	old, err := term.MakeRaw(int(tty.Fd()))
+	if err != nil {
+		return parse.Summary{}, fmt.Errorf("put terminal into raw mode: %w", err)
+	}
+	defer term.Restore(int(tty.Fd()), old) //nolint:errcheck
+
+	// Switch to the alternate screen, hide the cursor, and disable line wrapping; undo all that
+	// on the way out.
+	out.WriteString("\x1b[?1049h\x1b[?25l\x1b[?7l\x1b[2J")
+	defer out.WriteString("\x1b[?7h\x1b[?25h\x1b[?1049l")
+
+	v := newViewer(ins, outs, f, bufferLimit)
+	defer func() {
+		if err := v.close(); err != nil && retErr == nil {
+			retErr = fmt.Errorf("release input buffer: %w", err)
+		}
+	}()
+	dirty := make(chan struct{}, 1)
+	markDirty := func() {
+		select {
+		case dirty <- struct{}{}:
+		default:
+		}
+	}
+	go v.read(r, markDirty)
+	keys := make(chan rune)
+	go readKeys(tty, keys)
+
+	size := func() (int, int) {
+		width, height, err := term.GetSize(int(out.Fd()))
+		if err != nil || height < 2 {
+			return 80, 24 - 1
+		}
+		return width, height - 1
+	}
+
+	// New input is only rendered periodically, so that a fast producer doesn't cause a full
+	// re-render for every line.
+	tick := time.NewTicker(100 * time.Millisecond)
+	defer tick.Stop()
+	var needRender bool
+	width, height := size()
+	v.render()
+	v.draw(out, width, height)
+	for {
+		select {
+		case k, ok := <-keys:
+			if !ok {
+				return v.summary, nil
+			}
+			width, height = size()
+			if v.handleKey(k, height) {
+				return v.summary, nil
+			}
+		case <-dirty:
+			needRender = true
+			continue
+		case <-tick.C:
+			w, h := size()
+			if !needRender && w == width && h == height {
+				continue
+			}
+			width, height = w, h
+			if needRender {
+				v.render()
+				needRender = false
+			}
+			if v.follow {
+				v.scroll(len(v.lines), height)
+			}
+		}
+		v.draw(out, width, height)
+	}
+}
@@ -0,0 +1,279 @@
+package tui
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/jrockway/json-logs/pkg/parse"
+	"github.com/logrusorgru/aurora/v3"
+)
+
+func newTestViewer(t *testing.T, input ...string) *viewer {
+	t.Helper()
+	return newTestViewerWithLimit(t, 0, input...)
+}
+
+func newTestViewerWithLimit(t *testing.T, bufferLimit int, input ...string) *viewer {
+	t.Helper()
+	v := newViewer(
+		&parse.InputSchema{Strict: true},
+		&parse.OutputSchema{
+			Formatter: &parse.DefaultOutputFormatter{
+				Aurora:             aurora.NewAurora(false),
+				AbsoluteTimeFormat: time.RFC3339,
+				Zone:               time.UTC,
+			},
+		},
+		Filter{Scope: parse.RegexpScopeMessage},
+		bufferLimit,
+	)
+	t.Cleanup(func() {
+		if err := v.close(); err != nil {
+			t.Errorf("close: %v", err)
+		}
+	})
+	for _, l := range input {
+		v.add([]byte(l))
+	}
+	v.finish(nil)
+	v.render()
+	return v
+}
+
+func typeKeys(v *viewer, keys string) {
+	for _, k := range keys {
+		v.handleKey(k, 10)
+	}
+}
+
+var testInput = []string{
+	`{"ts":1,"level":"info","msg":"hello","a":1}`,
+	`{"ts":2,"level":"warn","msg":"goodbye","a":2}`,
+	`{"ts":3,"level":"info","msg":"hello again","a":3}`,
+}
+
+func TestFiltering(t *testing.T) {
+	testData := []struct {
+		name       string
+		keys       string
+		wantLines  []string
+		wantStatus string
+		wantFilter Filter
+	}{
+		{
+			name: "no filter",
+			wantLines: []string{
+				"INFO  1970-01-01T00:00:01Z hello a:1",
+				"WARN  1970-01-01T00:00:02Z goodbye a:2",
+				"INFO  1970-01-01T00:00:03Z hello again a:3",
+			},
+		},
+		{
+			name: "live regex",
+			keys: "/hello",
+			wantLines: []string{
+				"INFO  1970-01-01T00:00:01Z hello a:1",
+				"INFO  1970-01-01T00:00:03Z hello again a:3",
+			},
+		},
+		{
+			name: "committed regex",
+			keys: "/hello\r",
+			wantLines: []string{
+				"INFO  1970-01-01T00:00:01Z hello a:1",
+				"INFO  1970-01-01T00:00:03Z hello again a:3",
+			},
+			wantFilter: Filter{MatchRegex: "hello"},
+		},
+		{
+			name: "abandoned regex",
+			keys: "/hello\x1b",
+			wantLines: []string{
+				"INFO  1970-01-01T00:00:01Z hello a:1",
+				"WARN  1970-01-01T00:00:02Z goodbye a:2",
+				"INFO  1970-01-01T00:00:03Z hello again a:3",
+			},
+		},
+		{
+			name: "edited regex",
+			keys: "/hellox\x7f\x7f\x7f\x7f\x7f\x7fgood\r",
+			wantLines: []string{
+				"WARN  1970-01-01T00:00:02Z goodbye a:2",
+			},
+			wantFilter: Filter{MatchRegex: "good"},
+		},
+		{
+			name: "invalid regex keeps the last good rendering",
+			keys: "/good\r/(\r",
+			wantLines: []string{
+				"WARN  1970-01-01T00:00:02Z goodbye a:2",
+			},
+			wantStatus: "regex: compile regex: error parsing regexp: missing closing ): `good(`",
+			wantFilter: Filter{MatchRegex: "good"},
+		},
+		{
+			name: "jq",
+			keys: "eselect(.a>1) | {b:.a}\r",
+			wantLines: []string{
+				"WARN  1970-01-01T00:00:02Z goodbye b:2",
+				"INFO  1970-01-01T00:00:03Z hello again b:3",
+			},
+			wantFilter: Filter{JQ: "select(.a>1) | {b:.a}"},
+		},
+		{
+			name: "jq and regex",
+			keys: "eselect(.a>1)\r/hello\r",
+			wantLines: []string{
+				"INFO  1970-01-01T00:00:03Z hello again a:3",
+			},
+			wantFilter: Filter{JQ: "select(.a>1)", MatchRegex: "hello"},
+		},
+	}
+
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			v := newTestViewer(t, testInput...)
+			typeKeys(v, test.keys)
+			if diff := cmp.Diff(v.lines, test.wantLines, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("lines:\n%s", diff)
+			}
+			if got, want := v.status, test.wantStatus; got != want {
+				t.Errorf("status:\n  got: %v\n want: %v", got, want)
+			}
+			if diff := cmp.Diff(v.filter, test.wantFilter, cmpopts.IgnoreFields(Filter{}, "Scope")); diff != "" {
+				t.Errorf("filter:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSpilledInput(t *testing.T) {
+	v := newTestViewerWithLimit(t, 50, testInput...)
+	if got, want := v.input.Spilled(), 2; got != want {
+		t.Errorf("spilled lines:\n  got: %v\n want: %v", got, want)
+	}
+	typeKeys(v, "/hello\r")
+	want := []string{
+		"INFO  1970-01-01T00:00:01Z hello a:1",
+		"INFO  1970-01-01T00:00:03Z hello again a:3",
+	}
+	if diff := cmp.Diff(v.lines, want); diff != "" {
+		t.Errorf("lines:\n%s", diff)
+	}
+}
+
+func TestLongLines(t *testing.T) {
+	long := `{"msg":"` + strings.Repeat("x", parse.LineBufferSize) + `"}`
+	input := testInput[0] + "\n" + long + "\n" + testInput[1] + "\n"
+	testData := []struct {
+		name       string
+		action     parse.LongLineAction
+		wantLines  []string
+		wantStatus string
+	}{
+		{
+			name:   "skip",
+			action: parse.LongLineSkip,
+			wantLines: []string{
+				"INFO  1970-01-01T00:00:01Z hello a:1",
+				"WARN  1970-01-01T00:00:02Z goodbye a:2",
+			},
+			wantStatus: "line longer than 1048576 bytes; skipped",
+		},
+		{
+			name:   "truncate",
+			action: parse.LongLineTruncate,
+			wantLines: []string{
+				"INFO  1970-01-01T00:00:01Z hello a:1",
+				long[:parse.LineBufferSize] + " (truncated)",
+				"WARN  1970-01-01T00:00:02Z goodbye a:2",
+			},
+			wantStatus: "line longer than 1048576 bytes; truncated",
+		},
+		{
+			name:   "error",
+			action: parse.LongLineError,
+			wantLines: []string{
+				"INFO  1970-01-01T00:00:01Z hello a:1",
+			},
+			wantStatus: "line longer than 1048576 bytes: bufio.Scanner: token too long",
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			v := newTestViewer(t)
+			v.ins.LongLines = test.action
+			v.read(strings.NewReader(input), func() {})
+			if v.readErr != nil {
+				t.Fatalf("read: %v", v.readErr)
+			}
+			if got, want := v.input.Len(), 3; got != want {
+				t.Errorf("buffered lines:\n  got: %v\n want: %v", got, want)
+			}
+			v.render()
+			if diff := cmp.Diff(v.lines, test.wantLines); diff != "" {
+				t.Errorf("lines:\n%s", diff)
+			}
+			if !strings.Contains(v.status, test.wantStatus) {
+				t.Errorf("status:\n  got: %v\n want: %v", v.status, test.wantStatus)
+			}
+		})
+	}
+}
+
+func TestScrolling(t *testing.T) {
+	var input []string
+	for i := 0; i < 100; i++ {
+		input = append(input, `{"ts":1,"level":"info","msg":"hello"}`)
+	}
+	v := newTestViewer(t, input...)
+	v.scroll(len(v.lines), 10)
+	if got, want := v.top, 90; got != want {
+		t.Errorf("top after scrolling to the end:\n  got: %v\n want: %v", got, want)
+	}
+	if !v.follow {
+		t.Error("expected to be following after scrolling to the end")
+	}
+	typeKeys(v, "kk")
+	if got, want := v.top, 88; got != want {
+		t.Errorf("top after scrolling up:\n  got: %v\n want: %v", got, want)
+	}
+	if v.follow {
+		t.Error("expected to not be following after scrolling up")
+	}
+	typeKeys(v, "gk")
+	if got, want := v.top, 0; got != want {
+		t.Errorf("top after scrolling past the start:\n  got: %v\n want: %v", got, want)
+	}
+	typeKeys(v, " ")
+	if got, want := v.top, 10; got != want {
+		t.Errorf("top after paging down:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := v.statusLine(10), "11-20/100"; !strings.HasPrefix(got, want) {
+		t.Errorf("status line:\n  got: %v\n want prefix: %v", got, want)
+	}
+	out := new(bytes.Buffer)
+	v.draw(out, 80, 10)
+	if got, want := strings.Count(out.String(), "hello"), 10; got != want {
+		t.Errorf("lines drawn:\n  got: %v\n want: %v", got, want)
+	}
+	if quit := v.handleKey('q', 10); !quit {
+		t.Error("expected q to quit")
+	}
+}
+
+func TestReadKeys(t *testing.T) {
+	keys := make(chan rune)
+	go readKeys(strings.NewReader("\x1b[A"), keys)
+	var got []rune
+	for k := range keys {
+		got = append(got, k)
+	}
+	if diff := cmp.Diff(got, []rune{keyUp}); diff != "" {
+		t.Errorf("keys:\n%s", diff)
+	}
+}
@@ -5,18 +5,20 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/signal"
+	"os/exec"
 	"runtime/debug"
 	"runtime/pprof"
 	"strings"
-	"sync/atomic"
 	"syscall"
 	_ "time/tzdata"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/jrockway/json-logs/cmd/internal/jlog"
+	"github.com/jrockway/json-logs/cmd/internal/tui"
+	"github.com/jrockway/json-logs/pkg/interruptible"
 	"github.com/jrockway/json-logs/pkg/parse"
 	"github.com/mattn/go-colorable"
+	"github.com/mattn/go-isatty"
 )
 
 var (
@@ -37,6 +39,34 @@ func printVersion(w io.Writer) {
 	}
 }
 
+// startPager starts $PAGER, or less -R, and returns a writer that sends it input.  Wait closes the
+// writer and waits for the pager to exit.
+func startPager() (io.Writer, func() error, error) {
+	args := strings.Fields(os.Getenv("PAGER"))
+	if len(args) == 0 {
+		args = []string{"less", "-R"}
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("create pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("start %v: %w", strings.Join(args, " "), err)
+	}
+	return w, func() error {
+		if err := w.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+			return fmt.Errorf("close pipe: %w", err)
+		}
+		if err := cmd.Wait(); err != nil {
+			return fmt.Errorf("wait: %w", err)
+		}
+		return nil
+	}, nil
+}
+
 func main() {
 	var gen jlog.General
 	var in jlog.Input
@@ -89,6 +119,87 @@ func main() {
 		os.Exit(1)
 	}
 
+	var output io.Writer = colorable.NewColorableStdout()
+	var outputFile *os.File
+	if out.OutputFile != "" {
+		outputFile, err = os.Create(out.OutputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "problem opening output file: %v\n", err)
+			os.Exit(1)
+		}
+		output = outputFile
+	}
+	var waitPager func() error
+	if out.Pager && !out.NoPager && out.OutputFile == "" && !gen.TUI && isatty.IsTerminal(os.Stdout.Fd()) {
+		w, wait, err := startPager()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "problem starting pager; writing directly to stdout: %v\n", err)
+		} else {
+			output, waitPager = w, wait
+		}
+	}
+
+	// Interrupting stdin lets the lines read so far be flushed and summarized.  SIGPIPE is
+	// intercepted so that writing to a closed stdout returns EPIPE instead of killing us.
+	var src io.Reader = os.Stdin
+	srcLabel := "stdin"
+	if in.Source != "" {
+		s, err := jlog.NewSource(in, os.Stderr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "--source: %v\n", err)
+			os.Exit(1)
+		}
+		src, srcLabel = s.Open(), "source"
+	}
+	stdin := interruptible.NewReader(src, os.Interrupt, syscall.SIGPIPE)
+	input := jlog.NewInputReader(stdin, in)
+	if len(in.InputFDs) > 0 {
+		var sources []parse.MergeSource
+		if in.Source != "" || !isatty.IsTerminal(os.Stdin.Fd()) {
+			sources = append(sources, parse.MergeSource{Label: srcLabel, Reader: input})
+		}
+		for _, fd := range in.InputFDs {
+			if fd < 3 {
+				fmt.Fprintf(os.Stderr, "--input-fd %d: only file descriptors after stderr (2) can be used\n", fd)
+				os.Exit(1)
+			}
+			label := fmt.Sprintf("fd%d", fd)
+			f := os.NewFile(uintptr(fd), label)
+			if f == nil {
+				fmt.Fprintf(os.Stderr, "--input-fd %d: invalid file descriptor\n", fd)
+				os.Exit(1)
+			}
+			sources = append(sources, parse.MergeSource{Label: label, Reader: jlog.NewInputReader(f, in)})
+		}
+		input = parse.MergeByTime(ins, "input", sources)
+	}
+
+	if gen.TUI {
+		// Keys are read from the terminal, so the logs have to come from somewhere else.
+		if in.Source == "" && len(in.InputFDs) == 0 && isatty.IsTerminal(os.Stdin.Fd()) {
+			fmt.Fprintln(os.Stderr, "tui: --tui requires logs to be piped to stdin, or read with --source or --input-fd")
+			os.Exit(1)
+		}
+		summary, err := tui.Run(input, ins, outs, tui.Filter{
+			JQ:           gen.JQ,
+			MatchRegex:   gen.MatchRegex,
+			NoMatchRegex: gen.NoMatchRegex,
+			Scope:        fsch.Scope,
+			JQOptions:    &parse.JQOptions{SearchPath: gen.JQSearchPath},
+
+			HighlightMatches: fsch.HighlightMatches,
+			MinLevel:         fsch.MinLevel,
+			LevelRanks:       fsch.LevelRanks,
+		}, gen.BufferLimit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "tui: %v\n", err)
+			jlog.PrintPanicStack(gen, err, os.Stderr)
+			os.Exit(1)
+		}
+		jlog.PrintOutputSummary(out, summary, os.Stderr)
+		os.Exit(0)
+	}
+
 	var f *os.File
 	if gen.Profile != "" {
 		var err error
@@ -103,21 +214,32 @@ func main() {
 		}
 	}
 
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGPIPE)
-	var nSignals int32
-	go func() {
-		c := <-sigCh
-		atomic.AddInt32(&nSignals, 1)
-		fmt.Fprintf(os.Stderr, "signal: %v\n", c.String())
-		os.Stdin.Close()
-		signal.Stop(sigCh)
-	}()
-
-	summary, err := parse.ReadLog(os.Stdin, colorable.NewColorableStdout(), ins, outs, fsch)
-	if err != nil {
-		if signals := atomic.LoadInt32(&nSignals); signals < 1 || !strings.Contains(err.Error(), "file already closed") {
-			outs.EmitError(err.Error())
+	summary, err := parse.ReadLog(input, output, ins, outs, fsch)
+	if waitPager != nil {
+		// Quitting the pager before reading everything is how a pager is normally used, not an
+		// error.
+		if errors.Is(err, syscall.EPIPE) {
+			err = nil
+		}
+		if perr := waitPager(); perr != nil {
+			fmt.Fprintf(os.Stderr, "pager: %v\n", perr)
+			if err == nil {
+				err = perr
+			}
+		}
+	}
+	if errors.Is(err, interruptible.ErrInterrupted) {
+		fmt.Fprintf(os.Stderr, "signal: %v\n", stdin.Signal())
+	} else if err != nil {
+		outs.EmitError(err.Error())
+		jlog.PrintPanicStack(gen, err, os.Stderr)
+	}
+	if outputFile != nil {
+		if cerr := outputFile.Close(); cerr != nil {
+			fmt.Fprintf(os.Stderr, "problem closing output file: %v\n", cerr)
+			if err == nil {
+				err = cerr
+			}
 		}
 	}
 	jlog.PrintOutputSummary(out, summary, os.Stderr)
@@ -13,6 +13,7 @@ require (
 	github.com/mattn/go-isatty v0.0.14
 	github.com/sirupsen/logrus v1.6.0
 	go.uber.org/zap v1.15.0
+	golang.org/x/term v0.0.0-20220526004731-065cf7ba2467
 )
 
 require (
@@ -201,6 +201,45 @@ func TestLoggers(t *testing.T) {
 				buf.WriteString(`{"level":30,"msg":"line 1","time":"2021-03-09T17:44:26.203Z","v":0}
 {"level":30,"string":"value","int":42,"object":{"foo":"bar"},"msg":"line 2","time":"2021-03-09T17:44:26.204Z","v":0}
 {"level":50,"error":"whoa","msg":"line 3","time":"2021-03-09T17:44:26.204Z","v":0}
+`)
+			},
+		},
+		{
+			name: "ecs",
+			ins: &parse.InputSchema{
+				LevelKey:    "log.level",
+				MessageKey:  "message",
+				TimeKey:     "@timestamp",
+				LevelFormat: parse.DefaultLevelParser,
+				TimeFormat:  parse.DefaultTimeParser,
+				Strict:      true,
+				DeleteKeys:  []string{"ecs.version"},
+			},
+			f: func(buf *bytes.Buffer) {
+				// A sample document in the Elastic Common Schema format, as written by
+				// the ecs-logging libraries, with dotted keys.
+				buf.WriteString(`{"log.level":"info","@timestamp":"2021-03-09T17:44:26.203Z","message":"line 1","ecs.version":"1.6.0"}
+{"log.level":"info","@timestamp":"2021-03-09T17:44:26.204Z","message":"line 2","string":"value","int":42,"object":{"foo":"bar"},"ecs.version":"1.6.0"}
+{"log.level":"error","@timestamp":"2021-03-09T17:44:26.204Z","message":"line 3","error":"whoa","ecs.version":"1.6.0"}
+`)
+			},
+		},
+		{
+			name: "ecs/nested",
+			ins: &parse.InputSchema{
+				LevelKey:    "log",
+				LevelSubkey: "level",
+				MessageKey:  "message",
+				TimeKey:     "@timestamp",
+				LevelFormat: parse.DefaultLevelParser,
+				TimeFormat:  parse.DefaultTimeParser,
+				Strict:      true,
+			},
+			f: func(buf *bytes.Buffer) {
+				// The same, with nested keys, as found in Elasticsearch documents.
+				buf.WriteString(`{"log":{"level":"info"},"@timestamp":"2021-03-09T17:44:26.203Z","message":"line 1"}
+{"log":{"level":"info"},"@timestamp":"2021-03-09T17:44:26.204Z","message":"line 2","string":"value","int":42,"object":{"foo":"bar"}}
+{"log":{"level":"error"},"@timestamp":"2021-03-09T17:44:26.204Z","message":"line 3","error":"whoa"}
 `)
 			},
 		},
@@ -0,0 +1,122 @@
+// Package interruptible provides an io.Reader whose reads can be abandoned when a signal arrives,
+// for inputs like terminals and pipes where a read can block forever.
+package interruptible
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+)
+
+// ErrInterrupted is returned by Reader.Read once a signal has been received.
+var ErrInterrupted = errors.New("interrupted")
+
+// Reader is an io.Reader that stops reading when one of a set of signals is received.  Reads from
+// the underlying reader happen in a separate goroutine, so that a blocked read can be abandoned;
+// once a signal arrives, that read's result is discarded, and this and every later call to Read
+// returns an error wrapping ErrInterrupted.  After the first signal, the signals are no longer
+// intercepted, so a second Ctrl-C kills the program as usual.  A Reader is not safe for concurrent
+// use.
+type Reader struct {
+	// Drain, if set, keeps the data from a read that was in progress when the signal arrived,
+	// instead of discarding it.  The read that was interrupted still returns ErrInterrupted, but
+	// the next call to Read waits for the abandoned read to finish and returns what it read,
+	// across as many calls as it takes; after that, Read returns ErrInterrupted again.  This
+	// avoids losing data when reading from a file, where reads finish promptly.  For terminals
+	// and pipes, where the abandoned read might never finish, the next call to Read can block
+	// forever, so only set Drain for inputs that can't block.  Callers that stop at the first
+	// error, like bufio.Scanner, never make the next call and never see the data.
+	Drain bool
+
+	r       io.Reader
+	sigCh   <-chan os.Signal
+	stop    func()
+	sig     os.Signal   // sig is the signal that interrupted reading, if any.
+	buf     []byte      // buf is read into by the goroutine, and copied out of by Read.
+	results chan result // results receives the result of the goroutine's read.
+
+	inFlight bool   // inFlight is true if an interrupted read's result is being waited for.
+	drained  []byte // drained is the part of the interrupted read's data not yet returned.
+}
+
+type result struct {
+	n   int
+	err error
+}
+
+// NewReader returns a Reader that reads from r until one of sigs is received.
+func NewReader(r io.Reader, sigs ...os.Signal) *Reader {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	return newReader(r, ch, func() { signal.Stop(ch) })
+}
+
+func newReader(r io.Reader, sigCh <-chan os.Signal, stop func()) *Reader {
+	return &Reader{
+		r:       r,
+		sigCh:   sigCh,
+		stop:    stop,
+		results: make(chan result, 1),
+	}
+}
+
+// Signal returns the signal that interrupted reading, or nil if reading hasn't been interrupted.
+func (r *Reader) Signal() os.Signal {
+	return r.sig
+}
+
+func (r *Reader) interrupt(sig os.Signal, inFlight bool) (int, error) {
+	r.sig = sig
+	r.inFlight = inFlight && r.Drain
+	r.stop()
+	return 0, r.err()
+}
+
+// drain returns data from the read that was interrupted, if Drain is set.
+func (r *Reader) drain(p []byte) (int, error) {
+	if r.inFlight {
+		res := <-r.results
+		r.inFlight = false
+		r.drained = r.buf[:res.n]
+	}
+	if len(r.drained) == 0 {
+		return 0, r.err()
+	}
+	n := copy(p, r.drained)
+	r.drained = r.drained[n:]
+	return n, nil
+}
+
+func (r *Reader) err() error {
+	return fmt.Errorf("%w by signal: %v", ErrInterrupted, r.sig)
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.sig != nil {
+		return r.drain(p)
+	}
+	select {
+	case sig := <-r.sigCh:
+		return r.interrupt(sig, false)
+	default:
+	}
+	if cap(r.buf) < len(p) {
+		r.buf = make([]byte, len(p))
+	}
+	// The goroutine has its own buffer, because if the read is interrupted, it will still be
+	// writing to it after we return, when the caller may be using p for something else.
+	buf := r.buf[:len(p)]
+	go func() {
+		n, err := r.r.Read(buf)
+		r.results <- result{n: n, err: err}
+	}()
+	select {
+	case res := <-r.results:
+		return copy(p, buf[:res.n]), res.err
+	case sig := <-r.sigCh:
+		return r.interrupt(sig, true)
+	}
+}
@@ -0,0 +1,183 @@
+package interruptible
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRead(t *testing.T) {
+	r := newReader(iotest.OneByteReader(strings.NewReader("hello, world")), make(chan os.Signal), func() {})
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "hello, world"; string(got) != want {
+		t.Errorf("read:\n  got: %q\n want: %q", got, want)
+	}
+	if r.Signal() != nil {
+		t.Errorf("signal: got %v, want nil", r.Signal())
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	sigCh := make(chan os.Signal, 1)
+	var stopped bool
+	r := newReader(pr, sigCh, func() { stopped = true })
+
+	errCh := make(chan error)
+	go func() {
+		_, err := r.Read(make([]byte, 10))
+		errCh <- err
+	}()
+	// Nothing is ever written to the pipe, so the read can only end with the signal.
+	sigCh <- os.Interrupt
+	if err := <-errCh; !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("blocked read: got %v, want ErrInterrupted", err)
+	}
+	if !stopped {
+		t.Error("signals should no longer be intercepted after an interrupt")
+	}
+	if got, want := r.Signal(), os.Interrupt; got != want {
+		t.Errorf("signal: got %v, want %v", got, want)
+	}
+	if got, want := r.err().Error(), "interrupted by signal: interrupt"; got != want {
+		t.Errorf("error:\n  got: %v\n want: %v", got, want)
+	}
+
+	// Later reads are interrupted too, even if there is input waiting.
+	go pw.Write([]byte("late")) //nolint:errcheck
+	if _, err := r.Read(make([]byte, 10)); !errors.Is(err, ErrInterrupted) {
+		t.Errorf("read after interrupt: got %v, want ErrInterrupted", err)
+	}
+}
+
+func TestInterruptBeforeRead(t *testing.T) {
+	sigCh := make(chan os.Signal, 1)
+	sigCh <- os.Interrupt
+	r := newReader(strings.NewReader("hello"), sigCh, func() {})
+	if n, err := r.Read(make([]byte, 10)); n != 0 || !errors.Is(err, ErrInterrupted) {
+		t.Errorf("read: got (%v, %v), want (0, ErrInterrupted)", n, err)
+	}
+}
+
+// slowReader blocks in Read until release is closed, then fills the buffer with 'x'.
+type slowReader struct {
+	started, release, done chan struct{}
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	close(r.started)
+	<-r.release
+	defer close(r.done)
+	for i := range p {
+		p[i] = 'x'
+	}
+	return len(p), nil
+}
+
+// TestInterruptSlowRead checks that a read that finishes after being interrupted doesn't touch
+// memory that the caller owns.  Run it with -race.
+func TestInterruptSlowRead(t *testing.T) {
+	slow := &slowReader{started: make(chan struct{}), release: make(chan struct{}), done: make(chan struct{})}
+	sigCh := make(chan os.Signal, 1)
+	r := newReader(slow, sigCh, func() {})
+
+	p := make([]byte, 10)
+	errCh := make(chan error)
+	go func() {
+		_, err := r.Read(p)
+		errCh <- err
+	}()
+	<-slow.started
+	sigCh <- os.Interrupt
+	if err := <-errCh; !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("read: got %v, want ErrInterrupted", err)
+	}
+
+	// The caller is free to reuse p as soon as Read returns, while the abandoned read finishes.
+	copy(p, "0123456789")
+	close(slow.release)
+	<-slow.done
+	if got, want := string(p), "0123456789"; got != want {
+		t.Errorf("buffer after interrupted read finished:\n  got: %q\n want: %q", got, want)
+	}
+	if _, err := r.Read(p); !errors.Is(err, ErrInterrupted) {
+		t.Errorf("read after interrupt: got %v, want ErrInterrupted", err)
+	}
+}
+
+// partialReader returns at most 3 bytes from each read, after blocking until release is closed.
+type partialReader struct {
+	started, release chan struct{}
+	data             string
+}
+
+func (r *partialReader) Read(p []byte) (int, error) {
+	close(r.started)
+	<-r.release
+	if len(p) > 3 {
+		p = p[:3]
+	}
+	return copy(p, r.data), nil
+}
+
+func TestDrain(t *testing.T) {
+	testData := []struct {
+		name  string
+		drain bool
+		want  []string
+	}{
+		{
+			name: "discard",
+		},
+		{
+			name:  "drain",
+			drain: true,
+			want:  []string{"ab", "c"},
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			pr := &partialReader{started: make(chan struct{}), release: make(chan struct{}), data: "abcdef"}
+			sigCh := make(chan os.Signal, 1)
+			r := newReader(pr, sigCh, func() {})
+			r.Drain = test.drain
+
+			errCh := make(chan error)
+			go func() {
+				_, err := r.Read(make([]byte, 10))
+				errCh <- err
+			}()
+			<-pr.started
+			sigCh <- os.Interrupt
+			if err := <-errCh; !errors.Is(err, ErrInterrupted) {
+				t.Fatalf("interrupted read: got %v, want ErrInterrupted", err)
+			}
+			close(pr.release)
+
+			var got []string
+			for {
+				p := make([]byte, 2)
+				n, err := r.Read(p)
+				if err != nil {
+					if !errors.Is(err, ErrInterrupted) {
+						t.Fatalf("read: got %v, want ErrInterrupted", err)
+					}
+					break
+				}
+				got = append(got, string(p[:n]))
+			}
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("reads after interrupt:\n%s", diff)
+			}
+		})
+	}
+}
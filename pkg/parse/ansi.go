@@ -0,0 +1,36 @@
+package parse
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ansiRegexp matches ANSI escape sequences: CSI sequences like the color code "\x1b[31m", OSC
+// sequences like the hyperlink "\x1b]8;;http://example.com\x1b\\", and two-byte escapes.
+var ansiRegexp = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// stripANSI removes ANSI escape sequences from str.
+func stripANSI(str string) string {
+	if !strings.Contains(str, "\x1b") {
+		return str
+	}
+	return ansiRegexp.ReplaceAllString(str, "")
+}
+
+// stripANSIValue removes ANSI escape sequences from any strings in v, which is a value produced
+// by json.Unmarshal.  Objects and arrays are modified in place.
+func stripANSIValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case string:
+		return stripANSI(x)
+	case map[string]interface{}:
+		for k, val := range x {
+			x[k] = stripANSIValue(val)
+		}
+	case []interface{}:
+		for i, val := range x {
+			x[i] = stripANSIValue(val)
+		}
+	}
+	return v
+}
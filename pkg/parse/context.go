@@ -1,5 +1,7 @@
 package parse
 
+import "strconv"
+
 type context struct {
 	Before, After int
 
@@ -17,14 +19,21 @@ func (c *context) Print(msg *line, selected bool) []*line {
 		var result []*line
 		c.printAfter = c.After
 
+		// skipped is the number of lines between the last line printed and the first line
+		// being printed now.
+		skipped := c.line - len(c.lines) - c.lastPrint - 1
 		if true &&
 			// suppress separator if it's the first line of output
 			c.lastPrint != 0 &&
 			// suppress separator if we are no-op context
 			(c.After != 0 || c.Before != 0) &&
 			// suppress separator if end of after is contiguous with the start of before
-			c.line-len(c.lines)-c.lastPrint > 1 {
-			result = append(result, &line{isSeparator: true})
+			skipped > 0 {
+			first := msg
+			if len(c.lines) > 0 {
+				first = &c.lines[0]
+			}
+			result = append(result, &line{isSeparator: true, skipped: skipped, number: first.number - skipped})
 		}
 		for _, l := range c.lines {
 			line := l
@@ -44,10 +53,27 @@ func (c *context) Print(msg *line, selected bool) []*line {
 
 	if c.Before > 0 {
 		// TODO: allocate full capacity here
-		c.lines = append(c.lines, *msg) // shallow copy
+		// The line is reused for the next line of input, so keep a copy.
+		c.lines = append(c.lines, msg.clone())
 		if len(c.lines) > c.Before {
 			c.lines = c.lines[1:]
 		}
 	}
 	return nil
 }
+
+// linesSkipped describes a number of skipped lines for a separator, like "1,240 lines".
+func linesSkipped(n int) string {
+	if n == 1 {
+		return "1 line"
+	}
+	digits := strconv.Itoa(n)
+	var result []byte
+	for i := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			result = append(result, ',')
+		}
+		result = append(result, digits[i])
+	}
+	return string(result) + " lines"
+}
@@ -2,6 +2,7 @@ package parse
 
 import (
 	"bytes"
+	"fmt"
 	"regexp"
 	"strings"
 	"testing"
@@ -88,7 +89,7 @@ func TestContext(t *testing.T) {
 			after:  1,
 			match:  regexp.MustCompile(`^5|9$`),
 			input:  []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"},
-			want:   []string{"4", "5", "6", "---", "8", "9", "10"},
+			want:   []string{"4", "5", "6", "--- 1", "8", "9", "10"},
 		},
 		{
 			name:   "basic context, contiguous match regions",
@@ -104,7 +105,7 @@ func TestContext(t *testing.T) {
 			after:  2,
 			match:  regexp.MustCompile(`^2|8$`),
 			input:  []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"},
-			want:   []string{"2", "3", "4", "---", "8", "9", "10"},
+			want:   []string{"2", "3", "4", "--- 3", "8", "9", "10"},
 		},
 		{
 			name:   "after context, contiguous match regions",
@@ -120,7 +121,7 @@ func TestContext(t *testing.T) {
 			after:  0,
 			match:  regexp.MustCompile(`^4|9$`),
 			input:  []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"},
-			want:   []string{"2", "3", "4", "---", "7", "8", "9"},
+			want:   []string{"2", "3", "4", "--- 2", "7", "8", "9"},
 		},
 		{
 			name:   "before context, contiguous match regions",
@@ -147,7 +148,7 @@ func TestContext(t *testing.T) {
 				toEmit := ctx.Print(&l, selected)
 				for _, x := range toEmit {
 					if x.isSeparator {
-						out.WriteString("---")
+						fmt.Fprintf(out, "--- %d", x.skipped)
 					} else {
 						out.WriteString(x.msg)
 					}
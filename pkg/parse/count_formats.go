@@ -0,0 +1,123 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CountNone is the bucket that CountFormatter counts lines lacking the field in.
+const CountNone = "(none)"
+
+// CountFormatter tallies lines by the value of a field instead of displaying them, like "SELECT
+// field, COUNT(*) ... GROUP BY field".  Once the input has been read, it prints a single line like
+// "200: 412, 404: 33, 500: 5", most common value first.  Strings are counted as-is; other values
+// are counted by their JSON representation, so the number 200 and the string "200" share a
+// bucket.
+//
+// With more than one field, lines are counted by the combination of the fields' values, and each
+// combination is printed on its own line, like "   412  route=/api status=200".
+type CountFormatter struct {
+	Field  string   // Field is the name of the field to count the values of.
+	Fields []string // Fields, if set, are counted together, instead of Field.
+
+	counts map[string]int
+}
+
+// The individual parts of a line are never displayed.
+func (f *CountFormatter) FormatTime(s *State, t time.Time, w *bytes.Buffer)                   {}
+func (f *CountFormatter) FormatLevel(s *State, lvl Level, w *bytes.Buffer)                    {}
+func (f *CountFormatter) FormatMessage(s *State, msg string, highlight bool, w *bytes.Buffer) {}
+func (f *CountFormatter) FormatField(s *State, k string, v interface{}, w *bytes.Buffer)      {}
+
+// countKey returns the bucket that a value is counted in.
+func countKey(v interface{}) string {
+	if str, ok := v.(string); ok {
+		return str
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(j)
+}
+
+// fields returns the fields being counted.
+func (f *CountFormatter) fields() []string {
+	if len(f.Fields) > 0 {
+		return f.Fields
+	}
+	return []string{f.Field}
+}
+
+// lineKey returns the bucket that a line is counted in.
+func (f *CountFormatter) lineKey(l *line) string {
+	fields := f.fields()
+	if len(fields) == 1 {
+		if v, ok := l.fields[fields[0]]; ok {
+			return countKey(v)
+		}
+		return CountNone
+	}
+	key := new(strings.Builder)
+	for i, field := range fields {
+		if i > 0 {
+			key.WriteString(" ")
+		}
+		value := CountNone
+		if v, ok := l.fields[field]; ok {
+			value = countKey(v)
+		}
+		key.WriteString(field)
+		key.WriteString("=")
+		key.WriteString(value)
+	}
+	return key.String()
+}
+
+func (f *CountFormatter) formatLine(s *OutputSchema, l *line, w *bytes.Buffer) {
+	if f.counts == nil {
+		f.counts = make(map[string]int)
+	}
+	f.counts[f.lineKey(l)]++
+}
+
+// Counts returns the number of lines seen with each value of the field.  With more than one field,
+// the keys look like "route=/api status=200".
+func (f *CountFormatter) Counts() map[string]int {
+	return f.counts
+}
+
+func (f *CountFormatter) finish(s *OutputSchema, w *bytes.Buffer) {
+	if len(f.counts) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(f.counts))
+	for k := range f.counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if a, b := f.counts[keys[i]], f.counts[keys[j]]; a != b {
+			return a > b
+		}
+		return keys[i] < keys[j]
+	})
+	if len(f.fields()) > 1 {
+		width := len(strconv.Itoa(f.counts[keys[0]]))
+		for _, k := range keys {
+			fmt.Fprintf(w, "%*d  %s\n", width, f.counts[k], k)
+		}
+		return
+	}
+	for i, k := range keys {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		fmt.Fprintf(w, "%s: %d", k, f.counts[k])
+	}
+	w.WriteString("\n")
+}
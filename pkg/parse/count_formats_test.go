@@ -0,0 +1,100 @@
+package parse
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCountFormatter(t *testing.T) {
+	testData := []struct {
+		name       string
+		field      string
+		fields     []string
+		jq         string
+		input      []string
+		want       string
+		wantCounts map[string]int
+	}{
+		{
+			name:  "empty",
+			field: "status",
+		},
+		{
+			name:  "sorted by count, then value",
+			field: "status",
+			input: []string{
+				`{"status":404}`,
+				`{"status":200}`,
+				`{"status":500}`,
+				`{"status":200}`,
+				`{"status":"200"}`,
+				`{"status":404}`,
+			},
+			want:       "200: 3, 404: 2, 500: 1\n",
+			wantCounts: map[string]int{"200": 3, "404": 2, "500": 1},
+		},
+		{
+			name:  "missing field",
+			field: "status",
+			input: []string{
+				`{"status":200}`,
+				`{"msg":"no status"}`,
+				`{"status":null}`,
+				`{"status":{"code":200}}`,
+			},
+			want:       `(none): 1, 200: 1, null: 1, {"code":200}: 1` + "\n",
+			wantCounts: map[string]int{"(none)": 1, "200": 1, "null": 1, `{"code":200}`: 1},
+		},
+		{
+			name:  "filtered lines are not counted",
+			field: "status",
+			jq:    "select(.status < 500)",
+			input: []string{
+				`{"status":200}`,
+				`{"status":500}`,
+			},
+			want:       "200: 1\n",
+			wantCounts: map[string]int{"200": 1},
+		},
+		{
+			name:   "several fields",
+			fields: []string{"route", "status"},
+			jq:     `select(.route != "/healthz")`,
+			input: []string{
+				`{"route":"/api","status":200}`,
+				`{"route":"/healthz","status":200}`,
+				`{"route":"/api","status":404}`,
+				`{"route":"/api","status":200}`,
+				`{"status":500}`,
+			},
+			want:       "2  route=/api status=200\n1  route=(none) status=500\n1  route=/api status=404\n",
+			wantCounts: map[string]int{"route=/api status=200": 2, "route=/api status=404": 1, "route=(none) status=500": 1},
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			fs := new(FilterScheme)
+			if err := fs.AddJQ(test.jq, nil); err != nil {
+				t.Fatal(err)
+			}
+			w := new(bytes.Buffer)
+			f := &CountFormatter{Field: test.field, Fields: test.fields}
+			outs := &OutputSchema{
+				Formatter:   f,
+				EmitErrorFn: func(msg string) { t.Errorf("unexpected error: %v", msg) },
+			}
+			if _, err := ReadLog(strings.NewReader(strings.Join(test.input, "\n")), w, &InputSchema{Strict: false}, outs, fs); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(w.String(), test.want); diff != "" {
+				t.Errorf("output:\n%s", diff)
+			}
+			if diff := cmp.Diff(f.Counts(), test.wantCounts); diff != "" {
+				t.Errorf("counts:\n%s", diff)
+			}
+		})
+	}
+}
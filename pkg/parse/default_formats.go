@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -14,14 +16,23 @@ import (
 type DefaultOutputFormatter struct {
 	Aurora aurora.Aurora // Controls the use of color.
 
-	// If true, print ↑ for fields that have an identical value as the previous line.
+	// If true, print ↑ for fields that have an identical value as the previous line.  Fields
+	// named in NoElideFields are always printed in full.  If ReassertInterval is positive, a
+	// field's value is printed again after it has been elided on ReassertInterval-1 lines in a
+	// row, so that it's shown at least every ReassertInterval lines.
 	ElideDuplicateFields bool
+	NoElideFields        map[string]struct{}
+	ReassertInterval     int
 
 	// The time.Format string to show times in, like time.RFC3339.  If empty, show relative
 	// times since the time the program started.  (A minus sign indicates the past; positive
 	// values are in the future, good for when you are following a log file.)
 	AbsoluteTimeFormat string
 
+	// If true, relative times are measured from the time of the first line with a time, rather
+	// than from when the program started, like "+0s", "+1.2s".  This is for reading old logs.
+	RelativeToFirstLine bool
+
 	// If non-empty, print only the fractional seconds for log lines that occurred on the same
 	// second as the previous line.  For example, if SecondsOnlyFormat is set to ".000":
 	//
@@ -36,22 +47,154 @@ type DefaultOutputFormatter struct {
 
 	Zone            *time.Location      // Zone is the time zone to display the output in.
 	HighlightFields map[string]struct{} // HighlightFields visually distinguishes the named fields.
+
+	// If non-zero, messages longer than MessageWidth characters are truncated with "…".  If
+	// WrapMessages is also set, long messages are instead wrapped onto continuation lines,
+	// indented so that they line up with the start of the message.
+	MessageWidth int
+	WrapMessages bool
+
+	// If true, messages that contain newlines are displayed across multiple lines, with the
+	// continuation lines indented to line up with the start of the message, instead of having
+	// their newlines replaced with "↩".  MessageWidth applies to each line separately.
+	MultilineMessages bool
+
+	// If true, string values of fields are displayed in double quotes, with Go escapes for
+	// quotes, newlines, and unprintable characters, so that the string "42" can be told apart
+	// from the number 42.  Strings in joined arrays are quoted too.
+	QuoteStrings bool
+
+	// If true, runs of spaces and tabs inside messages are displayed as a single space, and
+	// leading and trailing spaces and tabs are removed.  If KeepEdgeWhitespace is also set,
+	// leading and trailing whitespace is displayed as-is.  Newlines are never squeezed.
+	SqueezeWhitespace  bool
+	KeepEdgeWhitespace bool
+
+	// If true, field keys are printed without color, even when Aurora colors the level, time,
+	// and message.  Fields named in HighlightFields are still highlighted.
+	NoColorFields bool
+
+	// HighlightLevels names levels whose lines are highlighted in their entirety, with a
+	// background in the level's color.  Has no effect when Aurora is not coloring output.
+	HighlightLevels map[Level]bool
+
+	// ColorFields colors the values of the named fields according to the associated
+	// FieldColorizer.  NoColorFields disables this.
+	ColorFields map[string]FieldColorizer
+
+	// If JoinArrays is true, arrays that contain only strings, numbers, and booleans are shown as
+	// their elements joined by ArrayDelimiter (or "," if empty), like tags:a,b,c.  Arrays
+	// containing anything else, empty arrays, and arrays with strings that contain the delimiter
+	// are shown as JSON.
+	JoinArrays     bool
+	ArrayDelimiter string
+
+	// SizeFields names fields whose values are replaced by their size when marshaled as JSON,
+	// like payload[4.2KB], for finding what's making lines big without printing it.
+	SizeFields map[string]struct{}
+
+	// LevelStyle picks the labels shown for levels, like "INFO", "INF", or "I".  LevelNames
+	// overrides the labels for individual levels.  All labels are padded to the same width.
+	LevelStyle LevelStyle
+	LevelNames map[Level]string
+
+	// Columns names fields that are shown as aligned columns between the time and the message,
+	// like a table, rather than as key:value pairs after the message.  Lines without the field
+	// have a blank column.  A column is as wide as the widest value seen so far, unless
+	// ColumnWidths fixes its width, in which case longer values are truncated with "…".
+	Columns      []string
+	ColumnWidths map[string]int
+
+	// ExpandFields names fields that are shown underneath the line as indented JSON, for large
+	// nested objects, rather than as compact key:value pairs after the message.  They are elided
+	// like any other field when their value is the same as on the line above.
+	ExpandFields []string
+	// StacktraceFields names fields that hold stack traces, like zap's "stacktrace".  When the
+	// value is a string with more than one line, or an array of strings, it's shown underneath
+	// the line with one frame per line, rather than with its newlines replaced with "↩".  Other
+	// values, like a single line or an object, are shown inline like any other field.
+	StacktraceFields []string
+
+	// UnknownTimeMarker is shown in place of the time on lines without one.  If empty,
+	// DefaultUnknownTimeMarker is used; use a space to leave the column blank.
+	UnknownTimeMarker string
+
+	// ColorBy names a field, like "trace_id", whose value marks the start of each line, so that
+	// interleaved lines with the same value can be picked out.  With color, the mark is a bar in a
+	// color picked by hashing the value; without color, it's a short hash of the value, like
+	// "3fa2".  Lines without the field are indented to match.
+	ColorBy string
+}
+
+// DefaultUnknownTimeMarker is what DefaultOutputFormatter shows in place of the time on lines
+// without one, unless configured otherwise.
+const DefaultUnknownTimeMarker = "???"
+
+// FieldColorizer picks a color for a field's value.  It returns 0 to leave the value uncolored.
+type FieldColorizer func(v interface{}) aurora.Color
+
+// FieldColorizers are the FieldColorizers available by name, for use from the command line.
+var FieldColorizers = map[string]FieldColorizer{
+	"http-status": HTTPStatusColor,
+}
+
+// HTTPStatusColor colors HTTP status codes by class; 2xx is green, 3xx is cyan, 4xx is yellow,
+// and 5xx is red.  Codes may be numbers or strings.
+func HTTPStatusColor(v interface{}) aurora.Color {
+	var code int
+	switch x := v.(type) {
+	case float64:
+		code = int(x)
+	case int:
+		code = x
+	case string:
+		n, err := strconv.Atoi(x)
+		if err != nil {
+			return 0
+		}
+		code = n
+	default:
+		return 0
+	}
+	switch code / 100 {
+	case 2:
+		return aurora.GreenFg
+	case 3:
+		return aurora.CyanFg
+	case 4:
+		return aurora.YellowFg
+	case 5:
+		return aurora.RedFg
+	default:
+		return 0
+	}
 }
 
 var (
 	programStartTime = time.Now()
+	monochrome       = aurora.NewAurora(false)
 )
 
 func (f *DefaultOutputFormatter) FormatTime(s *State, t time.Time, w *bytes.Buffer) {
 	var out string
 	switch {
 	case t.IsZero():
-		out = "???"
+		out = f.UnknownTimeMarker
+		if out == "" {
+			out = DefaultUnknownTimeMarker
+		}
 		for utf8.RuneCountInString(out) < s.timePadding {
 			out = " " + out
 		}
 	case f.AbsoluteTimeFormat == "":
-		rel := t.Sub(programStartTime)
+		base := programStartTime
+		if f.RelativeToFirstLine {
+			if s.firstTime.IsZero() {
+				s.firstTime = t
+			}
+			base = s.firstTime
+		}
+		rel := t.Sub(base)
 		abs := rel
 		if rel < 0 {
 			abs = -rel
@@ -68,6 +211,9 @@ func (f *DefaultOutputFormatter) FormatTime(s *State, t time.Time, w *bytes.Buff
 			p = time.Second
 		}
 		out = rel.Truncate(p).String()
+		if f.RelativeToFirstLine && rel >= 0 {
+			out = "+" + out
+		}
 	case f.SubSecondsOnlyFormat != "":
 		last := s.lastTime.Truncate(time.Second)
 		if t.Sub(last) < time.Second && t.UnixNano() >= last.UnixNano() {
@@ -88,43 +234,534 @@ func (f *DefaultOutputFormatter) FormatTime(s *State, t time.Time, w *bytes.Buff
 	s.lastTime = t
 }
 
+// formatSize formats a number of bytes with decimal units, like "4.2KB".
+func formatSize(n int) string {
+	if n < 1000 {
+		return strconv.Itoa(n) + "B"
+	}
+	size := float64(n)
+	for _, unit := range []string{"KB", "MB", "GB"} {
+		size /= 1000
+		if size < 999.95 || unit == "GB" {
+			return strconv.FormatFloat(size, 'f', 1, 64) + unit
+		}
+	}
+	panic("unreachable")
+}
+
+// formatOriginal shows the original input of a line on a dimmed continuation line.
+func (f *DefaultOutputFormatter) formatOriginal(s *State, raw []byte, w *bytes.Buffer) {
+	w.WriteString("  ")
+	w.WriteString(f.Aurora.Faint(string(raw)).String())
+	w.WriteString("\n")
+}
+
 func cleanupNewlines(msg string) string {
 	msg = strings.ReplaceAll(msg, "\n", "↩")
 	msg = strings.ReplaceAll(msg, "\r", "←")
 	return msg
 }
 
+// squeezeWhitespace collapses runs of spaces and tabs in msg to a single space.  Leading and
+// trailing runs are removed, unless keepEdges is true, in which case they are left alone.
+func squeezeWhitespace(msg string, keepEdges bool) string {
+	isSpace := func(r rune) bool { return r == ' ' || r == '\t' }
+	body := strings.TrimLeftFunc(msg, isSpace)
+	leading := msg[:len(msg)-len(body)]
+	body = strings.TrimRightFunc(body, isSpace)
+	trailing := msg[len(leading)+len(body):]
+
+	result := new(strings.Builder)
+	if keepEdges {
+		result.WriteString(leading)
+	}
+	inSpace := false
+	for _, r := range body {
+		if isSpace(r) {
+			if !inSpace {
+				result.WriteByte(' ')
+			}
+			inSpace = true
+			continue
+		}
+		inSpace = false
+		result.WriteRune(r)
+	}
+	if keepEdges {
+		result.WriteString(trailing)
+	}
+	return result.String()
+}
+
+// currentColumn returns the number of characters that have been written to the current line of
+// w, ignoring any ANSI escape sequences.
+func currentColumn(w *bytes.Buffer) int {
+	line := w.Bytes()
+	if i := bytes.LastIndexByte(line, '\n'); i >= 0 {
+		line = line[i+1:]
+	}
+	var col int
+	for i := 0; i < len(line); {
+		if line[i] == '\x1b' {
+			// Skip to the end of the escape sequence, which is a letter.
+			for i++; i < len(line) && !(line[i] >= 'a' && line[i] <= 'z' || line[i] >= 'A' && line[i] <= 'Z'); i++ {
+			}
+			i++
+			continue
+		}
+		_, n := utf8.DecodeRune(line[i:])
+		i += n
+		col++
+	}
+	return col
+}
+
+// wrapMessage splits msg into chunks of at most width characters, breaking at the last space in
+// each chunk if there is one.
+func wrapMessage(msg string, width int) []string {
+	var result []string
+	runes := []rune(msg)
+	for len(runes) > width {
+		n := width
+		for i := width; i > 0; i-- {
+			if runes[i] == ' ' {
+				n = i
+				break
+			}
+		}
+		result = append(result, string(runes[:n]))
+		runes = runes[n:]
+		if runes[0] == ' ' {
+			runes = runes[1:]
+		}
+	}
+	return append(result, string(runes))
+}
+
 func (f *DefaultOutputFormatter) FormatMessage(s *State, msg string, highlight bool, w *bytes.Buffer) {
+	if f.SqueezeWhitespace {
+		msg = squeezeWhitespace(msg, f.KeepEdgeWhitespace)
+	}
+	if f.MultilineMessages && strings.Contains(msg, "\n") {
+		indent := strings.Repeat(" ", currentColumn(w))
+		for i, part := range strings.Split(strings.TrimRight(msg, "\r\n"), "\n") {
+			if i > 0 {
+				w.WriteString("\n")
+				w.WriteString(indent)
+			}
+			f.formatMessageLine(strings.TrimSuffix(part, "\r"), highlight, w)
+		}
+		return
+	}
+	f.formatMessageLine(msg, highlight, w)
+}
+
+// formatMessageLine formats a message that is displayed on one line, unless it's wrapped.
+func (f *DefaultOutputFormatter) formatMessageLine(msg string, highlight bool, w *bytes.Buffer) {
 	msg = cleanupNewlines(msg)
-	if highlight {
-		msg = f.Aurora.Inverse(msg).String()
+	if f.MessageWidth <= 0 || utf8.RuneCountInString(msg) <= f.MessageWidth {
+		if highlight {
+			msg = f.Aurora.Inverse(msg).String()
+		}
+		w.WriteString(msg)
+		return
+	}
+	if !f.WrapMessages {
+		msg = string([]rune(msg)[:f.MessageWidth-1]) + "…"
+		if highlight {
+			msg = f.Aurora.Inverse(msg).String()
+		}
+		w.WriteString(msg)
+		return
+	}
+	indent := strings.Repeat(" ", currentColumn(w))
+	for i, part := range wrapMessage(msg, f.MessageWidth) {
+		if i > 0 {
+			w.WriteString("\n")
+			w.WriteString(indent)
+		}
+		if highlight {
+			part = f.Aurora.Inverse(part).String()
+		}
+		w.WriteString(part)
 	}
-	w.WriteString(msg)
 }
 
-func (f *DefaultOutputFormatter) FormatLevel(s *State, level Level, w *bytes.Buffer) {
-	var l aurora.Value
+// colorLevel colors text in the color associated with level.
+func colorLevel(a aurora.Aurora, level Level, text string) aurora.Value {
 	switch level {
 	case LevelTrace:
-		l = f.Aurora.Gray(15, "TRACE")
+		return a.Gray(15, text)
 	case LevelDebug:
-		l = f.Aurora.Blue("DEBUG")
+		return a.Blue(text)
 	case LevelInfo:
-		l = f.Aurora.Cyan("INFO ")
+		return a.Cyan(text)
 	case LevelWarn:
-		l = f.Aurora.Yellow("WARN ")
+		return a.Yellow(text)
 	case LevelError:
-		l = f.Aurora.Red("ERROR")
-	case LevelPanic:
-		l = f.Aurora.Magenta("PANIC")
-	case LevelDPanic:
-		l = f.Aurora.Magenta("DPANI")
+		return a.Red(text)
+	case LevelPanic, LevelDPanic:
+		return a.Magenta(text)
 	case LevelFatal:
-		l = f.Aurora.BgMagenta("FATAL")
+		return a.BgMagenta(text)
+	default:
+		return a.Gray(15, text)
+	}
+}
+
+// LevelStyle controls how long the labels that DefaultOutputFormatter shows for levels are.
+type LevelStyle int
+
+const (
+	LevelStyleFull  LevelStyle = iota // Labels like "INFO ".
+	LevelStyleShort                   // Three-letter labels like "INF".
+	LevelStyleChar                    // One-letter labels like "I".
+)
+
+// defaultLevelNames are the labels that DefaultOutputFormatter shows for each level, in each style.
+var defaultLevelNames = map[LevelStyle]map[Level]string{
+	LevelStyleFull: {
+		LevelUnknown: "UNK",
+		LevelTrace:   "TRACE",
+		LevelDebug:   "DEBUG",
+		LevelInfo:    "INFO",
+		LevelWarn:    "WARN",
+		LevelError:   "ERROR",
+		LevelPanic:   "PANIC",
+		LevelDPanic:  "DPANI",
+		LevelFatal:   "FATAL",
+	},
+	LevelStyleShort: {
+		LevelUnknown: "UNK",
+		LevelTrace:   "TRC",
+		LevelDebug:   "DBG",
+		LevelInfo:    "INF",
+		LevelWarn:    "WRN",
+		LevelError:   "ERR",
+		LevelPanic:   "PNC",
+		LevelDPanic:  "DPN",
+		LevelFatal:   "FTL",
+	},
+	LevelStyleChar: {
+		LevelUnknown: "?",
+		LevelTrace:   "T",
+		LevelDebug:   "D",
+		LevelInfo:    "I",
+		LevelWarn:    "W",
+		LevelError:   "E",
+		LevelPanic:   "P",
+		LevelDPanic:  "P",
+		LevelFatal:   "F",
+	},
+}
+
+// levelName returns the label for a level.  Levels that don't exist get the label for LevelUnknown.
+func (f *DefaultOutputFormatter) levelName(level Level) string {
+	if level > LevelFatal {
+		level = LevelUnknown
+	}
+	if l, ok := f.LevelNames[level]; ok {
+		return l
+	}
+	names, ok := defaultLevelNames[f.LevelStyle]
+	if !ok {
+		names = defaultLevelNames[LevelStyleFull]
+	}
+	return names[level]
+}
+
+// levelWidth returns the width of the longest level label, in characters.  Every label is padded to
+// this width, so that messages line up no matter which labels are configured.
+func (f *DefaultOutputFormatter) levelWidth() int {
+	width := 0
+	for lvl := LevelUnknown; lvl <= LevelFatal; lvl++ {
+		if n := utf8.RuneCountInString(f.levelName(lvl)); n > width {
+			width = n
+		}
+	}
+	return width
+}
+
+func (f *DefaultOutputFormatter) FormatLevel(s *State, level Level, w *bytes.Buffer) {
+	l := f.levelName(level)
+	l += strings.Repeat(" ", f.levelWidth()-utf8.RuneCountInString(l))
+	w.WriteString(colorLevel(f.Aurora, level, l).String())
+}
+
+// joinScalars joins the elements of an array of strings, numbers, and booleans with delim.  It
+// returns false if the array can't be unambiguously displayed that way.  If quote is true, strings
+// are quoted.
+func joinScalars(arr []interface{}, delim string, quote bool) (string, bool) {
+	if len(arr) == 0 {
+		return "", false
+	}
+	if delim == "" {
+		delim = ","
+	}
+	parts := make([]string, len(arr))
+	for i, elt := range arr {
+		switch x := elt.(type) {
+		case string:
+			if quote {
+				parts[i] = strconv.Quote(x)
+				if strings.Contains(parts[i], delim) {
+					return "", false
+				}
+				continue
+			}
+			if strings.Contains(x, delim) {
+				return "", false
+			}
+			parts[i] = x
+		case float64:
+			parts[i] = strconv.FormatFloat(x, 'f', -1, 64)
+		case bool:
+			parts[i] = strconv.FormatBool(x)
+		default:
+			return "", false
+		}
+	}
+	return strings.Join(parts, delim), true
+}
+
+// highlightLine implements lineHighlighter.
+func (f *DefaultOutputFormatter) highlightLine(lvl Level, line []byte) []byte {
+	if !f.HighlightLevels[lvl] {
+		return line
+	}
+	var bg aurora.Value
+	switch lvl {
+	case LevelTrace:
+		bg = f.Aurora.BgGray(15, "")
+	case LevelDebug:
+		bg = f.Aurora.BgBlue("")
+	case LevelInfo:
+		bg = f.Aurora.BgCyan("")
+	case LevelWarn:
+		bg = f.Aurora.BgYellow("")
+	case LevelError:
+		bg = f.Aurora.BgRed("")
 	default:
-		l = f.Aurora.Gray(15, "UNK  ")
+		bg = f.Aurora.BgMagenta("")
+	}
+	if bg.Color() == 0 {
+		return line
+	}
+	// Every reset in the line would also reset the background, so the background is re-applied
+	// after each one.
+	start := []byte("\x1b[" + bg.Color().Nos(false) + "m")
+	reset := []byte("\x1b[0m")
+	result := make([]byte, 0, len(line)+2*len(start)+len(reset))
+	result = append(result, start...)
+	result = append(result, bytes.ReplaceAll(line, reset, append(reset, start...))...)
+	return append(result, reset...)
+}
+
+// formatValue returns the text that shows a field's value.
+func (f *DefaultOutputFormatter) formatValue(v interface{}) []byte {
+	switch x := v.(type) {
+	case string:
+		if f.QuoteStrings {
+			return []byte(strconv.Quote(x))
+		}
+		return []byte(cleanupNewlines(x))
+	case []interface{}:
+		if f.JoinArrays {
+			if joined, ok := joinScalars(x, f.ArrayDelimiter, f.QuoteStrings); ok {
+				return []byte(cleanupNewlines(joined))
+			}
+		}
+	}
+	value, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("marshal value: %v", err))
+	}
+	return value
+}
+
+// elide returns true if a field's value should be replaced with "↑", because it's the same as on
+// the line above.
+func (f *DefaultOutputFormatter) elide(s *State, k string, value []byte) bool {
+	if _, full := f.NoElideFields[k]; !f.ElideDuplicateFields || full {
+		return false
+	}
+	old, ok := s.lastFields[k]
+	if ok && bytes.Equal(old, value) && (f.ReassertInterval <= 0 || s.elidedLines[k] < f.ReassertInterval-1) {
+		if f.ReassertInterval > 0 {
+			if s.elidedLines == nil {
+				s.elidedLines = make(map[string]int)
+			}
+			s.elidedLines[k]++
+		}
+		return true
+	}
+	delete(s.elidedLines, k)
+	s.lastFields[k] = value
+	return false
+}
+
+// expandedFields returns ExpandFields, and the StacktraceFields that hold a stack trace on this
+// line; other values of StacktraceFields are shown inline like any other field.
+func (f *DefaultOutputFormatter) expandedFields(fields map[string]interface{}) []string {
+	if len(f.StacktraceFields) == 0 {
+		return f.ExpandFields
+	}
+	result := make([]string, 0, len(f.ExpandFields)+len(f.StacktraceFields))
+	result = append(result, f.ExpandFields...)
+	for _, k := range f.StacktraceFields {
+		if v, ok := fields[k]; ok {
+			if _, trace := f.stacktraceLines(k, v); trace {
+				result = append(result, k)
+			}
+		}
+	}
+	return result
+}
+
+func (f *DefaultOutputFormatter) isExpandField(k string) bool {
+	for _, e := range f.ExpandFields {
+		if k == e {
+			return true
+		}
+	}
+	return false
+}
+
+// stacktraceLines returns the lines of a stack trace field, or false if the field doesn't look
+// like a stack trace: a string with more than one line, or an array of strings.
+func (f *DefaultOutputFormatter) stacktraceLines(k string, v interface{}) ([]string, bool) {
+	if f.isExpandField(k) {
+		return nil, false
+	}
+	switch x := v.(type) {
+	case string:
+		lines := strings.Split(strings.TrimRight(x, "\r\n"), "\n")
+		if len(lines) < 2 {
+			return nil, false
+		}
+		for i := range lines {
+			lines[i] = cleanupNewlines(strings.TrimSuffix(lines[i], "\r"))
+		}
+		return lines, true
+	case []interface{}:
+		// Some loggers log each frame as an element of an array.
+		if len(x) == 0 {
+			return nil, false
+		}
+		lines := make([]string, 0, len(x))
+		for _, frame := range x {
+			str, ok := frame.(string)
+			if !ok {
+				return nil, false
+			}
+			lines = append(lines, cleanupNewlines(str))
+		}
+		return lines, true
+	}
+	return nil, false
+}
+
+// formatExpanded shows a field as indented JSON on continuation lines underneath the line, or a
+// stack trace with one frame per line.
+func (f *DefaultOutputFormatter) formatExpanded(s *State, k string, v interface{}, w *bytes.Buffer) {
+	keyAurora := f.Aurora
+	if f.NoColorFields {
+		keyAurora = monochrome
+	}
+	w.WriteString("  ")
+	if _, highlight := f.HighlightFields[k]; highlight {
+		w.WriteString(f.Aurora.Yellow(k).String())
+	} else {
+		w.WriteString(keyAurora.Gray(16, k).String())
+	}
+	w.WriteString(keyAurora.Gray(16, ":").String())
+	if f.elide(s, k, f.formatValue(v)) {
+		w.WriteString(" ↑\n")
+		return
+	}
+	if lines, ok := f.stacktraceLines(k, v); ok {
+		for _, l := range lines {
+			w.WriteString("\n    ")
+			w.WriteString(l)
+		}
+		w.WriteString("\n")
+		return
+	}
+	w.WriteString(" ")
+	value, err := json.MarshalIndent(v, "  ", "  ")
+	if err != nil {
+		panic(fmt.Sprintf("marshal value: %v", err))
+	}
+	w.Write(value)
+	w.WriteString("\n")
+}
+
+func (f *DefaultOutputFormatter) columns() []string {
+	return f.Columns
+}
+
+func (f *DefaultOutputFormatter) formatColumn(s *State, k string, v interface{}, ok bool, w *bytes.Buffer) {
+	var value string
+	if ok {
+		value = string(f.formatValue(v))
+	}
+	n := utf8.RuneCountInString(value)
+	width, fixed := f.ColumnWidths[k]
+	if fixed && width > 0 {
+		if n > width {
+			value = string([]rune(value)[:width-1]) + "…"
+			n = width
+		}
+	} else {
+		if s.columnWidths == nil {
+			s.columnWidths = make(map[string]int)
+		}
+		if n > s.columnWidths[k] {
+			s.columnWidths[k] = n
+		}
+		width = s.columnWidths[k]
+	}
+	padding := strings.Repeat(" ", width-n)
+	if colorize, ok := f.ColorFields[k]; ok && !f.NoColorFields {
+		if c := colorize(v); c != 0 {
+			w.WriteString(f.Aurora.Colorize(value, c).String() + padding)
+			return
+		}
+	}
+	w.WriteString(value + padding)
+}
+
+// colorByPalette is the 256-color palette that ColorBy picks from; bright enough to read on a dark
+// background, and distinct enough from each other to tell apart.
+var colorByPalette = []uint8{33, 39, 41, 43, 75, 79, 105, 111, 135, 141, 166, 171, 178, 184, 203, 208, 214, 220}
+
+// colorByWidth is the width of the short hash that ColorBy shows without color.
+const colorByWidth = 4
+
+// formatPrefix implements prefixFormatter.
+func (f *DefaultOutputFormatter) formatPrefix(s *State, fields map[string]interface{}, w *bytes.Buffer) {
+	if f.ColorBy == "" {
+		return
+	}
+	colored := f.Aurora.Red("").Color() != 0
+	v, ok := fields[f.ColorBy]
+	if !ok {
+		if colored {
+			w.WriteString("  ")
+		} else {
+			w.WriteString(strings.Repeat(" ", colorByWidth+1))
+		}
+		return
+	}
+	h := fnv.New32a()
+	h.Write([]byte(countKey(v))) //nolint:errcheck // Hashes never return errors.
+	sum := h.Sum32()
+	if colored {
+		w.WriteString(f.Aurora.Index(colorByPalette[sum%uint32(len(colorByPalette))], "▌").String())
+		w.WriteString(" ")
+		return
 	}
-	w.WriteString(l.String())
+	fmt.Fprintf(w, "%0*x ", colorByWidth, sum>>(32-4*colorByWidth))
 }
 
 func (f *DefaultOutputFormatter) FormatField(s *State, k string, v interface{}, w *bytes.Buffer) {
@@ -133,34 +770,37 @@ func (f *DefaultOutputFormatter) FormatField(s *State, k string, v interface{},
 		_, highlight = f.HighlightFields[k]
 	}
 
+	keyAurora := f.Aurora
+	if f.NoColorFields {
+		keyAurora = monochrome
+	}
 	if highlight {
 		w.WriteString(f.Aurora.Yellow(k).String())
 	} else {
-		w.WriteString(f.Aurora.Gray(16, k).String())
+		w.WriteString(keyAurora.Gray(16, k).String())
 	}
-	w.WriteString(f.Aurora.Gray(16, ":").String())
 
-	var value []byte
-	switch x := v.(type) {
-	case string:
-		x = cleanupNewlines(x)
-		value = []byte(x)
-	default:
-		var err error
-		value, err = json.Marshal(v)
+	if _, ok := f.SizeFields[k]; ok {
+		value, err := json.Marshal(v)
 		if err != nil {
 			panic(fmt.Sprintf("marshal value: %v", err))
 		}
+		w.WriteString(keyAurora.Gray(16, "["+formatSize(len(value))+"]").String())
+		return
 	}
+	w.WriteString(keyAurora.Gray(16, ":").String())
 
-	if f.ElideDuplicateFields {
-		old, ok := s.lastFields[k]
-		if ok && bytes.Equal(old, value) {
-			value = []byte("↑")
-		} else {
-			s.lastFields[k] = value
-		}
+	value := f.formatValue(v)
+	if f.elide(s, k, value) {
+		w.WriteString("↑")
+		return
 	}
 
+	if colorize, ok := f.ColorFields[k]; ok {
+		if c := colorize(v); c != 0 {
+			w.WriteString(keyAurora.Colorize(string(value), c).String())
+			return
+		}
+	}
 	w.Write(value)
 }
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/logrusorgru/aurora/v3"
@@ -51,6 +52,37 @@ func TestFormatting(t *testing.T) {
 			t:    []time.Time{defaultTime},
 			want: `2000-01-02T03:04:05Z INFO  hello↩world a:field b:↑` + "\n",
 		},
+		{
+			f: &DefaultOutputFormatter{
+				Aurora:               aurora.NewAurora(false),
+				ElideDuplicateFields: true,
+				NoElideFields:        map[string]struct{}{"b": {}},
+				AbsoluteTimeFormat:   time.RFC3339,
+				Zone:                 time.UTC,
+			},
+			t: []time.Time{defaultTime, defaultTime},
+			want: strings.Join([]string{
+				`2000-01-02T03:04:05Z INFO  hello↩world a:field b:{"nesting":"is real"}`,
+				`2000-01-02T03:04:05Z INFO  hello↩world a:↑ b:{"nesting":"is real"}`,
+			}, "\n") + "\n",
+		},
+		{
+			f: &DefaultOutputFormatter{
+				Aurora:               aurora.NewAurora(false),
+				ElideDuplicateFields: true,
+				ReassertInterval:     3,
+				AbsoluteTimeFormat:   time.RFC3339,
+				Zone:                 time.UTC,
+			},
+			t: []time.Time{defaultTime, defaultTime, defaultTime, defaultTime, defaultTime},
+			want: strings.Join([]string{
+				`2000-01-02T03:04:05Z INFO  hello↩world a:field b:↑`,
+				`2000-01-02T03:04:05Z INFO  hello↩world a:↑ b:↑`,
+				`2000-01-02T03:04:05Z INFO  hello↩world a:↑ b:{"nesting":"is real"}`,
+				`2000-01-02T03:04:05Z INFO  hello↩world a:field b:↑`,
+				`2000-01-02T03:04:05Z INFO  hello↩world a:↑ b:↑`,
+			}, "\n") + "\n",
+		},
 		{
 			f: &DefaultOutputFormatter{
 				Aurora:               aurora.NewAurora(false),
@@ -101,6 +133,27 @@ func TestFormatting(t *testing.T) {
 			t:    []time.Time{programStartTime.Add(-123456789)},
 			want: `-123ms     INFO  hello↩world a:field b:↑` + "\n",
 		},
+		{
+			f: &DefaultOutputFormatter{
+				Aurora:               aurora.NewAurora(false),
+				ElideDuplicateFields: true,
+				AbsoluteTimeFormat:   "",
+				RelativeToFirstLine:  true,
+				Zone:                 time.UTC,
+			},
+			t: []time.Time{
+				{},
+				defaultTime,
+				defaultTime.Add(1234 * time.Millisecond),
+				defaultTime.Add(-5 * time.Millisecond),
+			},
+			want: strings.Join([]string{
+				`       ??? INFO  hello↩world a:field b:↑`,
+				`+0s        INFO  hello↩world a:↑ b:↑`,
+				`+1s        INFO  hello↩world a:↑ b:↑`,
+				`-5ms       INFO  hello↩world a:↑ b:↑`,
+			}, "\n") + "\n",
+		},
 		{
 			f: &DefaultOutputFormatter{
 				Aurora:               aurora.NewAurora(false),
@@ -185,20 +238,661 @@ func TestFormatting(t *testing.T) {
 }
 
 func TestLevelLength(t *testing.T) {
-	for _, color := range []bool{false} {
-		f := &DefaultOutputFormatter{Aurora: aurora.NewAurora(color)}
-		var s State
+	customNames := []map[Level]string{
+		nil,
+		{LevelWarn: "WARNING", LevelInfo: "I"},
+		{LevelError: "ÉRREUR", LevelUnknown: "?"},
+		{LevelTrace: "T", LevelDebug: "D", LevelInfo: "I", LevelWarn: "W", LevelError: "E", LevelPanic: "P", LevelDPanic: "DP", LevelFatal: "F", LevelUnknown: "U"},
+	}
+	for _, names := range customNames {
+		for _, style := range []LevelStyle{LevelStyleFull, LevelStyleShort, LevelStyleChar} {
+			for _, color := range []bool{false} {
+				f := &DefaultOutputFormatter{Aurora: aurora.NewAurora(color), LevelStyle: style, LevelNames: names}
+				var s State
+				buf := new(bytes.Buffer)
+				f.FormatLevel(&s, Level(0), buf)
+				want := utf8.RuneCount(buf.Bytes())
+
+				for i := LevelTrace; i < 100; i++ {
+					var s State
+					buf := new(bytes.Buffer)
+					f.FormatLevel(&s, i, buf)
+					if got := utf8.RuneCount(buf.Bytes()); got != want {
+						t.Errorf("length of formmated level %v (color: %v, style: %v, names: %v):\n  got: %v\n want: %v", i, color, style, names, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestLevelNames(t *testing.T) {
+	f := &DefaultOutputFormatter{Aurora: aurora.NewAurora(false), LevelNames: map[Level]string{LevelWarn: "WARNING"}}
+	buf := new(bytes.Buffer)
+	for _, lvl := range []Level{LevelWarn, LevelInfo, LevelUnknown} {
+		f.FormatLevel(new(State), lvl, buf)
+		buf.WriteString("|")
+	}
+	if got, want := buf.String(), "WARNING|INFO   |UNK    |"; got != want {
+		t.Errorf("levels:\n  got: %q\n want: %q", got, want)
+	}
+
+	for style, want := range map[LevelStyle]string{LevelStyleFull: "INFO |", LevelStyleShort: "INF|", LevelStyleChar: "I|"} {
+		f := &DefaultOutputFormatter{Aurora: aurora.NewAurora(false), LevelStyle: style}
 		buf := new(bytes.Buffer)
-		f.FormatLevel(&s, Level(0), buf)
-		want := buf.Len()
+		f.FormatLevel(new(State), LevelInfo, buf)
+		buf.WriteString("|")
+		if got := buf.String(); got != want {
+			t.Errorf("style %v:\n  got: %q\n want: %q", style, got, want)
+		}
+	}
+}
 
-		for i := LevelTrace; i < 100; i++ {
+func TestMessageWidth(t *testing.T) {
+	testData := []struct {
+		name      string
+		f         *DefaultOutputFormatter
+		msg       string
+		highlight bool
+		want      string
+	}{
+		{
+			name: "unlimited",
+			f:    &DefaultOutputFormatter{Aurora: aurora.NewAurora(false)},
+			msg:  "this is a long message",
+			want: "INFO  this is a long message",
+		},
+		{
+			name: "short enough",
+			f:    &DefaultOutputFormatter{Aurora: aurora.NewAurora(false), MessageWidth: 22},
+			msg:  "this is a long message",
+			want: "INFO  this is a long message",
+		},
+		{
+			name: "truncated",
+			f:    &DefaultOutputFormatter{Aurora: aurora.NewAurora(false), MessageWidth: 10},
+			msg:  "this is a long message",
+			want: "INFO  this is a…",
+		},
+		{
+			name: "wrapped at spaces",
+			f:    &DefaultOutputFormatter{Aurora: aurora.NewAurora(false), MessageWidth: 10, WrapMessages: true},
+			msg:  "this is a long message",
+			want: "INFO  this is a\n      long\n      message",
+		},
+		{
+			name: "wrapped without spaces",
+			f:    &DefaultOutputFormatter{Aurora: aurora.NewAurora(false), MessageWidth: 4, WrapMessages: true},
+			msg:  "abcdefghij",
+			want: "INFO  abcd\n      efgh\n      ij",
+		},
+		{
+			name: "wrapped with newlines",
+			f:    &DefaultOutputFormatter{Aurora: aurora.NewAurora(false), MessageWidth: 5, WrapMessages: true},
+			msg:  "abc\ndefghij",
+			want: "INFO  abc↩d\n      efghi\n      j",
+		},
+		{
+			name:      "wrapped with color",
+			f:         &DefaultOutputFormatter{Aurora: aurora.NewAurora(true), MessageWidth: 4, WrapMessages: true},
+			msg:       "abcdef",
+			highlight: true,
+			want:      "\x1b[36mINFO \x1b[0m \x1b[7mabcd\x1b[0m\n      \x1b[7mef\x1b[0m",
+		},
+		{
+			name: "multiline",
+			f:    &DefaultOutputFormatter{Aurora: aurora.NewAurora(false), MultilineMessages: true},
+			msg:  "panic: oops\r\n\tmain.go:12\n\tmain.go:34\n",
+			want: "INFO  panic: oops\n      \tmain.go:12\n      \tmain.go:34",
+		},
+		{
+			name: "multiline, one line",
+			f:    &DefaultOutputFormatter{Aurora: aurora.NewAurora(false), MultilineMessages: true},
+			msg:  "carriage\rreturn",
+			want: "INFO  carriage←return",
+		},
+		{
+			name: "multiline and wrapped",
+			f:    &DefaultOutputFormatter{Aurora: aurora.NewAurora(false), MultilineMessages: true, MessageWidth: 5, WrapMessages: true},
+			msg:  "abc\ndefghij",
+			want: "INFO  abc\n      defgh\n      ij",
+		},
+		{
+			name: "multiline and truncated",
+			f:    &DefaultOutputFormatter{Aurora: aurora.NewAurora(false), MultilineMessages: true, MessageWidth: 5},
+			msg:  "abc\ndefghij",
+			want: "INFO  abc\n      defg…",
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
 			var s State
 			buf := new(bytes.Buffer)
-			f.FormatLevel(&s, i, buf)
-			if got := buf.Len(); got != want {
-				t.Errorf("length of formmated level %v (color: %v):\n  got: %v\n want: %v", i, color, got, want)
+			buf.WriteString("previous line\n")
+			test.f.FormatLevel(&s, LevelInfo, buf)
+			buf.WriteString(" ")
+			test.f.FormatMessage(&s, test.msg, test.highlight, buf)
+			if diff := cmp.Diff(strings.TrimPrefix(buf.String(), "previous line\n"), test.want); diff != "" {
+				t.Errorf("output:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSqueezeWhitespace(t *testing.T) {
+	testData := []struct {
+		name      string
+		msg       string
+		keepEdges bool
+		want      string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "nothing to squeeze",
+			msg:  "hello world",
+			want: "hello world",
+		},
+		{
+			name: "multiple spaces",
+			msg:  "hello     world  again",
+			want: "hello world again",
+		},
+		{
+			name: "tabs and spaces",
+			msg:  "hello\t\t world\tagain",
+			want: "hello world again",
+		},
+		{
+			name: "edges trimmed",
+			msg:  " \t hello   world \t",
+			want: "hello world",
+		},
+		{
+			name:      "edges kept",
+			msg:       " \t hello   world \t",
+			keepEdges: true,
+			want:      " \t hello world \t",
+		},
+		{
+			name:      "only whitespace",
+			msg:       " \t ",
+			keepEdges: true,
+			want:      " \t ",
+		},
+		{
+			name: "newlines are not squeezed",
+			msg:  "hello  \n\n  world",
+			want: "hello \n\n world",
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(squeezeWhitespace(test.msg, test.keepEdges), test.want); diff != "" {
+				t.Errorf("squeezed:\n%s", diff)
+			}
+		})
+	}
+
+	f := &DefaultOutputFormatter{Aurora: aurora.NewAurora(false), SqueezeWhitespace: true}
+	buf := new(bytes.Buffer)
+	f.FormatMessage(&State{}, "  a  \n\tb  ", false, buf)
+	if got, want := buf.String(), "a ↩ b"; got != want {
+		t.Errorf("formatted message:\n  got: %q\n want: %q", got, want)
+	}
+}
+
+func TestNoColorFields(t *testing.T) {
+	f := &DefaultOutputFormatter{
+		Aurora:          aurora.NewAurora(true),
+		NoColorFields:   true,
+		HighlightFields: map[string]struct{}{"important": {}},
+	}
+	s := &State{lastFields: map[string][]byte{}}
+
+	level := new(bytes.Buffer)
+	f.FormatLevel(s, LevelInfo, level)
+	if !strings.Contains(level.String(), "\x1b[") {
+		t.Errorf("level output should be colored: %q", level.String())
+	}
+
+	field := new(bytes.Buffer)
+	f.FormatField(s, "a", 42, field)
+	if got, want := field.String(), "a:42"; got != want {
+		t.Errorf("field output:\n  got: %q\n want: %q", got, want)
+	}
+
+	highlighted := new(bytes.Buffer)
+	f.FormatField(s, "important", "yes", highlighted)
+	if got, want := highlighted.String(), "\x1b[33mimportant\x1b[0m:yes"; got != want {
+		t.Errorf("highlighted field output:\n  got: %q\n want: %q", got, want)
+	}
+}
+
+func TestHighlightLevels(t *testing.T) {
+	testData := []struct {
+		name  string
+		color bool
+		lvl   Level
+		want  string
+	}{
+		{
+			name:  "highlighted level",
+			color: true,
+			lvl:   LevelError,
+			want:  "\x1b[41m\x1b[31mERROR\x1b[0m\x1b[41m hello \x1b[38;5;248ma\x1b[0m\x1b[41m\x1b[38;5;248m:\x1b[0m\x1b[41m1\x1b[0m\n",
+		},
+		{
+			name:  "other level",
+			color: true,
+			lvl:   LevelInfo,
+			want:  "\x1b[36mINFO \x1b[0m hello \x1b[38;5;248ma\x1b[0m\x1b[38;5;248m:\x1b[0m1\n",
+		},
+		{
+			name: "monochrome",
+			lvl:  LevelError,
+			want: "ERROR hello a:1\n",
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			s := &OutputSchema{
+				Formatter: &DefaultOutputFormatter{
+					Aurora:          aurora.NewAurora(test.color),
+					HighlightLevels: map[Level]bool{LevelError: true},
+				},
+				noTime: true,
+				state:  State{lastFields: map[string][]byte{}},
+			}
+			buf := new(bytes.Buffer)
+			buf.WriteString("previous line\n")
+			s.Emit(&line{lvl: test.lvl, msg: "hello", fields: map[string]interface{}{"a": 1}}, buf)
+			if diff := cmp.Diff(strings.TrimPrefix(buf.String(), "previous line\n"), test.want); diff != "" {
+				t.Errorf("output:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestColorFields(t *testing.T) {
+	testData := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{name: "2xx", value: float64(200), want: "\x1b[32m200\x1b[0m"},
+		{name: "3xx", value: float64(304), want: "\x1b[36m304\x1b[0m"},
+		{name: "4xx as string", value: "404", want: "\x1b[33m404\x1b[0m"},
+		{name: "5xx", value: float64(503), want: "\x1b[31m503\x1b[0m"},
+		{name: "not a status", value: "ok", want: "ok"},
+		{name: "out of range", value: float64(42), want: "42"},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			f := &DefaultOutputFormatter{
+				Aurora:      aurora.NewAurora(true),
+				ColorFields: map[string]FieldColorizer{"status": HTTPStatusColor},
+			}
+			buf := new(bytes.Buffer)
+			f.FormatField(&State{}, "status", test.value, buf)
+			got := strings.TrimPrefix(buf.String(), "\x1b[38;5;248mstatus\x1b[0m\x1b[38;5;248m:\x1b[0m")
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("value:\n%s", diff)
+			}
+		})
+	}
+
+	f := &DefaultOutputFormatter{
+		Aurora:        aurora.NewAurora(true),
+		NoColorFields: true,
+		ColorFields:   map[string]FieldColorizer{"status": HTTPStatusColor},
+	}
+	buf := new(bytes.Buffer)
+	f.FormatField(&State{}, "status", float64(500), buf)
+	if got, want := buf.String(), "status:500"; got != want {
+		t.Errorf("with NoColorFields:\n  got: %q\n want: %q", got, want)
+	}
+}
+
+func TestJoinArrays(t *testing.T) {
+	testData := []struct {
+		name  string
+		delim string
+		value interface{}
+		want  string
+	}{
+		{name: "strings", value: []interface{}{"a", "b", "c"}, want: "tags:a,b,c"},
+		{name: "custom delimiter", delim: "|", value: []interface{}{"a", "b"}, want: "tags:a|b"},
+		{name: "mixed scalars", value: []interface{}{"a", 1.5, float64(2), true}, want: "tags:a,1.5,2,true"},
+		{name: "objects", value: []interface{}{"a", map[string]interface{}{"b": "c"}}, want: `tags:["a",{"b":"c"}]`},
+		{name: "nested arrays", value: []interface{}{[]interface{}{"a"}}, want: `tags:[["a"]]`},
+		{name: "null", value: []interface{}{nil}, want: `tags:[null]`},
+		{name: "empty", value: []interface{}{}, want: `tags:[]`},
+		{name: "ambiguous", value: []interface{}{"a,b", "c"}, want: `tags:["a,b","c"]`},
+		{name: "newlines", value: []interface{}{"a\nb"}, want: "tags:a↩b"},
+		{name: "not an array", value: "a,b", want: "tags:a,b"},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			f := &DefaultOutputFormatter{
+				Aurora:         aurora.NewAurora(false),
+				JoinArrays:     true,
+				ArrayDelimiter: test.delim,
+			}
+			buf := new(bytes.Buffer)
+			f.FormatField(&State{}, "tags", test.value, buf)
+			if diff := cmp.Diff(buf.String(), test.want); diff != "" {
+				t.Errorf("output:\n%s", diff)
+			}
+		})
+	}
+
+	// Elision compares the joined form.
+	f := &DefaultOutputFormatter{
+		Aurora:               aurora.NewAurora(false),
+		ElideDuplicateFields: true,
+		JoinArrays:           true,
+	}
+	s := &State{lastFields: map[string][]byte{}}
+	var got []string
+	for _, v := range [][]interface{}{{"a", "b"}, {"a", "b"}, {"a", "c"}} {
+		buf := new(bytes.Buffer)
+		f.FormatField(s, "tags", v, buf)
+		got = append(got, buf.String())
+	}
+	if diff := cmp.Diff(got, []string{"tags:a,b", "tags:↑", "tags:a,c"}); diff != "" {
+		t.Errorf("elided output:\n%s", diff)
+	}
+}
+
+func TestQuoteStrings(t *testing.T) {
+	testData := []struct {
+		name  string
+		join  bool
+		value interface{}
+		want  string
+	}{
+		{name: "string", value: "42", want: `x:"42"`},
+		{name: "number", value: float64(42), want: `x:42`},
+		{name: "escapes", value: "say \"hi\"\n\x00<>", want: `x:"say \"hi\"\n\x00<>"`},
+		{name: "unicode", value: "héllo", want: `x:"héllo"`},
+		{name: "array", value: []interface{}{"42", float64(42)}, want: `x:["42",42]`},
+		{name: "joined array", join: true, value: []interface{}{"42", float64(42), true}, want: `x:"42",42,true`},
+		{name: "ambiguous joined array", join: true, value: []interface{}{"a,b"}, want: `x:["a,b"]`},
+		{name: "object", value: map[string]interface{}{"a": "b"}, want: `x:{"a":"b"}`},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			f := &DefaultOutputFormatter{
+				Aurora:       aurora.NewAurora(false),
+				QuoteStrings: true,
+				JoinArrays:   test.join,
+			}
+			buf := new(bytes.Buffer)
+			f.FormatField(&State{}, "x", test.value, buf)
+			if diff := cmp.Diff(buf.String(), test.want); diff != "" {
+				t.Errorf("output:\n%s", diff)
+			}
+		})
+	}
+
+	// Elision compares the quoted form, so a string and a number with the same digits differ.
+	f := &DefaultOutputFormatter{
+		Aurora:               aurora.NewAurora(false),
+		ElideDuplicateFields: true,
+		QuoteStrings:         true,
+	}
+	s := &State{lastFields: map[string][]byte{}}
+	var got []string
+	for _, v := range []interface{}{"42", "42", float64(42), float64(42), "42"} {
+		buf := new(bytes.Buffer)
+		f.FormatField(s, "x", v, buf)
+		got = append(got, buf.String())
+	}
+	if diff := cmp.Diff(got, []string{`x:"42"`, "x:↑", "x:42", "x:↑", `x:"42"`}); diff != "" {
+		t.Errorf("elided output:\n%s", diff)
+	}
+}
+
+func TestUnknownTimeMarker(t *testing.T) {
+	someTimes := []time.Time{defaultTime, {}, defaultTime}
+	testData := []struct {
+		name   string
+		marker string
+		times  []time.Time
+		want   []string
+	}{
+		{
+			name:  "default",
+			times: someTimes,
+			want:  []string{"2000-01-02T03:04:05Z", "                 ???", "2000-01-02T03:04:05Z"},
+		},
+		{
+			name:   "custom",
+			marker: "-",
+			times:  someTimes,
+			want:   []string{"2000-01-02T03:04:05Z", "                   -", "2000-01-02T03:04:05Z"},
+		},
+		{
+			name:   "blank",
+			marker: " ",
+			times:  someTimes,
+			want:   []string{"2000-01-02T03:04:05Z", "                    ", "2000-01-02T03:04:05Z"},
+		},
+		{
+			name:   "before any times",
+			marker: "<no time>",
+			times:  []time.Time{{}, defaultTime, {}},
+			want:   []string{"<no time>", "2000-01-02T03:04:05Z", "           <no time>"},
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			f := &DefaultOutputFormatter{
+				Aurora:             aurora.NewAurora(false),
+				AbsoluteTimeFormat: time.RFC3339,
+				Zone:               time.UTC,
+				UnknownTimeMarker:  test.marker,
+			}
+			s := &State{}
+			var got []string
+			for _, tm := range test.times {
+				w := new(bytes.Buffer)
+				f.FormatTime(s, tm, w)
+				got = append(got, w.String())
 			}
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("times:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSizeFields(t *testing.T) {
+	f := &DefaultOutputFormatter{
+		Aurora:               aurora.NewAurora(false),
+		ElideDuplicateFields: true,
+		SizeFields:           map[string]struct{}{"s": {}, "o": {}, "big": {}},
+	}
+	s := &State{lastFields: map[string][]byte{}}
+	testData := []struct {
+		k    string
+		v    interface{}
+		want string
+	}{
+		{"s", "hello", "s[7B]"},
+		{"s", "hello", "s[7B]"},
+		{"o", map[string]interface{}{"a": []interface{}{1, 2, 3}}, "o[13B]"},
+		{"big", strings.Repeat("x", 4198), "big[4.2KB]"},
+		{"big", strings.Repeat("x", 999998), "big[1.0MB]"},
+		{"other", "hello", "other:hello"},
+	}
+	for _, test := range testData {
+		w := new(bytes.Buffer)
+		f.FormatField(s, test.k, test.v, w)
+		if got, want := w.String(), test.want; got != want {
+			t.Errorf("field %s:\n  got: %v\n want: %v", test.k, got, want)
+		}
+	}
+}
+
+func TestColumns(t *testing.T) {
+	outs := &OutputSchema{
+		Formatter: &DefaultOutputFormatter{
+			Aurora:       aurora.NewAurora(false),
+			Columns:      []string{"method", "path", "status"},
+			ColumnWidths: map[string]int{"path": 6},
+		},
+		noTime: true,
+		state:  State{lastFields: map[string][]byte{}},
+	}
+	lines := []*line{
+		{lvl: LevelInfo, msg: "one", fields: map[string]interface{}{"method": "GET", "path": "/", "status": float64(200), "extra": "x"}},
+		{lvl: LevelInfo, msg: "two", fields: map[string]interface{}{"method": "DELETE", "path": "/api/users", "status": float64(404)}},
+		{lvl: LevelWarn, msg: "three", fields: map[string]interface{}{"method": "GET", "extra": "y"}},
+	}
+	buf := new(bytes.Buffer)
+	for _, l := range lines {
+		outs.Emit(l, buf)
+	}
+	// Columns grow to fit the widest value seen so far, like the time column, so the first line
+	// is narrower.
+	want := strings.Join([]string{
+		"INFO  GET /      200 one extra:x",
+		"INFO  DELETE /api/… 404 two",
+		"WARN  GET               three extra:y",
+	}, "\n") + "\n"
+	if diff := cmp.Diff(buf.String(), want); diff != "" {
+		t.Errorf("output:\n%s", diff)
+	}
+}
+
+func TestColorBy(t *testing.T) {
+	lines := []*line{
+		{lvl: LevelInfo, msg: "one", fields: map[string]interface{}{"trace_id": "abc"}},
+		{lvl: LevelInfo, msg: "two", fields: map[string]interface{}{"trace_id": "def"}},
+		{lvl: LevelInfo, msg: "three"},
+		{lvl: LevelWarn, msg: "four", fields: map[string]interface{}{"trace_id": "abc"}},
+	}
+	emit := func(color bool) []string {
+		outs := &OutputSchema{
+			Formatter: &DefaultOutputFormatter{
+				Aurora:  aurora.NewAurora(color),
+				ColorBy: "trace_id",
+			},
+			noTime: true,
+			state:  State{lastFields: map[string][]byte{}},
 		}
+		buf := new(bytes.Buffer)
+		for _, l := range lines {
+			outs.Emit(l, buf)
+		}
+		return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	}
+
+	want := []string{
+		"1a47 INFO  one trace_id:abc",
+		"c559 INFO  two trace_id:def",
+		"     INFO  three",
+		"1a47 WARN  four trace_id:abc",
+	}
+	if diff := cmp.Diff(emit(false), want); diff != "" {
+		t.Errorf("monochrome output:\n%s", diff)
+	}
+
+	// With color, the value picks the color of a bar.
+	got := emit(true)
+	bar := func(l string) string {
+		return l[:strings.Index(l, "▌")]
+	}
+	if !strings.HasPrefix(got[0], "\x1b[38;5;") {
+		t.Errorf("line %q: expected a 256-color bar", got[0])
+	}
+	if a, b := bar(got[0]), bar(got[3]); a != b {
+		t.Errorf("lines with the same trace_id have different colors: %q, %q", a, b)
+	}
+	if a, b := bar(got[0]), bar(got[1]); a == b {
+		t.Errorf("lines with different trace_ids have the same color: %q", a)
+	}
+	if !strings.HasPrefix(got[2], "  ") {
+		t.Errorf("line %q: expected indentation in place of the bar", got[2])
+	}
+}
+
+func TestExpandFields(t *testing.T) {
+	outs := &OutputSchema{
+		Formatter: &DefaultOutputFormatter{
+			Aurora:               aurora.NewAurora(false),
+			ElideDuplicateFields: true,
+			ExpandFields:         []string{"request", "missing"},
+		},
+		noTime: true,
+		state:  State{lastFields: map[string][]byte{}},
+	}
+	request := map[string]interface{}{"method": "GET", "headers": map[string]interface{}{"accept": "*/*"}}
+	lines := []*line{
+		{lvl: LevelInfo, msg: "one", fields: map[string]interface{}{"request": request, "a": "x"}},
+		{lvl: LevelInfo, msg: "two", fields: map[string]interface{}{"request": request, "a": "y"}},
+		{lvl: LevelInfo, msg: "three", fields: map[string]interface{}{"request": "GET /"}},
+	}
+	buf := new(bytes.Buffer)
+	for _, l := range lines {
+		outs.Emit(l, buf)
+	}
+	want := strings.Join([]string{
+		"INFO  one a:x",
+		"  request: {",
+		`    "headers": {`,
+		`      "accept": "*/*"`,
+		"    },",
+		`    "method": "GET"`,
+		"  }",
+		"INFO  two a:y",
+		"  request: ↑",
+		"INFO  three",
+		`  request: "GET /"`,
+	}, "\n") + "\n"
+	if diff := cmp.Diff(buf.String(), want); diff != "" {
+		t.Errorf("output:\n%s", diff)
+	}
+}
+
+func TestStacktraceFields(t *testing.T) {
+	outs := &OutputSchema{
+		Formatter: &DefaultOutputFormatter{
+			Aurora:               aurora.NewAurora(false),
+			ElideDuplicateFields: true,
+			StacktraceFields:     []string{"stacktrace", "stack"},
+		},
+		noTime: true,
+		state:  State{lastFields: map[string][]byte{}},
+	}
+	lines := []*line{
+		{lvl: LevelError, msg: "zap", fields: map[string]interface{}{"stacktrace": "main.main\n\t/src/main.go:12\n", "a": "x"}},
+		{lvl: LevelError, msg: "frames", fields: map[string]interface{}{"stack": []interface{}{"main.go:12", "main.go:34"}}},
+		{lvl: LevelError, msg: "not a trace", fields: map[string]interface{}{"stack": float64(42)}},
+		{lvl: LevelError, msg: "one line", fields: map[string]interface{}{"stack": "main.go:12"}},
+		{lvl: LevelError, msg: "object", fields: map[string]interface{}{"stack": map[string]interface{}{"a": float64(1)}}},
+	}
+	buf := new(bytes.Buffer)
+	for _, l := range lines {
+		outs.Emit(l, buf)
+	}
+	want := strings.Join([]string{
+		"ERROR zap a:x",
+		"  stacktrace:",
+		"    main.main",
+		"    \t/src/main.go:12",
+		"ERROR frames",
+		"  stack:",
+		"    main.go:12",
+		"    main.go:34",
+		"ERROR not a trace stack:42",
+		"ERROR one line stack:main.go:12",
+		`ERROR object stack:{"a":1}`,
+	}, "\n") + "\n"
+	if diff := cmp.Diff(buf.String(), want); diff != "" {
+		t.Errorf("output:\n%s", diff)
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -71,6 +72,121 @@ func DefaultTimeParser(in interface{}) (time.Time, error) {
 	}
 }
 
+// EpochTimeParser returns a TimeParser that treats numbers as a count of unit since the Unix epoch,
+// like milliseconds for EpochTimeParser(time.Millisecond).  Anything else is handled by
+// DefaultTimeParser.
+func EpochTimeParser(unit time.Duration) TimeParser {
+	return func(in interface{}) (time.Time, error) {
+		var x float64
+		switch n := in.(type) {
+		case int:
+			x = float64(n)
+		case int64:
+			x = float64(n)
+		case float64:
+			x = n
+		default:
+			return DefaultTimeParser(in)
+		}
+		return float64AsTime(x * float64(unit) / float64(time.Second)), nil
+	}
+}
+
+// LayoutTimeParser returns a TimeParser that parses strings with a time.Parse layout, like
+// "2006-01-02 15:04:05".  Times without a zone are assumed to be in zone.  Local times that happen
+// twice, when daylight saving time ends, are taken to be the first one; ones that don't happen at
+// all, when it starts, are moved as time.Date does.  Anything other than a string is handled by
+// DefaultTimeParser.
+func LayoutTimeParser(layout string, zone *time.Location) TimeParser {
+	return func(in interface{}) (time.Time, error) {
+		x, ok := in.(string)
+		if !ok {
+			return DefaultTimeParser(in)
+		}
+		t, err := time.ParseInLocation(layout, x, zone)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("interpreting string timestamp with layout %q: %v", layout, err)
+		}
+		return t, nil
+	}
+}
+
+// MultiTimeParser returns a TimeParser that tries each of parsers in order, returning the first
+// time that one of them successfully parses.  If none of them can, the error lists why each one
+// failed.
+func MultiTimeParser(parsers ...TimeParser) TimeParser {
+	return func(in interface{}) (time.Time, error) {
+		var errs []string
+		for _, p := range parsers {
+			t, err := p(in)
+			if err == nil {
+				return t, nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return time.Time{}, fmt.Errorf("no time format matched: %s", strings.Join(errs, "; "))
+	}
+}
+
+// JournaldTimeParser parses journald's __REALTIME_TIMESTAMP, a string holding the number of
+// microseconds since the Unix epoch.  Numbers are treated as microseconds too.  Anything else is
+// handled by DefaultTimeParser.
+func JournaldTimeParser(in interface{}) (time.Time, error) {
+	return integerEpochTimeParser(in, time.Microsecond)
+}
+
+// OTLPTimeParser parses the time of an OpenTelemetry log record, nanoseconds since the Unix epoch
+// in a string.  Numbers are treated as nanoseconds too.  Anything else is handled by
+// DefaultTimeParser.
+func OTLPTimeParser(in interface{}) (time.Time, error) {
+	return integerEpochTimeParser(in, time.Nanosecond)
+}
+
+// OTLPSeverityLevelParser maps OpenTelemetry's severity numbers to log levels; 1 through 4 are
+// TRACE, 5 through 8 are DEBUG, and so on up to FATAL.  Strings, like the severity text, are
+// handled by DefaultLevelParser.
+func OTLPSeverityLevelParser(in interface{}) (Level, error) {
+	x, ok := in.(float64)
+	if !ok {
+		if _, isString := in.(string); isString {
+			return DefaultLevelParser(in)
+		}
+		return LevelUnknown, fmt.Errorf("invalid otlp severity %T(%v), want float64", in, in)
+	}
+	switch {
+	case x >= 1 && x <= 4:
+		return LevelTrace, nil
+	case x >= 5 && x <= 8:
+		return LevelDebug, nil
+	case x >= 9 && x <= 12:
+		return LevelInfo, nil
+	case x >= 13 && x <= 16:
+		return LevelWarn, nil
+	case x >= 17 && x <= 20:
+		return LevelError, nil
+	case x >= 21 && x <= 24:
+		return LevelFatal, nil
+	default:
+		return LevelUnknown, fmt.Errorf("invalid otlp severity %v", x)
+	}
+}
+
+// integerEpochTimeParser parses a string holding an integer count of unit since the Unix epoch.
+// Numbers are handled by EpochTimeParser, and other strings by DefaultTimeParser.
+func integerEpochTimeParser(in interface{}, unit time.Duration) (time.Time, error) {
+	x, ok := in.(string)
+	if !ok {
+		return EpochTimeParser(unit)(in)
+	}
+	n, err := strconv.ParseInt(x, 10, 64)
+	if err != nil {
+		return DefaultTimeParser(in)
+	}
+	// Converting to float64 seconds, like EpochTimeParser, would lose the last few digits.
+	perSecond := int64(time.Second / unit)
+	return time.Unix(n/perSecond, n%perSecond*int64(unit)), nil
+}
+
 // LagerLevelParser maps lager's float64 levels to log levels.
 func LagerLevelParser(in interface{}) (Level, error) {
 	x, ok := in.(float64)
@@ -113,6 +229,59 @@ func BunyanV0LevelParser(in interface{}) (Level, error) {
 	return LevelUnknown, fmt.Errorf("invalid bunyan log level %v", x)
 }
 
+// SyslogLevelParser maps syslog's numeric severities (0 through 7) to log levels.  The severity can
+// be a number, or a string holding a number, as journald's PRIORITY field is.
+func SyslogLevelParser(in interface{}) (Level, error) {
+	x, ok := in.(float64)
+	if str, isString := in.(string); isString {
+		n, err := strconv.Atoi(str)
+		x, ok = float64(n), err == nil
+	}
+	if !ok {
+		return LevelUnknown, fmt.Errorf("invalid syslog severity %T(%v), want float64", in, in)
+	}
+	switch x {
+	case 0, 1, 2: // emerg, alert, crit
+		return LevelFatal, nil
+	case 3: // err
+		return LevelError, nil
+	case 4: // warning
+		return LevelWarn, nil
+	case 5, 6: // notice, info
+		return LevelInfo, nil
+	case 7: // debug
+		return LevelDebug, nil
+	default:
+		return LevelUnknown, fmt.Errorf("invalid syslog severity %v", x)
+	}
+}
+
+// ZapNumericLevelParser maps the numeric levels of zapcore.Level to log levels.
+func ZapNumericLevelParser(in interface{}) (Level, error) {
+	x, ok := in.(float64)
+	if !ok {
+		return LevelUnknown, fmt.Errorf("invalid zap log level %T(%v), want float64", in, in)
+	}
+	switch x {
+	case -1:
+		return LevelDebug, nil
+	case 0:
+		return LevelInfo, nil
+	case 1:
+		return LevelWarn, nil
+	case 2:
+		return LevelError, nil
+	case 3:
+		return LevelDPanic, nil
+	case 4:
+		return LevelPanic, nil
+	case 5:
+		return LevelFatal, nil
+	default:
+		return LevelUnknown, fmt.Errorf("invalid zap log level %v", x)
+	}
+}
+
 // DefaultLevelParser uses common strings to determine the log level.  Case does not matter; info is
 // the same log level as INFO.
 func DefaultLevelParser(in interface{}) (Level, error) {
@@ -1,6 +1,7 @@
 package parse
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -33,6 +34,29 @@ func TestTimeParsers(t *testing.T) {
 		{nil, StrictUnixTimeParser, time.Time{}, true},
 		{"1", DefaultTimeParser, time.Time{}, true},
 		{"1", StrictUnixTimeParser, time.Unix(1, 0), false},
+		{int(1500), EpochTimeParser(time.Millisecond), time.Unix(1, 500000000), false},
+		{float64(1500), EpochTimeParser(time.Millisecond), time.Unix(1, 500000000), false},
+		{int64(1500000), EpochTimeParser(time.Microsecond), time.Unix(1, 500000000), false},
+		{float64(1.5), EpochTimeParser(time.Second), time.Unix(1, 500000000), false},
+		{"1970-01-01T00:00:01.000Z", EpochTimeParser(time.Millisecond), time.Unix(1, 0), false},
+		{"1", EpochTimeParser(time.Millisecond), time.Time{}, true},
+		{"1700000000123457", JournaldTimeParser, time.Unix(1700000000, 123457000), false},
+		{float64(1500000), JournaldTimeParser, time.Unix(1, 500000000), false},
+		{"1970-01-01T00:00:01.000Z", JournaldTimeParser, time.Unix(1, 0), false},
+		{"foo", JournaldTimeParser, time.Time{}, true},
+		{"1700000000123456789", OTLPTimeParser, time.Unix(1700000000, 123456789), false},
+		{float64(1e9), OTLPTimeParser, time.Unix(1, 0), false},
+		{"1970-01-01T00:00:01.000Z", OTLPTimeParser, time.Unix(1, 0), false},
+		{"1970-01-01 00:00:01.5", LayoutTimeParser("2006-01-02 15:04:05", time.UTC), time.Unix(1, 500000000), false},
+		{"1969-12-31 19:00:01", LayoutTimeParser("2006-01-02 15:04:05", time.FixedZone("EST", -5*3600)), time.Unix(1, 0), false},
+		{"1970-01-01 04:00:01 +0400", LayoutTimeParser("2006-01-02 15:04:05 -0700", time.UTC), time.Unix(1, 0), false},
+		{float64(1.5), LayoutTimeParser("2006-01-02 15:04:05", time.UTC), time.Unix(1, 500000000), false},
+		{"1970-01-01T00:00:01Z", LayoutTimeParser("2006-01-02 15:04:05", time.UTC), time.Time{}, true},
+		{int(1500), MultiTimeParser(EpochTimeParser(time.Millisecond), LayoutTimeParser("2006-01-02 15:04:05", time.UTC)), time.Unix(1, 500000000), false},
+		{"1970-01-01T00:00:01Z", MultiTimeParser(DefaultTimeParser, LayoutTimeParser("2006-01-02 15:04:05", time.UTC)), time.Unix(1, 0), false},
+		{"1970-01-01 00:00:01", MultiTimeParser(DefaultTimeParser, LayoutTimeParser("Jan _2 15:04:05 2006", time.UTC), LayoutTimeParser("2006-01-02 15:04:05", time.UTC)), time.Unix(1, 0), false},
+		{"yesterday", MultiTimeParser(DefaultTimeParser, LayoutTimeParser("2006-01-02 15:04:05", time.UTC)), time.Time{}, true},
+		{"1", MultiTimeParser(), time.Time{}, true},
 	}
 	for i, test := range testData {
 		got, err := test.parser(test.in)
@@ -47,6 +71,59 @@ func TestTimeParsers(t *testing.T) {
 	}
 }
 
+func TestMultiTimeParserError(t *testing.T) {
+	_, err := MultiTimeParser(DefaultTimeParser, LayoutTimeParser("2006-01-02", time.UTC))("yesterday")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"RFC3339", `layout "2006-01-02"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should mention %s", err.Error(), want)
+		}
+	}
+}
+
+func TestLayoutTimeParserDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	parser := LayoutTimeParser("2006-01-02 15:04:05", ny)
+	testData := []struct {
+		name string
+		in   string
+		want time.Time
+	}{
+		{
+			name: "daylight saving time",
+			in:   "2023-06-12 23:01:02.345",
+			want: time.Date(2023, 6, 13, 3, 1, 2, 345000000, time.UTC),
+		},
+		{
+			name: "standard time",
+			in:   "2023-12-12 23:01:02",
+			want: time.Date(2023, 12, 13, 4, 1, 2, 0, time.UTC),
+		},
+		{
+			// 01:30 happens twice on this day; first in EDT, then again in EST.
+			name: "ambiguous",
+			in:   "2023-11-05 01:30:00",
+			want: time.Date(2023, 11, 5, 5, 30, 0, 0, time.UTC),
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parser(test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("time:\n  got: %v\n want: %v", got.UTC(), test.want)
+			}
+		})
+	}
+}
+
 func TestLevelParsers(t *testing.T) {
 	testData := []struct {
 		in      interface{}
@@ -88,6 +165,37 @@ func TestLevelParsers(t *testing.T) {
 		{float64(60), BunyanV0LevelParser, LevelFatal, false},
 		{"foo", BunyanV0LevelParser, LevelUnknown, true},
 		{float64(61), BunyanV0LevelParser, LevelUnknown, true},
+		{float64(0), SyslogLevelParser, LevelFatal, false},
+		{float64(2), SyslogLevelParser, LevelFatal, false},
+		{float64(3), SyslogLevelParser, LevelError, false},
+		{float64(4), SyslogLevelParser, LevelWarn, false},
+		{float64(5), SyslogLevelParser, LevelInfo, false},
+		{float64(6), SyslogLevelParser, LevelInfo, false},
+		{float64(7), SyslogLevelParser, LevelDebug, false},
+		{float64(8), SyslogLevelParser, LevelUnknown, true},
+		{"info", SyslogLevelParser, LevelUnknown, true},
+		{"3", SyslogLevelParser, LevelError, false},
+		{"6", SyslogLevelParser, LevelInfo, false},
+		{"8", SyslogLevelParser, LevelUnknown, true},
+		{float64(1), OTLPSeverityLevelParser, LevelTrace, false},
+		{float64(8), OTLPSeverityLevelParser, LevelDebug, false},
+		{float64(9), OTLPSeverityLevelParser, LevelInfo, false},
+		{float64(16), OTLPSeverityLevelParser, LevelWarn, false},
+		{float64(17), OTLPSeverityLevelParser, LevelError, false},
+		{float64(24), OTLPSeverityLevelParser, LevelFatal, false},
+		{float64(0), OTLPSeverityLevelParser, LevelUnknown, true},
+		{float64(25), OTLPSeverityLevelParser, LevelUnknown, true},
+		{"WARN", OTLPSeverityLevelParser, LevelWarn, false},
+		{true, OTLPSeverityLevelParser, LevelUnknown, true},
+		{float64(zapcore.DebugLevel), ZapNumericLevelParser, LevelDebug, false},
+		{float64(zapcore.InfoLevel), ZapNumericLevelParser, LevelInfo, false},
+		{float64(zapcore.WarnLevel), ZapNumericLevelParser, LevelWarn, false},
+		{float64(zapcore.ErrorLevel), ZapNumericLevelParser, LevelError, false},
+		{float64(zapcore.DPanicLevel), ZapNumericLevelParser, LevelDPanic, false},
+		{float64(zapcore.PanicLevel), ZapNumericLevelParser, LevelPanic, false},
+		{float64(zapcore.FatalLevel), ZapNumericLevelParser, LevelFatal, false},
+		{float64(6), ZapNumericLevelParser, LevelUnknown, true},
+		{"info", ZapNumericLevelParser, LevelUnknown, true},
 	}
 	for i, test := range testData {
 		got, err := test.parser(test.in)
@@ -4,9 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"math/big"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/itchyny/gojq"
 )
@@ -17,27 +21,122 @@ type FilterScheme struct {
 	MatchRegex   *regexp.Regexp
 	NoMatchRegex *regexp.Regexp
 	Scope        RegexpScope
+
+	// If true, lines that match MatchRegex are highlighted, and lines that don't match it are
+	// kept instead of being filtered out.
+	HighlightMatches bool
+
+	// If set, lines with a level ranked below MinLevel are filtered out.  Lines with an unknown
+	// level are kept.
+	MinLevel Level
+	// If true, lines with an unknown level are filtered out.
+	DropUnknownLevel bool
+	// JQErrorMode controls what ReadLog does when the jq program fails on a line.
+	JQErrorMode JQErrorMode
+	// LevelRanks changes how levels compare to each other, both for MinLevel and the level
+	// variables available to jq programs.
+	LevelRanks LevelRanks
+
+	// If greater than 1, only 1 of every SampleEvery lines that pass the other filters is kept:
+	// the first, then the SampleEvery+1th, and so on.  The rest are filtered out.  Sampling
+	// happens in ReadLog rather than Run, because Run is called concurrently with
+	// InputSchema.Jobs, and the sample has to be taken in input order to be repeatable.
+	SampleEvery int
+	sampleCount int // sampleCount is the number of lines considered for the sample so far.
 }
 
+// sample returns true if a line that passed the other filters should be kept, according to
+// SampleEvery.
+func (f *FilterScheme) sample() bool {
+	if f.SampleEvery <= 1 {
+		return true
+	}
+	keep := f.sampleCount%f.SampleEvery == 0
+	f.sampleCount++
+	return keep
+}
+
+// JQErrorMode controls what ReadLog does when the jq program fails on a line.  Errors are counted
+// no matter what.
+type JQErrorMode int
+
+const (
+	// JQErrorAbort stops reading at the first error.  A program that fails on one line probably
+	// fails on every line, and it's better to find out sooner.
+	JQErrorAbort JQErrorMode = iota
+	// JQErrorSkip reports the error, and shows the line as though there were no jq program.
+	JQErrorSkip
+	// JQErrorRaw reports the error, and prints the line as it was read, like a line that can't
+	// be parsed.
+	JQErrorRaw
+)
+
 // DefaultVariables are variables available to JQ programs.
 var DefaultVariables = []string{
-	"$TS",
-	"$RAW", "$MSG",
+	"$TS", "$LAST_TS",
+	"$RAW", "$MSG", "$ORIG",
+	"$LEVELNAME",
 	"$LVL", "$UNKNOWN", "$TRACE", "$DEBUG", "$INFO", "$WARN", "$ERROR", "$PANIC", "$DPANIC", "$FATAL",
 }
 
-// prepareVariable extracts the variables above from a line.
-func prepareVariables(l *line) []interface{} {
+// prepareVariable extracts the variables above from a line.  orig is the line's fields before any
+// filters ran, for $ORIG.  The level variables are ranked by ranks, so that "$LVL<$WARN" respects
+// any custom ordering.
+func prepareVariables(l *line, orig map[string]interface{}, ranks LevelRanks) []interface{} {
+	var lastTS interface{}
+	if !l.lastTime.IsZero() {
+		lastTS = float64(l.lastTime.UnixNano()) / 1e9
+	}
 	return []interface{}{
-		float64(l.time.UnixNano()) / 1e9, // $TS
-		string(l.raw), l.msg,
-		uint8(l.lvl), uint8(LevelUnknown), uint8(LevelTrace), uint8(LevelDebug), uint8(LevelInfo), uint8(LevelWarn), uint8(LevelError), uint8(LevelPanic), uint8(LevelDPanic), uint8(LevelFatal),
+		float64(l.time.UnixNano()) / 1e9, lastTS, // $TS, $LAST_TS
+		string(l.raw), l.msg, orig,
+		l.lvl.String(),
+		ranks.Rank(l.lvl), ranks.Rank(LevelUnknown), ranks.Rank(LevelTrace), ranks.Rank(LevelDebug), ranks.Rank(LevelInfo), ranks.Rank(LevelWarn), ranks.Rank(LevelError), ranks.Rank(LevelPanic), ranks.Rank(LevelDPanic), ranks.Rank(LevelFatal),
 	}
 }
 
+// builtinDefs are functions available to jq programs that are written in jq.  elapsed and
+// since_prev measure from the previous line in the input, not the previous displayed line, so that
+// select(elapsed > 1) can select anything at all.
+const builtinDefs = `
+def elapsed: if $LAST_TS == null then 0 else $TS - $LAST_TS end;
+def since_prev: if $LAST_TS == null then null else $TS - $LAST_TS end;
+`
+
 // highlightKey is a special key that controls highlighting.
 const highlightKey = "__highlight"
 
+// jqNumber converts a number from a jq program to a float64.
+func jqNumber(name string, v interface{}) (float64, error) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), nil
+	case float64:
+		return x, nil
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(x).Float64()
+		return f, nil
+	default:
+		return 0, fmt.Errorf("%s: input should be a number; not %#v", name, v)
+	}
+}
+
+// humanizeBytes formats a number of bytes with binary units, like "1.5MiB".
+func humanizeBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	u := 0
+	for math.Abs(n) >= 1024 && u < len(units)-1 {
+		n /= 1024
+		u++
+	}
+	return strings.TrimSuffix(strconv.FormatFloat(n, 'f', 1, 64), ".0") + units[u]
+}
+
+// humanizeDuration formats a number of seconds like a time.Duration, like "3.2s" or "1m30s".
+func humanizeDuration(n float64) string {
+	return time.Duration(n * float64(time.Second)).String()
+}
+
 func compileJQ(p string, searchPath []string) (*gojq.Code, error) {
 	if p == "" {
 		return nil, nil
@@ -46,6 +145,11 @@ func compileJQ(p string, searchPath []string) (*gojq.Code, error) {
 	if err != nil {
 		return nil, fmt.Errorf("parsing jq program %q: %v", p, err)
 	}
+	builtins, err := gojq.Parse(builtinDefs + ".")
+	if err != nil {
+		return nil, fmt.Errorf("parsing built-in jq functions: %v", err)
+	}
+	q.FuncDefs = append(builtins.FuncDefs, q.FuncDefs...)
 	jq, err := gojq.Compile(q,
 		gojq.WithFunction("highlight", 1, 1, func(dot interface{}, args []interface{}) interface{} {
 			hl, ok := args[0].(bool)
@@ -57,6 +161,20 @@ func compileJQ(p string, searchPath []string) (*gojq.Code, error) {
 			}
 			return dot
 		}),
+		gojq.WithFunction("humanize_bytes", 0, 0, func(dot interface{}, args []interface{}) interface{} {
+			n, err := jqNumber("humanize_bytes", dot)
+			if err != nil {
+				return err
+			}
+			return humanizeBytes(n)
+		}),
+		gojq.WithFunction("humanize_duration", 0, 0, func(dot interface{}, args []interface{}) interface{} {
+			n, err := jqNumber("humanize_duration", dot)
+			if err != nil {
+				return err
+			}
+			return humanizeDuration(n)
+		}),
 		gojq.WithEnvironLoader(os.Environ),
 		gojq.WithVariables(DefaultVariables),
 		gojq.WithModuleLoader(gojq.NewModuleLoader(searchPath)))
@@ -89,13 +207,13 @@ func (f *FilterScheme) AddJQ(p string, opts *JQOptions) error {
 
 // runJQ runs the provided jq program on the provided line.  It returns true if the result is empty
 // (i.e., the line should be filtered out), and an error if the output type is invalid or another
-// error occurred.
-func (f *FilterScheme) runJQ(l *line) (bool, error) {
+// error occurred.  orig is the fields of the line before any filters ran.
+func (f *FilterScheme) runJQ(l *line, orig map[string]interface{}) (bool, error) {
 	if f.JQ == nil {
 		return false, nil
 	}
 	var filtered bool
-	iter := f.JQ.Run(l.fields, prepareVariables(l)...)
+	iter := f.JQ.Run(l.fields, prepareVariables(l, orig, f.LevelRanks)...)
 	if result, ok := iter.Next(); ok {
 		switch x := result.(type) {
 		case map[string]interface{}:
@@ -105,6 +223,7 @@ func (f *FilterScheme) runJQ(l *line) (bool, error) {
 					l.highlight = hi
 				}
 			}
+			l.preJQ = l.fields
 			l.fields = x
 		case nil:
 			return false, errors.New("unexpected nil result; yield an empty map ('{}') to delete all fields")
@@ -226,6 +345,20 @@ func applyRegexp(rx *regexp.Regexp, l *line, input string) bool {
 // Run runs all the filters defined in this FilterScheme against the provided line.  The return
 // value is true if the line should be removed from the output ("filtered").
 func (f *FilterScheme) Run(l *line) (bool, error) {
+	if f.MinLevel != LevelUnknown && l.lvl != LevelUnknown && f.LevelRanks.Rank(l.lvl) < f.LevelRanks.Rank(f.MinLevel) {
+		return true, nil
+	}
+	if f.DropUnknownLevel && l.lvl == LevelUnknown {
+		return true, nil
+	}
+	// Regexps add their captures to the fields, so save the fields as parsed for $ORIG.
+	var orig map[string]interface{}
+	if f.JQ != nil {
+		orig = make(map[string]interface{}, len(l.fields))
+		for k, v := range l.fields {
+			orig[k] = v
+		}
+	}
 	rxFiltered := false
 	if rx := f.NoMatchRegex; rx != nil {
 		if found := runRegexp(rx, l, f.Scope); found {
@@ -233,11 +366,15 @@ func (f *FilterScheme) Run(l *line) (bool, error) {
 		}
 	}
 	if rx := f.MatchRegex; rx != nil {
-		if found := runRegexp(rx, l, f.Scope); !found {
+		found := runRegexp(rx, l, f.Scope)
+		switch {
+		case found && f.HighlightMatches:
+			l.highlight = true
+		case !found && !f.HighlightMatches:
 			rxFiltered = true
 		}
 	}
-	jqFiltered, err := f.runJQ(l)
+	jqFiltered, err := f.runJQ(l, orig)
 	if err != nil {
 		return false, fmt.Errorf("jq: %w", err)
 	}
@@ -143,6 +143,64 @@ func TestJQ(t *testing.T) {
 			wantLine: referenceLine(),
 			wantErr:  Match("should be a boolean"),
 		},
+		{
+			jq: `.foo |= humanize_bytes | .a = (1572864 | humanize_bytes) | .b = (1024 | humanize_bytes) | .c = (1.5e16 | humanize_bytes)`,
+			l:  referenceLine(),
+			wantLine: &line{
+				msg:    "foo",
+				fields: map[string]interface{}{"foo": "42B", "bar": "hi", "a": "1.5MiB", "b": "1KiB", "c": "13.3PiB"},
+			},
+		},
+		{
+			jq: `.foo |= humanize_duration | .a = (3.2 | humanize_duration) | .b = (0.0015 | humanize_duration)`,
+			l:  referenceLine(),
+			wantLine: &line{
+				msg:    "foo",
+				fields: map[string]interface{}{"foo": "42s", "bar": "hi", "a": "3.2s", "b": "1.5ms"},
+			},
+		},
+		{
+			jq: `.gap = since_prev | .slow = (since_prev > 1)`,
+			l:  &line{time: time.Unix(5, 0), lastTime: time.Unix(3, 500000000), fields: map[string]interface{}{}},
+			wantLine: &line{
+				time:     time.Unix(5, 0),
+				lastTime: time.Unix(3, 500000000),
+				fields:   map[string]interface{}{"gap": 1.5, "slow": true},
+			},
+		},
+		{
+			jq: `.gap = since_prev | .slow = (since_prev > 1)`,
+			l:  &line{time: time.Unix(5, 0), fields: map[string]interface{}{}},
+			wantLine: &line{
+				time:   time.Unix(5, 0),
+				fields: map[string]interface{}{"gap": nil, "slow": false},
+			},
+		},
+		{
+			jq:       `.bar |= humanize_bytes`,
+			l:        referenceLine(),
+			wantLine: referenceLine(),
+			wantErr:  Match("humanize_bytes: input should be a number"),
+		},
+		{
+			jq:       `select($LEVELNAME=="unknown")`,
+			l:        referenceLine(),
+			wantLine: referenceLine(),
+		},
+		{
+			jq:           `select($LEVELNAME=="info")`,
+			l:            referenceLine(),
+			wantLine:     referenceLine(),
+			wantFiltered: true,
+		},
+		{
+			jq: `{orig: $ORIG.foo}`,
+			l:  referenceLine(),
+			wantLine: &line{
+				msg:    "foo",
+				fields: map[string]interface{}{"orig": 42},
+			},
+		},
 	}
 	for _, test := range testData {
 		t.Run(test.jq, func(t *testing.T) {
@@ -150,8 +208,8 @@ func TestJQ(t *testing.T) {
 			if err := fs.AddJQ(test.jq, &JQOptions{SearchPath: test.searchPath}); err != nil {
 				t.Fatal(err)
 			}
-			gotFiltered, gotErr := fs.runJQ(test.l)
-			if diff := cmp.Diff(test.l, test.wantLine, cmp.AllowUnexported(line{}), cmpopts.EquateEmpty()); diff != "" {
+			gotFiltered, gotErr := fs.runJQ(test.l, test.l.fields)
+			if diff := cmp.Diff(test.l, test.wantLine, cmp.AllowUnexported(line{}), cmpopts.IgnoreFields(line{}, "preJQ"), cmpopts.EquateEmpty()); diff != "" {
 				t.Errorf("line: %s", diff)
 			}
 			if got, want := gotFiltered, test.wantFiltered; got != want {
@@ -461,3 +519,161 @@ func TestScopeParsing(t *testing.T) {
 		t.Errorf("expected error")
 	}
 }
+
+func TestHighlightMatches(t *testing.T) {
+	testData := []struct {
+		name          string
+		highlight     bool
+		msg           string
+		wantFiltered  bool
+		wantHighlight bool
+	}{
+		{
+			name:         "filter, match",
+			msg:          "error: foo",
+			wantFiltered: false,
+		},
+		{
+			name:         "filter, no match",
+			msg:          "all is well",
+			wantFiltered: true,
+		},
+		{
+			name:          "highlight, match",
+			highlight:     true,
+			msg:           "error: foo",
+			wantHighlight: true,
+		},
+		{
+			name:      "highlight, no match",
+			highlight: true,
+			msg:       "all is well",
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			f := &FilterScheme{Scope: RegexpScopeMessage, HighlightMatches: test.highlight}
+			if err := f.AddMatchRegex("error"); err != nil {
+				t.Fatal(err)
+			}
+			l := &line{msg: test.msg, fields: map[string]any{}}
+			filtered, err := f.Run(l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := filtered, test.wantFiltered; got != want {
+				t.Errorf("filtered:\n  got: %v\n want: %v", got, want)
+			}
+			if got, want := l.highlight, test.wantHighlight; got != want {
+				t.Errorf("highlight:\n  got: %v\n want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestOrigVariable(t *testing.T) {
+	f := &FilterScheme{Scope: RegexpScopeMessage}
+	if err := f.AddMatchRegex("(?P<word>fo+)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.AddJQ(`{orig: $ORIG, word: .word}`, nil); err != nil {
+		t.Fatal(err)
+	}
+	l := &line{msg: "foo", fields: map[string]interface{}{"a": 1}}
+	if _, err := f.Run(l); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"orig": map[string]interface{}{"a": 1}, "word": "foo"}
+	if diff := cmp.Diff(l.fields, want); diff != "" {
+		t.Errorf("fields:\n%s", diff)
+	}
+}
+
+func TestMinLevel(t *testing.T) {
+	// Treat panic as the most severe level, above fatal, and debug as being as important as info.
+	custom := LevelRanks{LevelPanic: 100, LevelDebug: int(LevelInfo)}
+	testData := []struct {
+		name         string
+		ranks        LevelRanks
+		min, lvl     Level
+		dropUnknown  bool
+		jq           string
+		wantFiltered bool
+	}{
+		{
+			name:         "default order, below",
+			min:          LevelInfo,
+			lvl:          LevelDebug,
+			wantFiltered: true,
+		},
+		{
+			name: "default order, equal",
+			min:  LevelInfo,
+			lvl:  LevelInfo,
+		},
+		{
+			name: "default order, unknown level",
+			min:  LevelInfo,
+			lvl:  LevelUnknown,
+		},
+		{
+			name:         "unknown level dropped",
+			min:          LevelInfo,
+			lvl:          LevelUnknown,
+			dropUnknown:  true,
+			wantFiltered: true,
+		},
+		{
+			name:        "known level not dropped",
+			lvl:         LevelTrace,
+			dropUnknown: true,
+		},
+		{
+			name:  "custom order, tied",
+			ranks: custom,
+			min:   LevelInfo,
+			lvl:   LevelDebug,
+		},
+		{
+			name:         "custom order, below",
+			ranks:        custom,
+			min:          LevelPanic,
+			lvl:          LevelFatal,
+			wantFiltered: true,
+		},
+		{
+			name:  "custom order, above",
+			ranks: custom,
+			min:   LevelFatal,
+			lvl:   LevelPanic,
+		},
+		{
+			name:         "default order in jq",
+			jq:           "select($LVL>$FATAL)",
+			lvl:          LevelPanic,
+			wantFiltered: true,
+		},
+		{
+			name:  "custom order in jq",
+			ranks: custom,
+			jq:    "select($LVL>$FATAL)",
+			lvl:   LevelPanic,
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			f := &FilterScheme{MinLevel: test.min, LevelRanks: test.ranks, DropUnknownLevel: test.dropUnknown}
+			if err := f.AddJQ(test.jq, nil); err != nil {
+				t.Fatal(err)
+			}
+			l := &line{lvl: test.lvl, fields: map[string]any{}}
+			filtered, err := f.Run(l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := filtered, test.wantFiltered; got != want {
+				t.Errorf("filtered:\n  got: %v\n want: %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FooterTopMessages is the number of messages that Summary.Footer lists.
+const FooterTopMessages = 5
+
+// footerMessageWidth is the number of characters of a message that Summary.Footer shows.
+const footerMessageWidth = 80
+
+// Footer returns a report about the displayed lines, for printing once the input has been read:
+// how many lines were at each level, the span of time they cover, the most common messages, and
+// the number of errors.  Times are shown in zone.  Each line is indented by indent.  The
+// statistics are only available if OutputSchema.CollectStats was set; without them, only the
+// error count is reported.
+func (s Summary) Footer(indent string, zone *time.Location) string {
+	result := new(strings.Builder)
+	if len(s.LevelCounts) > 0 {
+		levels := make([]Level, 0, len(s.LevelCounts))
+		width := 0
+		for lvl, n := range s.LevelCounts {
+			levels = append(levels, lvl)
+			if w := len(strconv.Itoa(n)); w > width {
+				width = w
+			}
+		}
+		sort.Slice(levels, func(i, j int) bool { return levels[i] < levels[j] })
+		fmt.Fprintf(result, "%sLevels:\n", indent)
+		for _, lvl := range levels {
+			fmt.Fprintf(result, "%s  %*d  %s\n", indent, width, s.LevelCounts[lvl], lvl)
+		}
+	}
+	if !s.FirstTime.IsZero() {
+		first, last := s.FirstTime, s.LastTime
+		if zone != nil {
+			first, last = first.In(zone), last.In(zone)
+		}
+		fmt.Fprintf(result, "%sTime span: %s to %s (%s)\n", indent, first.Format(time.RFC3339), last.Format(time.RFC3339), last.Sub(first))
+	}
+	if msgs := s.topMessages(); len(msgs) > 0 {
+		width := len(strconv.Itoa(s.MessageCounts[msgs[0]]))
+		fmt.Fprintf(result, "%sTop messages:\n", indent)
+		for _, msg := range msgs {
+			fmt.Fprintf(result, "%s  %*d  %s\n", indent, width, s.MessageCounts[msg], footerMessage(msg))
+		}
+	}
+	fmt.Fprintf(result, "%sErrors: %d\n", indent, s.Errors)
+	return result.String()
+}
+
+// topMessages returns the FooterTopMessages most common messages, most common first.
+func (s Summary) topMessages() []string {
+	msgs := make([]string, 0, len(s.MessageCounts))
+	for msg := range s.MessageCounts {
+		msgs = append(msgs, msg)
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		a, b := msgs[i], msgs[j]
+		if s.MessageCounts[a] != s.MessageCounts[b] {
+			return s.MessageCounts[a] > s.MessageCounts[b]
+		}
+		return a < b
+	})
+	if len(msgs) > FooterTopMessages {
+		msgs = msgs[:FooterTopMessages]
+	}
+	return msgs
+}
+
+type summaryMessageJSON struct {
+	Message string `json:"message"`
+	Lines   int    `json:"lines"`
+}
+
+type summaryJSON struct {
+	Lines       int                  `json:"lines"`
+	Errors      int                  `json:"errors"`
+	Filtered    int                  `json:"filtered"`
+	FieldCounts map[string]int       `json:"field_counts,omitempty"`
+	Schema      *InferredSchema      `json:"schema,omitempty"`
+	Levels      map[string]int       `json:"levels,omitempty"`
+	TopMessages []summaryMessageJSON `json:"top_messages,omitempty"`
+	FirstTime   *time.Time           `json:"first_time,omitempty"`
+	LastTime    *time.Time           `json:"last_time,omitempty"`
+}
+
+// MarshalJSON returns the summary as a JSON object, for scripts, like
+// {"lines":10,"errors":0,"filtered":2}.  Whatever else was collected is included too: the field
+// counts as "field_counts", the inferred schema as "schema", and the statistics for the footer as
+// "levels", "top_messages", "first_time", and "last_time".
+func (s Summary) MarshalJSON() ([]byte, error) {
+	j := summaryJSON{
+		Lines:       s.Lines,
+		Errors:      s.Errors,
+		Filtered:    s.Filtered,
+		FieldCounts: s.FieldCounts,
+		Schema:      s.Schema,
+	}
+	if len(s.LevelCounts) > 0 {
+		j.Levels = make(map[string]int, len(s.LevelCounts))
+		for lvl, n := range s.LevelCounts {
+			j.Levels[lvl.String()] = n
+		}
+	}
+	for _, msg := range s.topMessages() {
+		j.TopMessages = append(j.TopMessages, summaryMessageJSON{Message: msg, Lines: s.MessageCounts[msg]})
+	}
+	if !s.FirstTime.IsZero() {
+		first, last := s.FirstTime, s.LastTime
+		j.FirstTime, j.LastTime = &first, &last
+	}
+	return json.Marshal(j)
+}
+
+// footerMessage makes a message fit on one line of the footer.
+func footerMessage(msg string) string {
+	msg = strings.Join(strings.Fields(msg), " ")
+	if msg == "" {
+		return "(empty)"
+	}
+	if r := []rune(msg); len(r) > footerMessageWidth {
+		return string(r[:footerMessageWidth-1]) + "…"
+	}
+	return msg
+}
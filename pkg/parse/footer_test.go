@@ -0,0 +1,94 @@
+package parse
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFooter(t *testing.T) {
+	input := strings.Join([]string{
+		`{"t":60,"l":"info","m":"request served"}`,
+		`{"t":1,"l":"info","m":"request served"}`,
+		`{"t":30,"l":"warn","m":"slow request"}`,
+		`{"t":90,"l":"error","m":"request failed"}`,
+		`{"t":45,"l":"info","m":"request served"}`,
+		`{"t":50,"l":"debug","m":"request  served\nagain"}`,
+		`{"t":51,"l":"debug","m":"a"}`,
+		`{"t":52,"l":"debug","m":"b"}`,
+		`{"t":53,"l":"debug","m":""}`,
+		`{"t":99,"l":"info","m":"filtered"}`,
+		`this is not json`,
+	}, "\n")
+	fs := new(FilterScheme)
+	if err := fs.AddJQ(`select($MSG != "filtered")`, nil); err != nil {
+		t.Fatal(err)
+	}
+	outs := &OutputSchema{
+		Formatter:    &testFormatter{},
+		CollectStats: true,
+		EmitErrorFn:  func(msg string) {},
+	}
+	sum, err := ReadLog(strings.NewReader(input), io.Discard, basicSchema, outs, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "  Levels:\n" +
+		"    4  debug\n" +
+		"    3  info\n" +
+		"    1  warn\n" +
+		"    1  error\n" +
+		"  Time span: 1970-01-01T00:00:01Z to 1970-01-01T00:01:30Z (1m29s)\n" +
+		"  Top messages:\n" +
+		"    3  request served\n" +
+		"    1  (empty)\n" +
+		"    1  a\n" +
+		"    1  b\n" +
+		"    1  request served again\n" +
+		"  Errors: 1\n"
+	if diff := cmp.Diff(sum.Footer("  ", time.UTC), want); diff != "" {
+		t.Errorf("footer:\n%s", diff)
+	}
+
+	if diff := cmp.Diff((Summary{Errors: 2}).Footer("", nil), "Errors: 2\n"); diff != "" {
+		t.Errorf("footer without stats:\n%s", diff)
+	}
+}
+
+func TestSummaryJSON(t *testing.T) {
+	sum := Summary{
+		Lines:       4,
+		Errors:      1,
+		Filtered:    1,
+		FieldCounts: map[string]int{"a": 2},
+		LevelCounts: map[Level]int{LevelInfo: 1, LevelError: 1},
+		MessageCounts: map[string]int{
+			"hi":  1,
+			"bye": 1,
+		},
+		FirstTime: time.Unix(1, 0).UTC(),
+		LastTime:  time.Unix(90, 0).UTC(),
+	}
+	got, err := json.Marshal(sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"lines":4,"errors":1,"filtered":1,"field_counts":{"a":2},"levels":{"error":1,"info":1},` +
+		`"top_messages":[{"message":"bye","lines":1},{"message":"hi","lines":1}],` +
+		`"first_time":"1970-01-01T00:00:01Z","last_time":"1970-01-01T00:01:30Z"}`
+	if diff := cmp.Diff(string(got), want); diff != "" {
+		t.Errorf("json:\n%s", diff)
+	}
+
+	got, err = json.Marshal(Summary{Lines: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(got), `{"lines":1,"errors":0,"filtered":0}`); diff != "" {
+		t.Errorf("json without stats:\n%s", diff)
+	}
+}
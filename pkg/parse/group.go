@@ -0,0 +1,66 @@
+package parse
+
+import "fmt"
+
+// groupBuffer holds displayed lines until they can be printed grouped by the value of a field, for
+// OutputSchema.GroupBy.  Context separators are dropped, since the lines around them are no longer
+// adjacent once grouped.
+type groupBuffer struct {
+	field  string
+	max    int                     // max is the number of lines to buffer before flushing; 0 means no limit.
+	n      int                     // n is the number of lines buffered.
+	order  []*lineGroup            // order has the groups in the order they first appeared in.
+	groups map[groupKey]*lineGroup // groups has the groups by key.
+}
+
+// groupKey identifies a group.  Lines without the field are in the group with missing set.
+type groupKey struct {
+	value   string
+	missing bool
+}
+
+type lineGroup struct {
+	key   groupKey
+	lines []line
+}
+
+// add buffers a line, and returns true if the buffer is now full.
+func (g *groupBuffer) add(l *line) bool {
+	if l.isSeparator {
+		return false
+	}
+	var key groupKey
+	if v, ok := l.fields[g.field]; ok {
+		key.value = countKey(v)
+	} else {
+		key.missing = true
+	}
+	if g.groups == nil {
+		g.groups = make(map[groupKey]*lineGroup)
+	}
+	group, ok := g.groups[key]
+	if !ok {
+		group = &lineGroup{key: key}
+		g.groups[key] = group
+		g.order = append(g.order, group)
+	}
+	group.lines = append(group.lines, l.clone())
+	g.n++
+	return g.max > 0 && g.n >= g.max
+}
+
+// flush returns the buffered groups, in the order they first appeared in, and empties the buffer.
+func (g *groupBuffer) flush() []*lineGroup {
+	result := g.order
+	g.order, g.groups, g.n = nil, nil, 0
+	return result
+}
+
+// header returns the line printed before the lines of a group, like "=== request_id=1234: 3 lines
+// ===".
+func (g *lineGroup) header(field string) string {
+	if g.key.missing {
+		return fmt.Sprintf("=== no %s: %s ===\n", field, linesSkipped(len(g.lines)))
+	}
+	return fmt.Sprintf("=== %s=%s: %s ===\n", field, g.key.value, linesSkipped(len(g.lines)))
+}
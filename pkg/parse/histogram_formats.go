@@ -0,0 +1,138 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistogramNoTime is the label of the bucket that HistogramFormatter counts lines without a time in.
+const HistogramNoTime = "(no time)"
+
+// maxHistogramGap is the number of empty buckets in a row that HistogramFormatter will print;
+// beyond that, a gap is shown as a single "..." line, so that a tiny interval over a long span of
+// time doesn't print millions of empty lines.
+const maxHistogramGap = 100
+
+// HistogramFormatter counts lines in buckets of time instead of displaying them.  Once the input
+// has been read, it prints a bar chart with one line per bucket, oldest first, like:
+//
+//	2024-01-02T15:04:00Z 412 ##################################################
+//	2024-01-02T15:05:00Z  33 ####
+//
+// Buckets are aligned to multiples of Interval since the zero time, in UTC, so a one-hour bucket
+// starts on the hour.  Empty buckets between the first and last line are shown, to make gaps in the
+// logs visible.  Lines without a time are counted in a separate bucket, printed last.
+type HistogramFormatter struct {
+	Interval   time.Duration  // Interval is the length of time that each bucket covers.
+	Zone       *time.Location // Zone is the time zone to display bucket times in.  If nil, UTC is used.
+	TimeFormat string         // TimeFormat is the layout to display bucket times with.  If empty, RFC3339 is used.
+	Width      int            // Width is the length of the longest bar.  If 0, 50 is used.
+
+	counts map[time.Time]int
+	noTime int
+}
+
+// The individual parts of a line are never displayed.
+func (f *HistogramFormatter) FormatTime(s *State, t time.Time, w *bytes.Buffer)                   {}
+func (f *HistogramFormatter) FormatLevel(s *State, lvl Level, w *bytes.Buffer)                    {}
+func (f *HistogramFormatter) FormatMessage(s *State, msg string, highlight bool, w *bytes.Buffer) {}
+func (f *HistogramFormatter) FormatField(s *State, k string, v interface{}, w *bytes.Buffer)      {}
+
+func (f *HistogramFormatter) formatLine(s *OutputSchema, l *line, w *bytes.Buffer) {
+	if f.counts == nil {
+		f.counts = make(map[time.Time]int)
+	}
+	if l.time.IsZero() || f.Interval <= 0 {
+		f.noTime++
+		return
+	}
+	f.counts[l.time.UTC().Truncate(f.Interval)]++
+}
+
+// Counts returns the number of lines seen in each bucket, keyed by the start of the bucket, in UTC,
+// and the number of lines without a time.
+func (f *HistogramFormatter) Counts() (map[time.Time]int, int) {
+	return f.counts, f.noTime
+}
+
+// histogramRow is one line of the bar chart.
+type histogramRow struct {
+	label string
+	count int
+	gap   bool // If true, this row stands for a run of empty buckets.
+}
+
+func (f *HistogramFormatter) finish(s *OutputSchema, w *bytes.Buffer) {
+	zone := f.Zone
+	if zone == nil {
+		zone = time.UTC
+	}
+	layout := f.TimeFormat
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	width := f.Width
+	if width <= 0 {
+		width = 50
+	}
+
+	buckets := make([]time.Time, 0, len(f.counts))
+	for t := range f.counts {
+		buckets = append(buckets, t)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Before(buckets[j]) })
+
+	var rows []histogramRow
+	for i, t := range buckets {
+		if i > 0 {
+			empty := int(t.Sub(buckets[i-1])/f.Interval) - 1
+			if empty > maxHistogramGap {
+				rows = append(rows, histogramRow{label: "...", gap: true})
+			} else {
+				for j := 1; j <= empty; j++ {
+					rows = append(rows, histogramRow{label: buckets[i-1].Add(time.Duration(j) * f.Interval).In(zone).Format(layout)})
+				}
+			}
+		}
+		rows = append(rows, histogramRow{label: t.In(zone).Format(layout), count: f.counts[t]})
+	}
+	if f.noTime > 0 {
+		rows = append(rows, histogramRow{label: HistogramNoTime, count: f.noTime})
+	}
+	if len(rows) == 0 {
+		return
+	}
+
+	var max, labelWidth int
+	for _, r := range rows {
+		if r.count > max {
+			max = r.count
+		}
+		if n := len(r.label); n > labelWidth {
+			labelWidth = n
+		}
+	}
+	countWidth := len(strconv.Itoa(max))
+	for _, r := range rows {
+		if r.gap {
+			fmt.Fprintf(w, "%s\n", r.label)
+			continue
+		}
+		bar := r.count * width / max
+		if bar == 0 && r.count > 0 {
+			// Every non-empty bucket gets at least some bar, so it can't be mistaken for an
+			// empty one.
+			bar = 1
+		}
+		fmt.Fprintf(w, "%-*s %*d", labelWidth, r.label, countWidth, r.count)
+		if bar > 0 {
+			w.WriteString(" ")
+			w.WriteString(strings.Repeat("#", bar))
+		}
+		w.WriteString("\n")
+	}
+}
@@ -0,0 +1,90 @@
+package parse
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHistogramFormatter(t *testing.T) {
+	testData := []struct {
+		name     string
+		interval time.Duration
+		jq       string
+		input    []string
+		want     string
+	}{
+		{
+			name:     "empty",
+			interval: time.Minute,
+		},
+		{
+			name:     "buckets",
+			interval: time.Minute,
+			input: []string{
+				`{"ts":"2024-01-02T15:04:05Z"}`,
+				`{"ts":"2024-01-02T15:04:59Z"}`,
+				`{"ts":"2024-01-02T15:03:30Z"}`,
+				`{"ts":"2024-01-02T15:04:00Z"}`,
+				`{"ts":"2024-01-02T15:06:00.5Z"}`,
+				`{"msg":"no time"}`,
+			},
+			want: "" +
+				"2024-01-02T15:03:00Z 1 ###\n" +
+				"2024-01-02T15:04:00Z 3 ##########\n" +
+				"2024-01-02T15:05:00Z 0\n" +
+				"2024-01-02T15:06:00Z 1 ###\n" +
+				"(no time)            1 ###\n",
+		},
+		{
+			name:     "long gap",
+			interval: time.Second,
+			input: []string{
+				`{"ts":"2024-01-02T15:00:00Z"}`,
+				`{"ts":"2024-01-02T16:00:00Z"}`,
+			},
+			want: "" +
+				"2024-01-02T15:00:00Z 1 ##########\n" +
+				"...\n" +
+				"2024-01-02T16:00:00Z 1 ##########\n",
+		},
+		{
+			name:     "filtered lines are not counted",
+			interval: time.Hour,
+			jq:       `select(.ok)`,
+			input: []string{
+				`{"ts":"2024-01-02T15:04:05Z","ok":true}`,
+				`{"ts":"2024-01-02T15:04:05Z","ok":false}`,
+			},
+			want: "2024-01-02T15:00:00Z 1 ##########\n",
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			fs := new(FilterScheme)
+			if err := fs.AddJQ(test.jq, nil); err != nil {
+				t.Fatal(err)
+			}
+			w := new(bytes.Buffer)
+			f := &HistogramFormatter{Interval: test.interval, Width: 10}
+			ins := &InputSchema{
+				TimeKey:    "ts",
+				TimeFormat: DefaultTimeParser,
+				Strict:     false,
+			}
+			outs := &OutputSchema{
+				Formatter:   f,
+				EmitErrorFn: func(msg string) { t.Errorf("unexpected error: %v", msg) },
+			}
+			if _, err := ReadLog(strings.NewReader(strings.Join(test.input, "\n")), w, ins, outs, fs); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(w.String(), test.want); diff != "" {
+				t.Errorf("output:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// inferExampleWidth is the number of characters of an example value that Summary.InferredSchema
+// shows.
+const inferExampleWidth = 40
+
+// FieldSchema describes the values that a field was seen with, for Summary.Schema.
+type FieldSchema struct {
+	Lines   int            `json:"lines"`   // Lines is the number of displayed lines that the field appeared on.
+	Types   map[string]int `json:"types"`   // Types is the number of those lines that the value had each JSON type on, like "string" or "number".
+	Example interface{}    `json:"example"` // Example is the first value seen, or the first non-null one if there is one.
+}
+
+// InferredSchema describes the fields of the displayed lines, if OutputSchema.InferSchema is set.
+type InferredSchema struct {
+	Lines  int                     `json:"lines"`  // Lines is the number of displayed lines.
+	Fields map[string]*FieldSchema `json:"fields"` // Fields describes each field that appeared on any of them.
+}
+
+// jsonType returns the name of the JSON type of a value.
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case float64, float32, int, int64, int32, uint, uint64, uint32, json.Number:
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// add records the fields of a displayed line that appeared count times.
+func (s *InferredSchema) add(fields map[string]interface{}, count int) {
+	s.Lines += count
+	for k, v := range fields {
+		f, ok := s.Fields[k]
+		if !ok {
+			f = &FieldSchema{Types: make(map[string]int), Example: v}
+			s.Fields[k] = f
+		} else if f.Example == nil {
+			f.Example = v
+		}
+		f.Lines += count
+		f.Types[jsonType(v)] += count
+	}
+}
+
+// InferredSchema returns a table describing each field in Schema, most common first: its name, the
+// percentage of displayed lines it appeared on, the types its values had (most common first), and
+// an example value, as JSON.  This is a quick way to learn the shape of unfamiliar logs before
+// picking -p fields or writing jq programs.  Each line is indented by indent.  The time, level, and
+// message are not fields, unless they were kept with InputSchema.KeepKeys.
+func (s Summary) InferredSchema(indent string) string {
+	if s.Schema == nil || len(s.Schema.Fields) == 0 {
+		return ""
+	}
+	fields := s.Schema.Fields
+	keys := make([]string, 0, len(fields))
+	nameWidth, typesWidth := len("field"), len("types")
+	types := make(map[string]string, len(fields))
+	for k, f := range fields {
+		keys = append(keys, k)
+		if n := len(k); n > nameWidth {
+			nameWidth = n
+		}
+		names := make([]string, 0, len(f.Types))
+		for t := range f.Types {
+			names = append(names, t)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			a, b := names[i], names[j]
+			if f.Types[a] != f.Types[b] {
+				return f.Types[a] > f.Types[b]
+			}
+			return a < b
+		})
+		types[k] = strings.Join(names, ",")
+		if n := len(types[k]); n > typesWidth {
+			typesWidth = n
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if fields[a].Lines != fields[b].Lines {
+			return fields[a].Lines > fields[b].Lines
+		}
+		return a < b
+	})
+	result := new(strings.Builder)
+	fmt.Fprintf(result, "%s%-*s  %4s  %-*s  %s\n", indent, nameWidth, "field", "fill", typesWidth, "types", "example")
+	for _, k := range keys {
+		f := fields[k]
+		fill := 0
+		if s.Schema.Lines > 0 {
+			fill = f.Lines * 100 / s.Schema.Lines
+		}
+		example, err := json.Marshal(f.Example)
+		if err != nil {
+			example = []byte(fmt.Sprintf("%v", f.Example))
+		}
+		if r := []rune(string(example)); len(r) > inferExampleWidth {
+			example = []byte(string(r[:inferExampleWidth-1]) + "…")
+		}
+		fmt.Fprintf(result, "%s%-*s  %3d%%  %-*s  %s\n", indent, nameWidth, k, fill, typesWidth, types[k], example)
+	}
+	return result.String()
+}
@@ -0,0 +1,56 @@
+package parse
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInferSchema(t *testing.T) {
+	input := strings.Join([]string{
+		`{"t":1,"l":"info","m":"hi","status":200,"route":"/","user":null}`,
+		`{"t":2,"l":"info","m":"hi","status":"200","route":"/a","user":{"id":42,"name":"a very long name that will not fit in the example column"}}`,
+		`{"t":3,"l":"info","m":"hi","status":404,"tags":["a","b"],"ok":true}`,
+		`{"t":4,"l":"info","m":"hi","drop":true}`,
+		`this is not json`,
+	}, "\n")
+	fs := new(FilterScheme)
+	if err := fs.AddJQ("select(.drop|not)", nil); err != nil {
+		t.Fatal(err)
+	}
+	outs := &OutputSchema{
+		Formatter:   &testFormatter{},
+		InferSchema: true,
+		NoRawEcho:   true,
+		EmitErrorFn: func(msg string) {},
+	}
+	sum, err := ReadLog(strings.NewReader(input), io.Discard, modifyBasicSchema(func(s *InputSchema) {}), outs, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sum.Schema.Lines, 3; got != want {
+		t.Errorf("lines: got %v, want %v", got, want)
+	}
+	want := "  field   fill  types          example\n" +
+		"  status  100%  number,string  200\n" +
+		"  route    66%  string         \"/\"\n" +
+		"  user     66%  null,object    {\"id\":42,\"name\":\"a very long name that …\n" +
+		"  ok       33%  bool           true\n" +
+		"  tags     33%  array          [\"a\",\"b\"]\n"
+	if diff := cmp.Diff(sum.InferredSchema("  "), want); diff != "" {
+		t.Errorf("schema:\n%s", diff)
+	}
+
+	sum, err = ReadLog(strings.NewReader(input), io.Discard, modifyBasicSchema(func(s *InputSchema) {}), &OutputSchema{Formatter: &testFormatter{}, NoRawEcho: true, EmitErrorFn: func(msg string) {}}, new(FilterScheme))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Schema != nil {
+		t.Errorf("expected no schema when not inferring one; got %v", sum.Schema)
+	}
+	if got := sum.InferredSchema("  "); got != "" {
+		t.Errorf("expected no report when not inferring a schema; got %q", got)
+	}
+}
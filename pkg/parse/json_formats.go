@@ -0,0 +1,170 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	aurora "github.com/logrusorgru/aurora/v3"
+)
+
+// JSONFormatter formats each log line as a JSON object containing exactly what the default
+// formatter would display: the parsed time, level, and message (as "time", "level", and "msg"),
+// followed by the fields that remain after jq and key deletion.  This is useful for handing a
+// filtered projection of the logs to another program.  Times are formatted as RFC3339 with
+// nanoseconds.  A field whose name collides with one of the parsed values is renamed by prefixing
+// "fields.", as logrus does.
+//
+// Keys are always emitted in a deterministic order, so that the output of two runs over the same
+// input can be diffed: "time", "level", and "msg", then any PriorityFields, then the remaining
+// fields.  Nested objects have their keys sorted.
+type JSONFormatter struct {
+	Zone *time.Location // Zone is the time zone to display the output in.
+
+	// If true, the remaining fields are emitted in the order they were first seen in the input,
+	// as the default formatter displays them, rather than sorted by name.
+	SeenOrder bool
+
+	// If set, the level is colored with ANSI escape sequences inside the JSON string, for viewers
+	// that display them.  Off by default, since it makes the level harder for programs to use.
+	Aurora aurora.Aurora
+
+	// If true, numbers in fields (including those nested inside objects and arrays) are output as
+	// strings, for consumers that can't handle large numbers.  Only the output is affected.
+	NumbersAsStrings bool
+}
+
+// writeJSON marshals v to w, panicking on failure; ReadLog turns the panic into an error for the
+// line.
+func writeJSON(v interface{}, w *bytes.Buffer) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("marshal value: %v", err))
+	}
+	w.Write(value)
+}
+
+func (f *JSONFormatter) FormatTime(s *State, t time.Time, w *bytes.Buffer) {
+	if f.Zone != nil {
+		t = t.In(f.Zone)
+	}
+	writeJSON(t.Format(time.RFC3339Nano), w)
+}
+
+func (f *JSONFormatter) FormatLevel(s *State, lvl Level, w *bytes.Buffer) {
+	if f.Aurora != nil {
+		writeJSON(colorLevel(f.Aurora, lvl, lvl.String()).String(), w)
+		return
+	}
+	writeJSON(lvl.String(), w)
+}
+
+func (f *JSONFormatter) FormatMessage(s *State, msg string, highlight bool, w *bytes.Buffer) {
+	writeJSON(msg, w)
+}
+
+func (f *JSONFormatter) FormatField(s *State, k string, v interface{}, w *bytes.Buffer) {
+	if f.NumbersAsStrings {
+		v = numbersToStrings(v)
+	}
+	writeJSON(v, w)
+}
+
+// numbersToStrings returns a copy of v with every number replaced by its decimal representation as
+// a string.
+func numbersToStrings(v interface{}) interface{} {
+	switch x := v.(type) {
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(x)
+	case json.Number:
+		return x.String()
+	case *big.Int:
+		return x.String()
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(x))
+		for k, v := range x {
+			result[k] = numbersToStrings(v)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(x))
+		for i, v := range x {
+			result[i] = numbersToStrings(v)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+func (f *JSONFormatter) formatLine(outs *OutputSchema, l *line, w *bytes.Buffer) {
+	s := &outs.state
+	needComma := false
+	key := func(k string) {
+		if needComma {
+			w.WriteString(",")
+		}
+		writeJSON(k, w)
+		w.WriteString(":")
+		needComma = true
+	}
+	builtin := map[string]struct{}{}
+	w.WriteString("{")
+	if !outs.noTime && !l.time.IsZero() {
+		builtin["time"] = struct{}{}
+		key("time")
+		f.FormatTime(s, l.time, w)
+	}
+	if !outs.noLevel {
+		builtin["level"] = struct{}{}
+		key("level")
+		f.FormatLevel(s, l.lvl, w)
+	}
+	if !outs.noMessage {
+		builtin["msg"] = struct{}{}
+		key("msg")
+		f.FormatMessage(s, l.msg, l.highlight, w)
+	}
+
+	written := make(map[string]struct{})
+	field := func(k string) {
+		v, ok := l.fields[k]
+		if !ok {
+			return
+		}
+		if _, ok := written[k]; ok {
+			return
+		}
+		written[k] = struct{}{}
+		name := k
+		if _, ok := builtin[k]; ok {
+			name = "fields." + k
+		}
+		key(name)
+		f.FormatField(s, k, v, w)
+	}
+	if f.SeenOrder {
+		for _, k := range outs.fieldOrder(l.fields) {
+			field(k)
+		}
+	} else {
+		for _, k := range outs.PriorityFields {
+			field(k)
+		}
+		keys := make([]string, 0, len(l.fields))
+		for k := range l.fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			field(k)
+		}
+	}
+	w.WriteString("}\n")
+}
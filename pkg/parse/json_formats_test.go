@@ -0,0 +1,199 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/logrusorgru/aurora/v3"
+)
+
+func TestJSONFormatter(t *testing.T) {
+	testData := []struct {
+		name             string
+		ins              *InputSchema
+		jq               string
+		priority         []string
+		seen             bool
+		numbersAsStrings bool
+		input            []string
+		want             []string
+	}{
+		{
+			name: "all fields",
+			input: []string{
+				`{"ts":1,"level":"info","msg":"hello","b":{"nested":[1,2]},"a":1}`,
+				`{"ts":2.5,"level":"warn","msg":"goodbye","a":1}`,
+			},
+			want: []string{
+				`{"time":"1970-01-01T00:00:01Z","level":"info","msg":"hello","a":1,"b":{"nested":[1,2]}}`,
+				`{"time":"1970-01-01T00:00:02.5Z","level":"warn","msg":"goodbye","a":1}`,
+			},
+		},
+		{
+			name:  "only fields visible after jq",
+			jq:    `{a} | select(.a > 1)`,
+			input: []string{`{"ts":1,"level":"info","msg":"hello","a":1,"b":2}`, `{"ts":2,"level":"info","msg":"hello","a":2,"b":2}`},
+			want:  []string{`{"time":"1970-01-01T00:00:02Z","level":"info","msg":"hello","a":2}`},
+		},
+		{
+			name: "deleted keys are not visible",
+			ins: &InputSchema{
+				TimeKey:     "ts",
+				TimeFormat:  DefaultTimeParser,
+				LevelKey:    "level",
+				LevelFormat: DefaultLevelParser,
+				MessageKey:  "msg",
+				DeleteKeys:  []string{"secret"},
+				Strict:      true,
+			},
+			input: []string{`{"ts":1,"level":"info","msg":"hello","secret":"hunter2","a":1}`},
+			want:  []string{`{"time":"1970-01-01T00:00:01Z","level":"info","msg":"hello","a":1}`},
+		},
+		{
+			name:     "priority fields first",
+			priority: []string{"z"},
+			input:    []string{`{"ts":1,"level":"info","msg":"hello","a":1,"z":2}`},
+			want:     []string{`{"time":"1970-01-01T00:00:01Z","level":"info","msg":"hello","z":2,"a":1}`},
+		},
+		{
+			name: "seen order",
+			seen: true,
+			input: []string{
+				`{"ts":1,"level":"info","msg":"hello","b":1}`,
+				`{"ts":2,"level":"info","msg":"hello","a":1,"b":2}`,
+			},
+			want: []string{
+				`{"time":"1970-01-01T00:00:01Z","level":"info","msg":"hello","b":1}`,
+				`{"time":"1970-01-01T00:00:02Z","level":"info","msg":"hello","b":2,"a":1}`,
+			},
+		},
+		{
+			name:  "colliding field names",
+			jq:    `.msg = "field"`,
+			input: []string{`{"ts":1,"level":"info","msg":"hello"}`},
+			want:  []string{`{"time":"1970-01-01T00:00:01Z","level":"info","msg":"hello","fields.msg":"field"}`},
+		},
+		{
+			name: "suppressed time",
+			ins: &InputSchema{
+				NoTimeKey:   true,
+				LevelKey:    "level",
+				LevelFormat: DefaultLevelParser,
+				MessageKey:  "msg",
+				Strict:      true,
+			},
+			input: []string{`{"ts":1,"level":"info","msg":"hello"}`},
+			want:  []string{`{"level":"info","msg":"hello","ts":1}`},
+		},
+		{
+			name:             "numbers as strings",
+			jq:               `select(.n > 1)`,
+			numbersAsStrings: true,
+			input: []string{
+				`{"ts":1,"level":"info","msg":"hello","n":1}`,
+				`{"ts":2,"level":"info","msg":"hello","n":1.5,"id":1234567890123,"o":{"a":[1,"x",true,null]}}`,
+			},
+			want: []string{`{"time":"1970-01-01T00:00:02Z","level":"info","msg":"hello","id":"1234567890123","n":"1.5","o":{"a":["1","x",true,null]}}`},
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			fs := new(FilterScheme)
+			if err := fs.AddJQ(test.jq, nil); err != nil {
+				t.Fatal(err)
+			}
+			ins := test.ins
+			if ins == nil {
+				ins = &InputSchema{Strict: true}
+			}
+			w := new(bytes.Buffer)
+			outs := &OutputSchema{
+				Formatter:      &JSONFormatter{Zone: time.UTC, SeenOrder: test.seen, NumbersAsStrings: test.numbersAsStrings},
+				PriorityFields: test.priority,
+				EmitErrorFn:    func(msg string) { t.Errorf("unexpected error: %v", msg) },
+			}
+			if _, err := ReadLog(strings.NewReader(strings.Join(test.input, "\n")), w, ins, outs, fs); err != nil {
+				t.Fatal(err)
+			}
+			got := strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n")
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("output:\n%s", diff)
+			}
+			for _, l := range got {
+				if !json.Valid([]byte(l)) {
+					t.Errorf("invalid json: %s", l)
+				}
+			}
+		})
+	}
+}
+
+func TestJSONFormatterIsReproducible(t *testing.T) {
+	input := strings.Join([]string{
+		`{"ts":1,"level":"info","msg":"hello","z":1,"y":{"c":1,"b":2,"a":3},"x":[{"q":1,"p":2}],"w":null}`,
+		`{"ts":2,"level":"warn","msg":"hello","m":1,"n":2,"o":3,"z":4,"a":5}`,
+	}, "\n")
+	var first string
+	for i := 0; i < 50; i++ {
+		w := new(bytes.Buffer)
+		outs := &OutputSchema{
+			Formatter:   &JSONFormatter{Zone: time.UTC},
+			EmitErrorFn: func(msg string) { t.Errorf("unexpected error: %v", msg) },
+		}
+		if _, err := ReadLog(strings.NewReader(input), w, &InputSchema{Strict: true}, outs, new(FilterScheme)); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = w.String()
+			continue
+		}
+		if diff := cmp.Diff(w.String(), first); diff != "" {
+			t.Fatalf("run %d differs from the first run:\n%s", i, diff)
+		}
+	}
+	want := `{"time":"1970-01-01T00:00:01Z","level":"info","msg":"hello","w":null,"x":[{"p":2,"q":1}],"y":{"a":3,"b":2,"c":1},"z":1}` + "\n" +
+		`{"time":"1970-01-01T00:00:02Z","level":"warn","msg":"hello","a":5,"m":1,"n":2,"o":3,"z":4}` + "\n"
+	if diff := cmp.Diff(first, want); diff != "" {
+		t.Errorf("output:\n%s", diff)
+	}
+}
+
+func TestJSONFormatterColor(t *testing.T) {
+	testData := []struct {
+		name string
+		f    *JSONFormatter
+		want string
+	}{
+		{
+			name: "off by default",
+			f:    &JSONFormatter{},
+			want: `{"level":"error","msg":"hi","a":1}` + "\n",
+		},
+		{
+			name: "monochrome",
+			f:    &JSONFormatter{Aurora: aurora.NewAurora(false)},
+			want: `{"level":"error","msg":"hi","a":1}` + "\n",
+		},
+		{
+			name: "enabled",
+			f:    &JSONFormatter{Aurora: aurora.NewAurora(true)},
+			want: `{"level":"\u001b[31merror\u001b[0m","msg":"hi","a":1}` + "\n",
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			s := &OutputSchema{Formatter: test.f}
+			got, err := s.FormatLine(time.Time{}, LevelError, "hi", map[string]interface{}{"a": 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(string(got), test.want); diff != "" {
+				t.Errorf("output:\n%s", diff)
+			}
+		})
+	}
+}
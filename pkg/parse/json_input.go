@@ -0,0 +1,117 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// splitJSONPath splits a path like ".items.list" into its keys.  "" and "." refer to the document
+// itself.
+func splitJSONPath(path string) ([]string, error) {
+	if path == "" || path == "." {
+		return nil, nil
+	}
+	if !strings.HasPrefix(path, ".") {
+		return nil, fmt.Errorf("path %q must start with '.'", path)
+	}
+	keys := strings.Split(path[1:], ".")
+	for _, k := range keys {
+		if k == "" {
+			return nil, fmt.Errorf("path %q contains an empty key", path)
+		}
+	}
+	return keys, nil
+}
+
+// seekJSONPath advances the decoder to the value at the provided path.
+func seekJSONPath(dec *json.Decoder, keys []string) error {
+	for i, want := range keys {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("read object containing %q: %w", want, err)
+		}
+		if d, ok := tok.(json.Delim); !ok || d != '{' {
+			return fmt.Errorf("value containing %q: expected an object, got %v", want, tok)
+		}
+		found := false
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return fmt.Errorf("read key: %w", err)
+			}
+			if k, _ := tok.(string); k == want {
+				found = true
+				break
+			}
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("skip value of key %v: %w", tok, err)
+			}
+		}
+		if !found {
+			return fmt.Errorf("key %q not found in .%s", want, strings.Join(keys[:i], "."))
+		}
+	}
+	return nil
+}
+
+// flattenJSONArray decodes the array at path in the document read from r, writing each element to
+// w as a line of compact JSON.
+func flattenJSONArray(r io.Reader, path string, w io.Writer) error {
+	keys, err := splitJSONPath(path)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(r)
+	if err := seekJSONPath(dec, keys); err != nil {
+		return err
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("read array: %w", err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return fmt.Errorf("expected an array, got %v", tok)
+	}
+	buf := new(bytes.Buffer)
+	for dec.More() {
+		var elt json.RawMessage
+		if err := dec.Decode(&elt); err != nil {
+			return fmt.Errorf("read array element: %w", err)
+		}
+		buf.Reset()
+		if err := json.Compact(buf, elt); err != nil {
+			return fmt.Errorf("compact array element: %w", err)
+		}
+		buf.WriteByte('\n')
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("read end of array: %w", err)
+	}
+	return nil
+}
+
+// FlattenJSONArray reads a single JSON document from r and returns a reader that yields each
+// element of the array found at path as one line of JSON, suitable for ReadLog.  The path is a
+// series of object keys, like ".items" for the output of "kubectl get -o json"; "." is the
+// document itself.  Errors, including a missing or malformed path, are returned from Read.  The
+// document is decoded in a background goroutine that runs until r is exhausted or the returned
+// reader is closed.
+func FlattenJSONArray(r io.Reader, path string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		err := flattenJSONArray(r, path, pw)
+		if err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			err = fmt.Errorf("flatten json array at %q: %w", path, err)
+		}
+		pw.CloseWithError(err) //nolint:errcheck // Always returns nil.
+	}()
+	return pr
+}
@@ -0,0 +1,94 @@
+package parse
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFlattenJSONArray(t *testing.T) {
+	testData := []struct {
+		name    string
+		path    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "top-level array",
+			path:  ".",
+			input: `[{"a":1}, {"a":2}]`,
+			want:  "{\"a\":1}\n{\"a\":2}\n",
+		},
+		{
+			name: "nested items",
+			path: ".items",
+			input: `{
+				"apiVersion": "v1",
+				"kind": "List",
+				"metadata": {"items": "not these"},
+				"items": [
+					{"kind": "Pod", "metadata": {"name": "foo"}},
+					{"kind": "Pod", "metadata": {"name": "bar"}}
+				],
+				"after": true
+			}`,
+			want: "{\"kind\":\"Pod\",\"metadata\":{\"name\":\"foo\"}}\n{\"kind\":\"Pod\",\"metadata\":{\"name\":\"bar\"}}\n",
+		},
+		{
+			name:  "deeply nested",
+			path:  ".a.b",
+			input: `{"x":[1,2,3],"a":{"b":[{"c":1}]}}`,
+			want:  "{\"c\":1}\n",
+		},
+		{
+			name:  "empty array",
+			path:  ".items",
+			input: `{"items":[]}`,
+		},
+		{
+			name:    "missing key",
+			path:    ".items",
+			input:   `{"things":[]}`,
+			wantErr: Match(`flatten json array at ".items": key "items" not found`),
+		},
+		{
+			name:    "not an array",
+			path:    ".items",
+			input:   `{"items":{}}`,
+			wantErr: Match(`expected an array`),
+		},
+		{
+			name:    "not an object",
+			path:    ".items",
+			input:   `[]`,
+			wantErr: Match(`expected an object`),
+		},
+		{
+			name:    "invalid path",
+			path:    "items",
+			input:   `{"items":[]}`,
+			wantErr: Match(`must start with '.'`),
+		},
+		{
+			name:    "truncated",
+			path:    ".",
+			input:   `[{"a":1}, {"a":`,
+			want:    "{\"a\":1}\n",
+			wantErr: Match(`read array element: unexpected EOF`),
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := io.ReadAll(FlattenJSONArray(strings.NewReader(test.input), test.path))
+			if diff := cmp.Diff(string(got), test.want); diff != "" {
+				t.Errorf("output:\n%s", diff)
+			}
+			if !comperror(err, test.wantErr) {
+				t.Errorf("error:\n  got: %v\n want: %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package parse
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// LineBuffer stores lines of input for modes that need to see more than one line at a time, like
+// the interactive viewer.  Lines are kept in memory until MemoryLimit bytes are buffered; after
+// that, further lines are written to a temporary file, so that huge inputs don't exhaust memory.
+// Either way, lines are read back with the same methods.  A LineBuffer is not safe for concurrent
+// use, and must be closed to remove the temporary file.
+type LineBuffer struct {
+	// MemoryLimit is the number of bytes of lines to keep in memory before spilling to disk.  If
+	// zero, all lines are kept in memory.
+	MemoryLimit int
+
+	// TempDir is the directory in which to create the spill file.  If empty, os.TempDir is
+	// used.
+	TempDir string
+
+	mem      [][]byte
+	memBytes int
+
+	spill        *os.File
+	spillW       *bufio.Writer
+	spillOffsets []int64 // spillOffsets is the offset of each spilled line in the spill file.
+	spillSize    int64   // spillSize is the number of bytes written to the spill file.
+}
+
+// Add adds a copy of line to the buffer.  The line should not contain a newline.
+func (b *LineBuffer) Add(line []byte) error {
+	if b.spill == nil && (b.MemoryLimit <= 0 || b.memBytes+len(line) <= b.MemoryLimit) {
+		b.mem = append(b.mem, append([]byte(nil), line...))
+		b.memBytes += len(line)
+		return nil
+	}
+	if b.spill == nil {
+		f, err := os.CreateTemp(b.TempDir, "jlog-buffer-*")
+		if err != nil {
+			return fmt.Errorf("create spill file: %w", err)
+		}
+		b.spill = f
+		b.spillW = bufio.NewWriter(f)
+	}
+	b.spillOffsets = append(b.spillOffsets, b.spillSize)
+	n, err := b.spillW.Write(line)
+	b.spillSize += int64(n)
+	if err != nil {
+		return fmt.Errorf("write to spill file: %w", err)
+	}
+	if err := b.spillW.WriteByte('\n'); err != nil {
+		return fmt.Errorf("write to spill file: %w", err)
+	}
+	b.spillSize++
+	return nil
+}
+
+// Len returns the number of lines in the buffer.
+func (b *LineBuffer) Len() int {
+	return len(b.mem) + len(b.spillOffsets)
+}
+
+// Spilled returns the number of lines that have been written to disk.
+func (b *LineBuffer) Spilled() int {
+	return len(b.spillOffsets)
+}
+
+// flush makes all spilled lines readable from the spill file.
+func (b *LineBuffer) flush() error {
+	if b.spillW == nil {
+		return nil
+	}
+	if err := b.spillW.Flush(); err != nil {
+		return fmt.Errorf("flush spill file: %w", err)
+	}
+	return nil
+}
+
+// Line returns the i-th line in the buffer.  The result must not be modified.
+func (b *LineBuffer) Line(i int) ([]byte, error) {
+	if i < 0 || i >= b.Len() {
+		return nil, fmt.Errorf("line %d out of range [0, %d)", i, b.Len())
+	}
+	if i < len(b.mem) {
+		return b.mem[i], nil
+	}
+	if err := b.flush(); err != nil {
+		return nil, err
+	}
+	i -= len(b.mem)
+	end := b.spillSize
+	if i+1 < len(b.spillOffsets) {
+		end = b.spillOffsets[i+1]
+	}
+	buf := make([]byte, end-b.spillOffsets[i])
+	if _, err := b.spill.ReadAt(buf, b.spillOffsets[i]); err != nil {
+		return nil, fmt.Errorf("read spill file: %w", err)
+	}
+	return buf[:len(buf)-1], nil // Remove the newline.
+}
+
+// Each calls f with each line in the buffer, in order, stopping at the first error.  The line
+// passed to f must not be retained or modified.
+func (b *LineBuffer) Each(f func(line []byte) error) error {
+	for _, l := range b.mem {
+		if err := f(l); err != nil {
+			return err
+		}
+	}
+	if b.spill == nil {
+		return nil
+	}
+	if err := b.flush(); err != nil {
+		return err
+	}
+	s := bufio.NewScanner(io.NewSectionReader(b.spill, 0, b.spillSize))
+	s.Buffer(make([]byte, 0, 64*1024), LineBufferSize+1)
+	for s.Scan() {
+		if err := f(s.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("read spill file: %w", err)
+	}
+	return nil
+}
+
+// Reader returns a reader that yields every line currently in the buffer, each followed by a
+// newline, suitable for passing to ReadLog.  Lines added after Reader is called are not included,
+// and may be added while the returned reader is being read from.
+func (b *LineBuffer) Reader() io.Reader {
+	mem := &memLineReader{lines: b.mem}
+	if b.spill == nil {
+		return mem
+	}
+	if err := b.flush(); err != nil {
+		return io.MultiReader(mem, &failingReader{err: err})
+	}
+	return io.MultiReader(mem, io.NewSectionReader(b.spill, 0, b.spillSize))
+}
+
+// Close removes the spill file, if any.  The buffer is empty afterwards.
+func (b *LineBuffer) Close() error {
+	b.mem, b.memBytes = nil, 0
+	if b.spill == nil {
+		return nil
+	}
+	name := b.spill.Name()
+	closeErr := b.spill.Close()
+	b.spill, b.spillW, b.spillOffsets, b.spillSize = nil, nil, nil, 0
+	if err := os.Remove(name); err != nil {
+		return fmt.Errorf("remove spill file: %w", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("close spill file: %w", closeErr)
+	}
+	return nil
+}
+
+// memLineReader reads lines from memory, adding a newline after each one.
+type memLineReader struct {
+	lines   [][]byte
+	pos     int  // pos is the position in the current line.
+	newline bool // newline is true if the current line has been read, but not its newline.
+}
+
+func (r *memLineReader) Read(p []byte) (int, error) {
+	var n int
+	for n < len(p) {
+		if len(r.lines) == 0 {
+			if n == 0 {
+				return 0, io.EOF
+			}
+			return n, nil
+		}
+		if r.newline {
+			p[n] = '\n'
+			n++
+			r.newline = false
+			r.lines = r.lines[1:]
+			r.pos = 0
+			continue
+		}
+		c := copy(p[n:], r.lines[0][r.pos:])
+		n += c
+		r.pos += c
+		if r.pos == len(r.lines[0]) {
+			r.newline = true
+		}
+	}
+	return n, nil
+}
+
+// failingReader is a reader that always fails.
+type failingReader struct{ err error }
+
+func (r *failingReader) Read([]byte) (int, error) { return 0, r.err }
@@ -0,0 +1,138 @@
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLineBuffer(t *testing.T) {
+	lines := []string{"first line", "", "third", "fourth line is long", "5"}
+	testData := []struct {
+		name        string
+		limit       int
+		wantSpilled int
+	}{
+		{name: "unlimited", limit: 0, wantSpilled: 0},
+		{name: "fits exactly", limit: 35, wantSpilled: 0},
+		{name: "spills last line", limit: 34, wantSpilled: 1},
+		{name: "spills after the first two lines", limit: 10, wantSpilled: 3},
+		{name: "spills everything", limit: 1, wantSpilled: 5},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			b := &LineBuffer{MemoryLimit: test.limit, TempDir: dir}
+			for _, l := range lines {
+				buf := []byte(l)
+				if err := b.Add(buf); err != nil {
+					t.Fatalf("add %q: %v", l, err)
+				}
+				copy(buf, strings.Repeat("x", len(buf))) // The buffer must not retain the input.
+			}
+			if got, want := b.Len(), len(lines); got != want {
+				t.Errorf("len:\n  got: %v\n want: %v", got, want)
+			}
+			if got, want := b.Spilled(), test.wantSpilled; got != want {
+				t.Errorf("spilled:\n  got: %v\n want: %v", got, want)
+			}
+
+			var got []string
+			for i := 0; i < b.Len(); i++ {
+				l, err := b.Line(i)
+				if err != nil {
+					t.Fatalf("line %d: %v", i, err)
+				}
+				got = append(got, string(l))
+			}
+			if diff := cmp.Diff(got, lines); diff != "" {
+				t.Errorf("lines by index:\n%s", diff)
+			}
+			if _, err := b.Line(len(lines)); err == nil {
+				t.Error("expected an error reading past the end")
+			}
+
+			got = nil
+			if err := b.Each(func(l []byte) error {
+				got = append(got, string(l))
+				return nil
+			}); err != nil {
+				t.Fatalf("each: %v", err)
+			}
+			if diff := cmp.Diff(got, lines); diff != "" {
+				t.Errorf("lines from each:\n%s", diff)
+			}
+
+			all, err := io.ReadAll(b.Reader())
+			if err != nil {
+				t.Fatalf("read all: %v", err)
+			}
+			if diff := cmp.Diff(string(all), strings.Join(lines, "\n")+"\n"); diff != "" {
+				t.Errorf("lines from reader:\n%s", diff)
+			}
+
+			if err := b.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+			if b.Len() != 0 {
+				t.Error("expected buffer to be empty after close")
+			}
+			files, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) > 0 {
+				t.Errorf("expected spill file to be removed; found %v", files)
+			}
+		})
+	}
+}
+
+func TestLineBufferEachStops(t *testing.T) {
+	b := &LineBuffer{MemoryLimit: 1, TempDir: t.TempDir()}
+	defer b.Close()
+	for i := 0; i < 10; i++ {
+		if err := b.Add([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stop := errors.New("stop")
+	var n int
+	err := b.Each(func(l []byte) error {
+		n++
+		if string(l) == "5" {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("each: unexpected error %v", err)
+	}
+	if got, want := n, 6; got != want {
+		t.Errorf("lines visited:\n  got: %v\n want: %v", got, want)
+	}
+}
+
+func TestMemLineReader(t *testing.T) {
+	r := &memLineReader{lines: [][]byte{[]byte("abc"), nil, []byte("de")}}
+	var got []byte
+	buf := make([]byte, 2) // Smaller than a line, to exercise partial reads.
+	for {
+		n, err := r.Read(buf)
+		got = append(got, buf[:n]...)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := string(got), "abc\n\nde\n"; got != want {
+		t.Errorf("read:\n  got: %q\n want: %q", got, want)
+	}
+}
@@ -0,0 +1,102 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// lineReader splits its input into lines like a bufio.Scanner with bufio.ScanLines, except that
+// lines longer than max bytes are not fatal.  Instead, only the first max bytes of such a line are
+// kept, the rest of it is discarded, and Truncated reports true until the next call to Scan.
+type lineReader struct {
+	r         *bufio.Reader
+	max       int
+	line      []byte
+	truncated bool
+	err       error
+}
+
+func newLineReader(r io.Reader, max int) *lineReader {
+	return &lineReader{
+		r:   bufio.NewReader(r),
+		max: max,
+	}
+}
+
+// Scan advances to the next line, returning false when there are no more lines.
+func (lr *lineReader) Scan() bool {
+	if lr.err != nil {
+		return false
+	}
+	lr.line = lr.line[:0]
+	lr.truncated = false
+	for {
+		chunk, err := lr.r.ReadSlice('\n')
+		var trimmedCR bool
+		if err == nil {
+			// Line endings don't count towards the maximum.
+			chunk = chunk[:len(chunk)-1]
+			if n := len(chunk); n > 0 && chunk[n-1] == '\r' {
+				chunk = chunk[:n-1]
+				trimmedCR = true
+			}
+		}
+		if room := lr.max - len(lr.line); len(chunk) > room {
+			chunk = chunk[:room]
+			lr.truncated = true
+		}
+		lr.line = append(lr.line, chunk...)
+		switch {
+		case err == nil:
+			if !trimmedCR && !lr.truncated {
+				// The \r might have been at the end of the last chunk.
+				lr.line = bytes.TrimSuffix(lr.line, []byte("\r"))
+			}
+			return true
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		default:
+			// Like bufio.Scanner, a final line without a newline is still a line, even
+			// if reading it was interrupted by an error.
+			lr.err = err
+			if !lr.truncated {
+				lr.line = bytes.TrimSuffix(lr.line, []byte("\r"))
+			}
+			return len(lr.line) > 0 || lr.truncated
+		}
+	}
+}
+
+// Bytes returns the current line, without its line ending.  The underlying array may be
+// overwritten by the next call to Scan.
+func (lr *lineReader) Bytes() []byte {
+	return lr.line
+}
+
+// Truncated returns true if the current line was longer than the maximum, and has been truncated.
+func (lr *lineReader) Truncated() bool {
+	return lr.truncated
+}
+
+// Err returns the first non-EOF error that was encountered while reading.
+func (lr *lineReader) Err() error {
+	if errors.Is(lr.err, io.EOF) {
+		return nil
+	}
+	return lr.err
+}
+
+// ReadLines calls f with each line of r, for callers that buffer lines before passing them to
+// ReadLog, like the interactive viewer.  Unlike a bufio.Scanner, a line longer than
+// LineBufferSize doesn't end the input; its start is kept, just long enough that ReadLog still
+// treats it as too long, so that InputSchema.LongLines applies as usual.  The line passed to f may
+// be overwritten after f returns.
+func ReadLines(r io.Reader, f func(line []byte)) error {
+	lr := newLineReader(r, LineBufferSize+1)
+	for lr.Scan() {
+		f(lr.Bytes())
+	}
+	return lr.Err()
+}
@@ -0,0 +1,112 @@
+package parse
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLineReader(t *testing.T) {
+	testData := []struct {
+		name          string
+		input         string
+		max           int
+		want          []string
+		wantTruncated []bool
+	}{
+		{
+			name: "empty",
+			max:  10,
+		},
+		{
+			name:          "lines",
+			input:         "a\nb\r\n\nc",
+			max:           10,
+			want:          []string{"a", "b", "", "c"},
+			wantTruncated: []bool{false, false, false, false},
+		},
+		{
+			name:          "trailing newline",
+			input:         "a\nb\n",
+			max:           10,
+			want:          []string{"a", "b"},
+			wantTruncated: []bool{false, false},
+		},
+		{
+			name:          "exactly the maximum",
+			input:         "abcd\r\nefgh",
+			max:           4,
+			want:          []string{"abcd", "efgh"},
+			wantTruncated: []bool{false, false},
+		},
+		{
+			name:          "long lines",
+			input:         "a\nbcdefg\nh\nijklm",
+			max:           4,
+			want:          []string{"a", "bcde", "h", "ijkl"},
+			wantTruncated: []bool{false, true, false, true},
+		},
+		{
+			name:          "longer than the bufio buffer",
+			input:         strings.Repeat("a", 10000) + "\nb\n",
+			max:           5000,
+			want:          []string{strings.Repeat("a", 5000), "b"},
+			wantTruncated: []bool{true, false},
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			lr := newLineReader(iotest.HalfReader(strings.NewReader(test.input)), test.max)
+			var got []string
+			var gotTruncated []bool
+			for lr.Scan() {
+				got = append(got, string(lr.Bytes()))
+				gotTruncated = append(gotTruncated, lr.Truncated())
+			}
+			if err := lr.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("lines:\n%s", diff)
+			}
+			if diff := cmp.Diff(gotTruncated, test.wantTruncated); diff != "" {
+				t.Errorf("truncated:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLineReaderMatchesScanner(t *testing.T) {
+	input := "a\r\nb\n\n\rc\r\r\nd\r"
+	s := bufio.NewScanner(strings.NewReader(input))
+	var want []string
+	for s.Scan() {
+		want = append(want, s.Text())
+	}
+	lr := newLineReader(strings.NewReader(input), 100)
+	var got []string
+	for lr.Scan() {
+		got = append(got, string(lr.Bytes()))
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("lines:\n%s", diff)
+	}
+}
+
+func TestLineReaderError(t *testing.T) {
+	lr := newLineReader(iotest.TimeoutReader(strings.NewReader("a\nb")), 100)
+	var got []string
+	for lr.Scan() {
+		got = append(got, string(lr.Bytes()))
+	}
+	if diff := cmp.Diff(got, []string{"a", "b"}); diff != "" {
+		t.Errorf("lines:\n%s", diff)
+	}
+	if err := lr.Err(); !errors.Is(err, iotest.ErrTimeout) {
+		t.Errorf("error:\n  got: %v\n want: %v", err, iotest.ErrTimeout)
+	}
+}
@@ -0,0 +1,116 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultMarkdownColumns are the columns that a MarkdownFormatter shows if none are configured.
+var DefaultMarkdownColumns = []string{"time", "level", "msg"}
+
+// MarkdownFormatter formats log lines as the rows of a GitHub-flavored Markdown table, for pasting
+// into issues and documents.
+type MarkdownFormatter struct {
+	// Columns are the names of the columns to output.  "time", "level", and "msg" refer to the
+	// parsed time, level, and message; anything else is the name of a field.  Lines that lack a
+	// field have an empty cell in that column.  If empty, DefaultMarkdownColumns is used.
+	Columns []string
+
+	// The time.Format string to show times in.  If empty, time.RFC3339 is used.
+	AbsoluteTimeFormat string
+
+	Zone *time.Location // Zone is the time zone to display the output in.
+}
+
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>", "\r", "<br>")
+
+// escapeMarkdown makes a string safe to include in a table cell.
+func escapeMarkdown(x string) string {
+	return markdownEscaper.Replace(x)
+}
+
+func (f *MarkdownFormatter) columns() []string {
+	if len(f.Columns) == 0 {
+		return DefaultMarkdownColumns
+	}
+	return f.Columns
+}
+
+func (f *MarkdownFormatter) FormatTime(s *State, t time.Time, w *bytes.Buffer) {
+	if t.IsZero() {
+		return
+	}
+	format := f.AbsoluteTimeFormat
+	if format == "" {
+		format = time.RFC3339
+	}
+	if f.Zone != nil {
+		t = t.In(f.Zone)
+	}
+	w.WriteString(escapeMarkdown(t.Format(format)))
+}
+
+func (f *MarkdownFormatter) FormatLevel(s *State, lvl Level, w *bytes.Buffer) {
+	w.WriteString(lvl.String())
+}
+
+func (f *MarkdownFormatter) FormatMessage(s *State, msg string, highlight bool, w *bytes.Buffer) {
+	msg = escapeMarkdown(msg)
+	if highlight && msg != "" {
+		msg = "**" + msg + "**"
+	}
+	w.WriteString(msg)
+}
+
+func (f *MarkdownFormatter) FormatField(s *State, k string, v interface{}, w *bytes.Buffer) {
+	switch x := v.(type) {
+	case string:
+		w.WriteString(escapeMarkdown(x))
+	default:
+		value, err := json.Marshal(v)
+		if err != nil {
+			panic(fmt.Sprintf("marshal value: %v", err))
+		}
+		w.WriteString(escapeMarkdown(string(value)))
+	}
+}
+
+func (f *MarkdownFormatter) formatLine(outs *OutputSchema, l *line, w *bytes.Buffer) {
+	s := &outs.state
+	columns := f.columns()
+	if !s.wroteHeader {
+		w.WriteString("|")
+		for _, c := range columns {
+			w.WriteString(" ")
+			w.WriteString(escapeMarkdown(c))
+			w.WriteString(" |")
+		}
+		w.WriteString("\n|")
+		for range columns {
+			w.WriteString(" --- |")
+		}
+		w.WriteString("\n")
+		s.wroteHeader = true
+	}
+	w.WriteString("|")
+	for _, c := range columns {
+		w.WriteString(" ")
+		switch c {
+		case "time":
+			f.FormatTime(s, l.time, w)
+		case "level":
+			f.FormatLevel(s, l.lvl, w)
+		case "msg":
+			f.FormatMessage(s, l.msg, l.highlight, w)
+		default:
+			if v, ok := l.fields[c]; ok {
+				f.FormatField(s, c, v, w)
+			}
+		}
+		w.WriteString(" |")
+	}
+	w.WriteString("\n")
+}
@@ -0,0 +1,118 @@
+package parse
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMarkdownFormatter(t *testing.T) {
+	testData := []struct {
+		name    string
+		columns []string
+		jq      string
+		context int
+		input   []string
+		want    []string
+	}{
+		{
+			name: "default columns",
+			input: []string{
+				`{"ts":1,"level":"info","msg":"hello","a":1}`,
+				`{"ts":2,"level":"warn","msg":"goodbye","a":2}`,
+			},
+			want: []string{
+				"| time | level | msg |",
+				"| --- | --- | --- |",
+				"| 1970-01-01T00:00:01Z | info | hello |",
+				"| 1970-01-01T00:00:02Z | warn | goodbye |",
+			},
+		},
+		{
+			name:    "fields",
+			columns: []string{"msg", "a", "b"},
+			input: []string{
+				`{"ts":1,"level":"info","msg":"hello","a":1,"b":"foo"}`,
+				`{"ts":2,"level":"warn","msg":"goodbye","a":{"nested":true}}`,
+			},
+			want: []string{
+				"| msg | a | b |",
+				"| --- | --- | --- |",
+				"| hello | 1 | foo |",
+				`| goodbye | {"nested":true} |  |`,
+			},
+		},
+		{
+			name:    "escaping",
+			columns: []string{"msg", "a|b", "c"},
+			input: []string{
+				`{"ts":1,"level":"info","msg":"a | b\nc","a|b":"|","c":["x|y"]}`,
+			},
+			want: []string{
+				`| msg | a\|b | c |`,
+				"| --- | --- | --- |",
+				`| a \| b<br>c | \| | ["x\|y"] |`,
+			},
+		},
+		{
+			name:  "highlighting",
+			jq:    `highlight(.a == 2)`,
+			input: []string{`{"ts":1,"level":"info","msg":"hello","a":1}`, `{"ts":2,"level":"info","msg":"hello","a":2}`},
+			want: []string{
+				"| time | level | msg |",
+				"| --- | --- | --- |",
+				"| 1970-01-01T00:00:01Z | info | hello |",
+				"| 1970-01-01T00:00:02Z | info | **hello** |",
+			},
+		},
+		{
+			name:    "no separators",
+			columns: []string{"a"},
+			jq:      `select(.a == 1 or .a == 5)`,
+			context: 1,
+			input: []string{
+				`{"ts":1,"level":"info","msg":"hello","a":1}`,
+				`{"ts":2,"level":"info","msg":"hello","a":2}`,
+				`{"ts":3,"level":"info","msg":"hello","a":3}`,
+				`{"ts":4,"level":"info","msg":"hello","a":4}`,
+				`{"ts":5,"level":"info","msg":"hello","a":5}`,
+			},
+			want: []string{
+				"| a |",
+				"| --- |",
+				"| 1 |",
+				"| 2 |",
+				"| 4 |",
+				"| 5 |",
+			},
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			fs := new(FilterScheme)
+			if err := fs.AddJQ(test.jq, nil); err != nil {
+				t.Fatal(err)
+			}
+			w := new(bytes.Buffer)
+			outs := &OutputSchema{
+				Formatter: &MarkdownFormatter{
+					Columns: test.columns,
+					Zone:    time.UTC,
+				},
+				EmitErrorFn:   func(msg string) { t.Errorf("unexpected error: %v", msg) },
+				BeforeContext: test.context,
+				AfterContext:  test.context,
+			}
+			if _, err := ReadLog(strings.NewReader(strings.Join(test.input, "\n")), w, &InputSchema{Strict: true}, outs, fs); err != nil {
+				t.Fatal(err)
+			}
+			got := strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n")
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("output:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// MergeSource is one of the inputs to MergeByTime.
+type MergeSource struct {
+	Label  string    // Label identifies the source in the merged output.
+	Reader io.Reader // Reader provides the source's log lines.
+}
+
+// mergeHead is the next unwritten line of a MergeSource.
+type mergeHead struct {
+	src  MergeSource
+	r    *lineReader
+	line []byte
+	time time.Time
+	ok   bool
+}
+
+// next reads the next line from the source.  Lines without a time sort as though they were
+// logged at the same time as the line before them, so they stay near their neighbors.
+func (h *mergeHead) next(ins *InputSchema) error {
+	if !h.r.Scan() {
+		h.ok = false
+		return h.r.Err()
+	}
+	h.ok = true
+	h.line = append(h.line[:0], h.r.Bytes()...)
+	if p, _ := ins.Parse(h.line); !p.Time.IsZero() {
+		h.time = p.Time
+	}
+	return nil
+}
+
+// MergeByTime reads log lines from each source and returns a reader that yields all of them,
+// interleaved so that times are increasing, for passing to ReadLog.  It assumes that each source is
+// already in order.  Times are parsed according to ins, which is not modified.  Each JSON line has
+// the label of its source added to it as a field named key, unless the line already has such a
+// field; other lines are prefixed with the label.
+//
+// Because the next line from every source must be read before any line can be written, a source
+// with no new lines holds up the others until it ends.  Errors reading a source are returned from
+// Read.  Reading happens in a background goroutine that runs until all sources are exhausted or
+// the returned reader is closed.
+func MergeByTime(ins *InputSchema, key string, sources []MergeSource) io.ReadCloser {
+	// Guessing the schema modifies it, and the caller is going to use ins concurrently.
+	sch := *ins
+	sch.DeleteKeys = append([]string(nil), ins.DeleteKeys...)
+	sch.UpgradeKeys = append([]string(nil), ins.UpgradeKeys...)
+	sch.schemas = nil
+
+	pr, pw := io.Pipe()
+	go func() {
+		err := mergeByTime(&sch, key, sources, pw)
+		if err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			err = fmt.Errorf("merge inputs: %w", err)
+		}
+		pw.CloseWithError(err) //nolint:errcheck // Always returns nil.
+	}()
+	return pr
+}
+
+func mergeByTime(ins *InputSchema, key string, sources []MergeSource, w io.Writer) error {
+	labelKey, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("marshal key: %w", err)
+	}
+	heads := make([]*mergeHead, len(sources))
+	for i, src := range sources {
+		h := &mergeHead{src: src, r: newLineReader(src.Reader, LineBufferSize)}
+		if err := h.next(ins); err != nil {
+			return fmt.Errorf("%s: %w", src.Label, err)
+		}
+		heads[i] = h
+	}
+	buf := new(bytes.Buffer)
+	for {
+		var first *mergeHead
+		for _, h := range heads {
+			// Ties go to the earlier source.
+			if h.ok && (first == nil || h.time.Before(first.time)) {
+				first = h
+			}
+		}
+		if first == nil {
+			return nil
+		}
+		buf.Reset()
+		labelLine(buf, first.line, labelKey, first.src.Label)
+		if _, err := buf.WriteTo(w); err != nil {
+			return fmt.Errorf("write: %w", err)
+		}
+		if err := first.next(ins); err != nil {
+			return fmt.Errorf("%s: %w", first.src.Label, err)
+		}
+	}
+}
+
+// labelLine writes raw to buf, with label added as the first field if it's a JSON object, or as
+// a prefix if not.  JSON objects with duplicate keys take the last value, so an existing field
+// named key is preserved.
+func labelLine(buf *bytes.Buffer, raw, key []byte, label string) {
+	value, err := json.Marshal(label)
+	if err != nil || len(raw) == 0 || raw[0] != '{' {
+		buf.WriteString(label)
+		buf.WriteString(": ")
+		buf.Write(raw)
+		buf.WriteString("\n")
+		return
+	}
+	buf.WriteString("{")
+	buf.Write(key)
+	buf.WriteString(":")
+	buf.Write(value)
+	if rest := bytes.TrimLeft(raw[1:], " \t"); len(rest) == 0 || rest[0] != '}' {
+		buf.WriteString(",")
+	}
+	buf.Write(raw[1:])
+	buf.WriteString("\n")
+}
@@ -0,0 +1,96 @@
+package parse
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// pipeSource returns a MergeSource that reads input from an os.Pipe, like an inherited file
+// descriptor would.
+func pipeSource(t *testing.T, label, input string) MergeSource {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	go func() {
+		io.WriteString(w, input) //nolint:errcheck
+		w.Close()
+	}()
+	return MergeSource{Label: label, Reader: r}
+}
+
+func TestMergeByTime(t *testing.T) {
+	testData := []struct {
+		name   string
+		inputs []string
+		want   string
+	}{
+		{
+			name: "interleaved",
+			inputs: []string{
+				`{"ts":1,"level":"info","msg":"a1"}` + "\n" + `{"ts":3,"level":"info","msg":"a3"}` + "\n",
+				`{"ts":2,"level":"info","msg":"b2"}` + "\n" + `{"ts":4,"level":"info","msg":"b4"}` + "\n",
+			},
+			want: `{"input":"a","ts":1,"level":"info","msg":"a1"}` + "\n" +
+				`{"input":"b","ts":2,"level":"info","msg":"b2"}` + "\n" +
+				`{"input":"a","ts":3,"level":"info","msg":"a3"}` + "\n" +
+				`{"input":"b","ts":4,"level":"info","msg":"b4"}` + "\n",
+		},
+		{
+			name: "ties and untimed lines",
+			inputs: []string{
+				`{"ts":1,"level":"info","msg":"a1"}` + "\n" + "not json\n" + `{}` + "\n" + `{"ts":2,"level":"info","msg":"a2"}` + "\n",
+				`{"ts":1,"level":"info","msg":"b1"}` + "\n",
+			},
+			want: `{"input":"a","ts":1,"level":"info","msg":"a1"}` + "\n" +
+				"a: not json\n" +
+				`{"input":"a"}` + "\n" +
+				`{"input":"b","ts":1,"level":"info","msg":"b1"}` + "\n" +
+				`{"input":"a","ts":2,"level":"info","msg":"a2"}` + "\n",
+		},
+		{
+			name:   "one empty source",
+			inputs: []string{"", `{"ts":1,"level":"info","msg":"b1"}`},
+			want:   `{"input":"b","ts":1,"level":"info","msg":"b1"}` + "\n",
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			var sources []MergeSource
+			for i, input := range test.inputs {
+				sources = append(sources, pipeSource(t, string(rune('a'+i)), input))
+			}
+			ins := new(InputSchema)
+			r := MergeByTime(ins, "input", sources)
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if diff := cmp.Diff(string(got), test.want); diff != "" {
+				t.Errorf("output:\n%s", diff)
+			}
+			if ins.TimeKey != "" {
+				t.Errorf("input schema was modified: time key %q", ins.TimeKey)
+			}
+		})
+	}
+}
+
+func TestMergeByTimeReadError(t *testing.T) {
+	r := MergeByTime(new(InputSchema), "input", []MergeSource{
+		{Label: "good", Reader: strings.NewReader(`{"ts":1,"level":"info","msg":"ok"}` + "\n")},
+		{Label: "bad", Reader: &errReader{err: errors.New("boom")}},
+	})
+	defer r.Close()
+	if _, err := io.ReadAll(r); !comperror(err, Match("merge inputs: bad: boom")) {
+		t.Errorf("error:\n  got: %v\n want: merge inputs: bad: boom", err)
+	}
+}
@@ -0,0 +1,203 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The keys that FlattenOTLPLogs writes a log record's time, severity, and body to.
+const (
+	OTLPTimeKey         = "timeUnixNano"
+	OTLPObservedTimeKey = "observedTimeUnixNano"
+	OTLPSeverityKey     = "severityNumber"
+	OTLPSeverityTextKey = "severityText"
+	OTLPBodyKey         = "body"
+)
+
+// The parts of OTLP/JSON that FlattenOTLPLogs understands.  See
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/logs/v1/logs.proto;
+// 64-bit integers may be written as strings or numbers.
+type otlpLogsData struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []otlpKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []struct {
+			Scope struct {
+				Name string `json:"name"`
+			} `json:"scope"`
+			LogRecords []otlpLogRecord `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         json.Number    `json:"timeUnixNano"`
+	ObservedTimeUnixNano json.Number    `json:"observedTimeUnixNano"`
+	SeverityNumber       json.Number    `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	EventName            string         `json:"eventName"`
+	Body                 *otlpAnyValue  `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes"`
+	TraceID              string         `json:"traceId"`
+	SpanID               string         `json:"spanId"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string      `json:"stringValue"`
+	BoolValue   *bool        `json:"boolValue"`
+	IntValue    *json.Number `json:"intValue"`
+	DoubleValue *json.Number `json:"doubleValue"`
+	BytesValue  *string      `json:"bytesValue"`
+	ArrayValue  *otlpArray   `json:"arrayValue"`
+	KVList      *otlpKVList  `json:"kvlistValue"`
+}
+
+type otlpArray struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+type otlpKVList struct {
+	Values []otlpKeyValue `json:"values"`
+}
+
+// value converts an AnyValue to the plain value it holds.  Bytes stay base64-encoded.
+func (v *otlpAnyValue) value() interface{} {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return *v.IntValue
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.BytesValue != nil:
+		return *v.BytesValue
+	case v.ArrayValue != nil:
+		result := make([]interface{}, len(v.ArrayValue.Values))
+		for i := range v.ArrayValue.Values {
+			result[i] = v.ArrayValue.Values[i].value()
+		}
+		return result
+	case v.KVList != nil:
+		return otlpAttributes(v.KVList.Values)
+	}
+	return nil
+}
+
+func otlpAttributes(kvs []otlpKeyValue) map[string]interface{} {
+	result := make(map[string]interface{}, len(kvs))
+	for i := range kvs {
+		result[kvs[i].Key] = kvs[i].Value.value()
+	}
+	return result
+}
+
+// unsetNumber returns true if a number from OTLP is missing or zero, which both mean "unknown".
+func unsetNumber(n json.Number) bool {
+	return n == "" || n == "0"
+}
+
+// flatten returns a log record as a single flat object.
+func (r *otlpLogRecord) flatten(resource map[string]interface{}, scope string) map[string]interface{} {
+	result := make(map[string]interface{}, len(resource)+len(r.Attributes)+8)
+	for k, v := range resource {
+		result[k] = v
+	}
+	for i := range r.Attributes {
+		result[r.Attributes[i].Key] = r.Attributes[i].Value.value()
+	}
+	if scope != "" {
+		result["scope"] = scope
+	}
+	if r.EventName != "" {
+		result["eventName"] = r.EventName
+	}
+	if r.TraceID != "" {
+		result["traceId"] = r.TraceID
+	}
+	if r.SpanID != "" {
+		result["spanId"] = r.SpanID
+	}
+	// Times are always written as strings, so that they don't lose precision by being read
+	// back as float64s.
+	if !unsetNumber(r.TimeUnixNano) {
+		result[OTLPTimeKey] = r.TimeUnixNano.String()
+	}
+	if !unsetNumber(r.ObservedTimeUnixNano) {
+		result[OTLPObservedTimeKey] = r.ObservedTimeUnixNano.String()
+	}
+	// The severity text is only kept when there's no number, since it's usually just the name
+	// of the number.
+	if !unsetNumber(r.SeverityNumber) {
+		result[OTLPSeverityKey] = r.SeverityNumber
+	} else if r.SeverityText != "" {
+		result[OTLPSeverityTextKey] = r.SeverityText
+	}
+	if r.Body != nil {
+		result[OTLPBodyKey] = r.Body.value()
+	}
+	return result
+}
+
+// flattenOTLPLogs decodes each OTLP/JSON document in r, writing each log record to w as a line of
+// JSON.
+func flattenOTLPLogs(r io.Reader, w io.Writer) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	for {
+		var data otlpLogsData
+		if err := dec.Decode(&data); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("decode logs data: %w", err)
+		}
+		for _, rl := range data.ResourceLogs {
+			resource := otlpAttributes(rl.Resource.Attributes)
+			for _, sl := range rl.ScopeLogs {
+				for i := range sl.LogRecords {
+					buf.Reset()
+					if err := enc.Encode(sl.LogRecords[i].flatten(resource, sl.Scope.Name)); err != nil {
+						return fmt.Errorf("encode log record: %w", err)
+					}
+					if _, err := w.Write(buf.Bytes()); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+}
+
+// FlattenOTLPLogs reads OpenTelemetry logs in the OTLP/JSON encoding from r, like the output of the
+// collector's file exporter, and returns a reader that yields each log record as one line of JSON,
+// suitable for ReadLog.  The input is a series of documents with a "resourceLogs" array.  In each
+// line, the record's attributes, and the attributes of the resource that logged it, become fields,
+// with the record's winning any conflicts.  The time, severity, and body keep their names (like
+// OTLPTimeKey); the name of the instrumentation scope becomes the "scope" field.  Errors are returned
+// from Read.  The input is decoded in a background goroutine that runs until r is exhausted or the
+// returned reader is closed.
+func FlattenOTLPLogs(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		err := flattenOTLPLogs(r, pw)
+		if err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			err = fmt.Errorf("flatten otlp logs: %w", err)
+		}
+		pw.CloseWithError(err) //nolint:errcheck // Always returns nil.
+	}()
+	return pr
+}
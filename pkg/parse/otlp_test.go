@@ -0,0 +1,61 @@
+package parse
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFlattenOTLPLogs(t *testing.T) {
+	testData := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "records",
+			input: `{"resourceLogs":[{
+				"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"api"}},{"key":"host","value":{"stringValue":"a"}}]},
+				"scopeLogs":[{
+					"scope":{"name":"github.com/example/api"},
+					"logRecords":[
+						{"timeUnixNano":"1700000000123456789","observedTimeUnixNano":"1700000000200000000","severityNumber":9,"severityText":"INFO","body":{"stringValue":"hello"},"attributes":[{"key":"host","value":{"stringValue":"b"}},{"key":"count","value":{"intValue":"42"}}],"traceId":"5b8efff798038103d269b633813fc60c","spanId":"eee19b7ec3c1b174"},
+						{"observedTimeUnixNano":1700000001000000000,"timeUnixNano":"0","severityText":"Warning","body":{"kvlistValue":{"values":[{"key":"a","value":{"arrayValue":{"values":[{"boolValue":true},{"doubleValue":1.5}]}}}]}}}
+					]
+				}]
+			}]}
+			{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"body":{"bytesValue":"aGk="}}]}]}]}`,
+			want: `{"body":"hello","count":42,"host":"b","observedTimeUnixNano":"1700000000200000000","scope":"github.com/example/api","service.name":"api","severityNumber":9,"spanId":"eee19b7ec3c1b174","timeUnixNano":"1700000000123456789","traceId":"5b8efff798038103d269b633813fc60c"}` + "\n" +
+				`{"body":{"a":[true,1.5]},"host":"a","observedTimeUnixNano":"1700000001000000000","scope":"github.com/example/api","service.name":"api","severityText":"Warning"}` + "\n" +
+				`{"body":"aGk="}` + "\n",
+		},
+		{
+			name:    "not otlp",
+			input:   `{"resourceLogs":[]}` + "\n" + `{"resourceLogs":"foo"}`,
+			wantErr: Match(`flatten otlp logs: decode logs data: json: cannot unmarshal string`),
+		},
+		{
+			name:    "truncated",
+			input:   `{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"body":{"stringValue":"a"}}]}]}]}{"resourceLogs":[`,
+			want:    `{"body":"a"}` + "\n",
+			wantErr: Match(`unexpected EOF`),
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := io.ReadAll(FlattenOTLPLogs(strings.NewReader(test.input)))
+			if diff := cmp.Diff(string(got), test.want); diff != "" {
+				t.Errorf("output:\n%s", diff)
+			}
+			if !comperror(err, test.wantErr) {
+				t.Errorf("error:\n  got: %v\n want: %v", err, test.wantErr)
+			}
+		})
+	}
+}
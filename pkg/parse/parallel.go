@@ -0,0 +1,148 @@
+package parse
+
+import "sync"
+
+// readParallel reads lines from s, parses and filters them on the given number of goroutines, and
+// calls handle with each line in input order.  handle is always called from the calling goroutine.
+// If handle returns an error, reading stops and the error is returned as err.  Otherwise, any error
+// reading the input is returned as scanErr.
+//
+// Lines are parsed in input order, before being handed to the other goroutines, until the schema
+// has been guessed, because guessing modifies the InputSchema.
+//
+// s belongs to the reading goroutine, and must not be used after readParallel returns.  When
+// reading stops early, that goroutine may still be waiting for the next line, so only the
+// goroutines that use ins and filter are waited for; the reader exits once its line arrives.
+func readParallel(s *lineReader, ins *InputSchema, filter *FilterScheme, jobs int, handle func(*lineItem) error) (scanErr, err error) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	done := make(chan struct{})
+	defer close(done)
+
+	// Items are recycled once they've been handled, so that their buffers and field maps can be
+	// reused.
+	items := sync.Pool{
+		New: func() interface{} { return new(lineItem) },
+	}
+	read := make(chan *lineItem, jobs)
+	var readErr error // readErr is set by the reader before it closes read.
+	go func() {
+		defer close(read)
+		for {
+			// Don't start waiting for another line once we're done.
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if !s.Scan() {
+				readErr = s.Err()
+				return
+			}
+			it := items.Get().(*lineItem)
+			it.reset()
+			it.rawBuf = append(it.rawBuf[:0], s.Bytes()...)
+			it.l.raw = it.rawBuf
+			it.truncated = s.Truncated()
+			select {
+			case read <- it:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var times timeTracker
+	guess := func(it *lineItem) {
+		if ins.canGuessSchema() {
+			it.parse(ins)
+		}
+	}
+	parsed := runOrdered(&wg, done, read, jobs, guess, func(it *lineItem) { it.parse(ins) })
+	filtered := runOrdered(&wg, done, parsed, jobs, func(it *lineItem) { times.track(ins, it) }, func(it *lineItem) { it.filter(ins, filter) })
+	for it := range filtered {
+		if err := handle(it); err != nil {
+			return nil, err
+		}
+		items.Put(it)
+	}
+	return readErr, nil
+}
+
+// runOrdered calls f on each item from in, using the given number of goroutines, and returns a
+// channel that receives the items in the order they arrived after f has returned.  If before is
+// non-nil, it is called on each item in order before f.  Everything stops when done is closed, and
+// in is closed; wg is done once every goroutine has exited.
+func runOrdered(wg *sync.WaitGroup, done <-chan struct{}, in <-chan *lineItem, jobs int, before, f func(*lineItem)) <-chan *lineItem {
+	type job struct {
+		it    *lineItem
+		ready chan struct{}
+	}
+	work := make(chan job, jobs)
+	pending := make(chan job, 2*jobs)
+	out := make(chan *lineItem, jobs)
+
+	wg.Add(2 + jobs)
+	go func() {
+		defer wg.Done()
+		defer close(pending)
+		defer close(work)
+		for {
+			var it *lineItem
+			select {
+			case next, ok := <-in:
+				if !ok {
+					return
+				}
+				it = next
+			case <-done:
+				// in might not be closed for a while, if its sender is waiting for input.
+				return
+			}
+			if before != nil {
+				before(it)
+			}
+			j := job{it: it, ready: make(chan struct{})}
+			// The job is queued for ordering before it's handed to a worker, so that the
+			// orderer never waits on a job that no worker will pick up.
+			select {
+			case pending <- j:
+			case <-done:
+				return
+			}
+			select {
+			case work <- j:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < jobs; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range work {
+				f(j.it)
+				close(j.ready)
+			}
+		}()
+	}
+
+	go func() {
+		defer wg.Done()
+		defer close(out)
+		for j := range pending {
+			select {
+			case <-j.ready:
+			case <-done:
+				return
+			}
+			select {
+			case out <- j.it:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -8,8 +8,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
+	"reflect"
+	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/logrusorgru/aurora/v3"
@@ -38,17 +43,78 @@ const (
 	LevelFatal
 )
 
-// LineBufferSize is the longest we're willing to look for a newline in the input.
+// String returns the lowercase name of the level, like "info".
+func (l Level) String() string {
+	switch l {
+	case LevelTrace:
+		return "trace"
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	case LevelPanic:
+		return "panic"
+	case LevelDPanic:
+		return "dpanic"
+	case LevelFatal:
+		return "fatal"
+	default:
+		return "unknown"
+	}
+}
+
+// LevelRanks assigns a severity rank to levels, for comparing them in ways other than the order of
+// the Level constants.  Levels that aren't in the map are ranked by their numeric value, so
+// LevelRanks{LevelInfo: 3, LevelWarn: 3} treats info and warn as equally severe without changing
+// anything else.
+type LevelRanks map[Level]int
+
+// Rank returns the severity rank of the provided level.
+func (r LevelRanks) Rank(l Level) int {
+	if rank, ok := r[l]; ok {
+		return rank
+	}
+	return int(l)
+}
+
+// implausibleTimeJump is how far apart the times on consecutive lines can be before ReadLog warns
+// that the input might be mixing units of time since the epoch.
+const implausibleTimeJump = 365 * 24 * time.Hour
+
+// LineBufferSize is the longest line we're willing to read from the input.  Longer lines are
+// handled according to InputSchema.LongLines.
 const LineBufferSize = 1 * 1024 * 1024 // 1 MiB
 
+// LongLineAction is what ReadLog does with a line longer than LineBufferSize.  Such lines are
+// always counted as errors.
+type LongLineAction int
+
+const (
+	LongLineSkip     LongLineAction = iota // Skip the line and continue.
+	LongLineTruncate                       // Print the start of the line, unparsed, and continue.
+	LongLineError                          // Stop reading and return an error.
+)
+
 // InputSchema controls the interpretation of incoming log lines.
 type InputSchema struct {
 	TimeKey     string      // The name of the key that holds the timestamp.
 	TimeFormat  TimeParser  // How to turn the value of the time key into a time.Time.
 	LevelKey    string      // The name of the key that holds the log level.
 	LevelFormat LevelParser // How to turn the value of the level key into a Level.
+	LevelSubkey string      // If the level key holds an object, the key inside it that holds the level.
 	MessageKey  string      // The name of the key that holds the main log message.
 
+	// Other keys to look for the time, level, or message in, in order, when a line lacks
+	// TimeKey, LevelKey, or MessageKey.  This is for input from programs that don't agree on
+	// what to call those keys.
+	AltTimeKeys    []string
+	AltLevelKeys   []string
+	AltMessageKeys []string
+
 	NoTimeKey    bool // If set, suppress any time handling.
 	NoLevelKey   bool // If set, suppress any level handling.
 	NoMessageKey bool // If set, suppress any message handling.
@@ -57,13 +123,93 @@ type InputSchema struct {
 	// as normal messages with as much information extracted as possible.
 	Strict bool
 
+	// If true, stop reading at the first line that isn't a JSON object, and return an error.
+	// This is for validating that the input is entirely JSON, and applies even when Strict is
+	// false.
+	AbortOnInvalidJSON bool
+
 	// DeleteKeys is a list of keys to delete; used when the log lines contain version
-	// information that is used for guessing the schema.
+	// information that is used for guessing the schema.  Keys containing *, ?, or [ are glob
+	// patterns, as in path.Match, so "debug.*" deletes every key starting with "debug.".  Unlike
+	// path.Match, * and ? match '/', so "kubernetes.*" deletes "kubernetes.io/name".  Keys
+	// are deleted after UpgradeKeys are merged, so merged keys can be deleted too.
 	DeleteKeys []string
 
 	// UpgradeKeys is a list of keys to merge into the raw data.  For example, lager puts
-	// everything in the "data" key.
+	// everything in the "data" key.  A dotted path like "data.request" names a key inside
+	// another object, unless there's a top-level key with that exact name.  The merged object
+	// is removed from its parent, along with any parents left empty.
 	UpgradeKeys []string
+
+	// RenameKeys maps keys to the names that they're displayed under, after UpgradeKeys and
+	// DeleteKeys are applied.  The renames all happen at once, so a->b and b->a swaps the
+	// values.  If a new name is already taken, it's overwritten; if several keys are renamed to
+	// the same name, the value of the key that sorts last wins.
+	RenameKeys map[string]string
+
+	// If true, display keys in lower case, after RenameKeys is applied, for loggers like
+	// journald that shout.  If a key's lower case version is already taken, the key is left as
+	// it is; among several keys with the same lower case version, the first in sorted order
+	// gets it.
+	LowercaseKeys bool
+
+	// If true, a message that ends with a JSON object, like `request completed {"status":200}`,
+	// has the object removed, and its keys merged into the fields, as if it had been in a key
+	// named in UpgradeKeys.  Nothing is changed unless the object is valid JSON.
+	ParseMessageJSON bool
+
+	// ParseJSONFields is a list of keys whose values may be JSON objects or arrays that were
+	// encoded as strings, like "payload":"{\"a\":1}".  Such strings are replaced with the values
+	// they encode, before UpgradeKeys is applied; anything else is left alone.
+	ParseJSONFields []string
+
+	// PreserveKeys is a list of keys that remain fields after their value has been extracted as
+	// the time, level, or message.  Normally those keys are removed.
+	PreserveKeys []string
+
+	// UnknownLevel is the level given to lines whose level is missing or unrecognized.  The
+	// default is LevelUnknown.
+	UnknownLevel Level
+
+	// If true, lines without a time, or with one that can't be parsed, aren't errors.  They have
+	// no time, and an unparseable time is kept as a field.  This is finer-grained than turning
+	// off Strict.
+	LenientTime bool
+
+	// If true, remove ANSI escape sequences, like color codes, from the message and from string
+	// fields.  Some programs log text meant for a terminal, and the codes would otherwise be
+	// printed literally.
+	StripANSI bool
+
+	// If true, remove trailing newlines from messages.  Docker's json-file log driver keeps the
+	// newline that ended each line of output, for example.
+	TrimMessage bool
+
+	// LevelFromMessage, if set, finds the level in the message of lines that lack a level key,
+	// for loggers that write messages like "[INFO] starting up".  The text matched by the named
+	// capture group "level" is parsed with DefaultLevelParser.
+	LevelFromMessage *regexp.Regexp
+
+	// If true, remove the text matched by LevelFromMessage from the message.
+	StripLevelFromMessage bool
+
+	// schemas are the schemas recognized so far in MultiSchema mode.
+	schemas []knownSchema
+
+	// If true, guess the schema of each line separately, for input that mixes formats.
+	// Normally, the schema guessed from the first recognizable line is used for every line after
+	// it.  Recognized schemas are remembered, and each line is parsed with the one that fits it
+	// best, only guessing again when none fit.  Has no effect if the schema is explicitly
+	// configured.
+	MultiSchema bool
+
+	// LongLines controls what happens to lines longer than LineBufferSize.
+	LongLines LongLineAction
+
+	// Jobs is the number of goroutines that ReadLog parses and filters lines on.  Output is
+	// still written in input order.  Values less than 2 read the log sequentially, as do
+	// outputs that show context or elide duplicate fields.
+	Jobs int
 }
 
 // OutputFormatter describes an object that actually does the output formatting.  Methods take a
@@ -83,6 +229,51 @@ type OutputFormatter interface {
 	FormatField(s *State, k string, v interface{}, w *bytes.Buffer)
 }
 
+// lineFormatter is implemented by OutputFormatters that lay out an entire line themselves, like
+// tables, rather than having Emit print the level, time, message, and fields separated by spaces.
+type lineFormatter interface {
+	formatLine(s *OutputSchema, l *line, w *bytes.Buffer)
+}
+
+// columnFormatter is implemented by OutputFormatters that can show some fields as aligned columns,
+// between the time and the message, instead of as key:value pairs after the message.
+type columnFormatter interface {
+	columns() []string
+	formatColumn(s *State, k string, v interface{}, ok bool, w *bytes.Buffer)
+}
+
+// expandingFormatter is implemented by OutputFormatters that can show some fields in full,
+// underneath the formatted line, instead of as key:value pairs after the message.
+// expandedFields returns the fields of a line that are shown that way.
+type expandingFormatter interface {
+	expandedFields(fields map[string]interface{}) []string
+	formatExpanded(s *State, k string, v interface{}, w *bytes.Buffer)
+}
+
+// prefixFormatter is implemented by OutputFormatters that mark the start of each line with
+// something based on its fields, before the level.
+type prefixFormatter interface {
+	formatPrefix(s *State, fields map[string]interface{}, w *bytes.Buffer)
+}
+
+// finishingFormatter is implemented by OutputFormatters that have something to print once all the
+// input has been read, like aggregations.
+type finishingFormatter interface {
+	finish(s *OutputSchema, w *bytes.Buffer)
+}
+
+// originalFormatter is implemented by OutputFormatters that can show the original input of a line
+// that a jq program changed, underneath the formatted line.
+type originalFormatter interface {
+	formatOriginal(s *State, raw []byte, w *bytes.Buffer)
+}
+
+// lineHighlighter is implemented by OutputFormatters that can restyle an entire formatted line
+// (without its trailing newline) based on its level.
+type lineHighlighter interface {
+	highlightLine(lvl Level, line []byte) []byte
+}
+
 // State keeps state between log lines.
 type State struct {
 	// seenFields maintains an ordering of all fields, so that they are consistent between log
@@ -93,8 +284,26 @@ type State struct {
 	timePadding int
 	// lastFields is the value of each field that was most recently seen.
 	lastFields map[string][]byte
+	// elidedLines is the number of lines in a row that each field has been elided on, if
+	// elided values are periodically shown again.
+	elidedLines map[string]int
 	// lastTime is the time of the last log line.
 	lastTime time.Time
+	// columnWidths is the width of each column, for columns that grow to fit their values.
+	columnWidths map[string]int
+	// lineNumberWidth is the width of the widest line number printed so far.
+	lineNumberWidth int
+	// firstTime is the time of the first log line with a time, if relative times are based on
+	// it.
+	firstTime time.Time
+	// wroteHeader is true once a formatter that outputs a header has done so.
+	wroteHeader bool
+	// fieldCounts is the number of displayed lines each field has appeared on, if counting.
+	fieldCounts map[string]int
+	// schema is the schema that displayed lines are added to, if inferring one.
+	schema *InferredSchema
+	// stats is the summary that statistics about displayed lines are added to, if collecting.
+	stats *Summary
 }
 
 // OutputSchema controls how output lines are formatted.
@@ -105,13 +314,101 @@ type OutputSchema struct {
 	BeforeContext  int              // Context lines to print before a match.
 	AfterContext   int              // Context lines to print after a match.
 
+	// If true, count how many displayed lines each field appears on, for Summary.FieldCounts.
+	CountFields bool
+
+	// If true, keep track of the types and an example value of each field on the displayed
+	// lines, for Summary.InferredSchema.
+	InferSchema bool
+
+	// If true, each line is prefixed with its line number in the input.  Formatters that
+	// format entire lines themselves don't show line numbers.
+	LineNumbers bool
+
+	// If true, separators between context regions say how many lines were skipped, like "---
+	// 1,240 lines ---", instead of just "---".
+	ContextSeparatorStats bool
+
+	// If true, lines that can't be parsed (or that cause errors while filtering or formatting)
+	// are only reported with EmitErrorFn, and not also copied to the output as-is.
+	NoRawEcho bool
+
+	// If true, lines that aren't JSON are copied to the output exactly as they were read, even
+	// when InputSchema.Strict is false, instead of being displayed as the message of an
+	// otherwise empty line.  Like lines that can't be parsed in strict mode, they aren't
+	// filtered.  Good for logs with plain text banners mixed in.
+	PassthroughNonJSON bool
+
+	// If true, fields other than PriorityFields are sorted by name on every line, rather than
+	// being displayed in the order they were first seen in.  Columns are predictable, but a field
+	// may move around between lines as other fields come and go.
+	SortFields bool
+
+	// FieldSort controls the order that fields not ordered by PriorityFields or by past lines
+	// are displayed in.  The default is to sort them by name.
+	FieldSort FieldSort
+
+	// If true, collect statistics about the displayed lines for Summary.Footer: how many were at
+	// each level, how many had each message, and the span of time they cover.
+	CollectStats bool
+
+	// If true, lines whose fields were changed by a jq program are followed by the original
+	// input, if the formatter supports it.
+	ShowOriginal bool
+
+	// If positive, ReadLog gives up once the same error has been repeated this many times in a
+	// row, even if errors aren't being printed; the same parse error on every line usually means
+	// that the schema is wrong.
+	MaxErrorRepeats int
+
+	// If positive, ReadLog stops reading once this many lines have been displayed.
+	Head int
+	// If positive, only the last Tail lines that would have been displayed are displayed, once
+	// the input has been read.
+	Tail int
+
+	// If true, a run of consecutive lines with the same level, message, and fields is displayed
+	// as its first line, with a count like "(x20)" at the end.  Times aren't compared, and the
+	// first line's time is shown.  Since a run only ends when a different line arrives, each
+	// line is displayed late.  Formatters that format entire lines themselves don't dedupe.
+	Dedupe bool
+
+	// If set, displayed lines are grouped by the value of this field, like all the lines of a
+	// request.  Lines are buffered until the input has been read, then each group is printed
+	// together, in the order the groups first appeared in, under a header like "===
+	// request_id=1234: 3 lines ===".  Lines without the field are grouped together.  Since the
+	// entire input is held in memory, set GroupWindow for large or endless inputs.  Context
+	// separators are dropped, Head counts lines as they're printed, and formatters that format
+	// entire lines themselves don't group.
+	GroupBy string
+	// If positive, at most this many lines are buffered for GroupBy; once that many have been,
+	// the groups so far are printed, and grouping starts over.  A group may then be printed more
+	// than once.
+	GroupWindow int
+
 	suppressionConfigured, noTime, noLevel, noMessage bool
 	state                                             State // state carries context between lines
+
+	// lastError is the last error emitted, and errorRepeats is how many times it has been
+	// repeated since.
+	lastError    string
+	errorRepeats int
 }
 
 // EmitError prints any internal errors, so that log lines are not silently ignored if they are
-// unparseable.
+// unparseable.  An error identical to the one before it is only counted, and the count is printed
+// once a different error comes along or ReadLog finishes.
 func (s *OutputSchema) EmitError(msg string) {
+	if msg == s.lastError {
+		s.errorRepeats++
+		return
+	}
+	s.flushErrors()
+	s.lastError = msg
+	s.emitError(msg)
+}
+
+func (s *OutputSchema) emitError(msg string) {
 	if s.EmitErrorFn == nil {
 		os.Stderr.WriteString("  ↳ " + msg + "\n")
 	} else {
@@ -119,6 +416,14 @@ func (s *OutputSchema) EmitError(msg string) {
 	}
 }
 
+// flushErrors prints how many times the last error was repeated, if it was.
+func (s *OutputSchema) flushErrors() {
+	if s.errorRepeats > 0 {
+		s.emitError(fmt.Sprintf("(repeated %d more times)", s.errorRepeats))
+	}
+	s.lastError, s.errorRepeats = "", 0
+}
+
 // line represents one log line.
 type line struct {
 	time        time.Time
@@ -128,21 +433,249 @@ type line struct {
 	highlight   bool
 	fields      map[string]interface{}
 	isSeparator bool // If true, this is not a line but a separator from context.
+	skipped     int  // For separators, the number of lines between the context regions.
+	number      int  // The line number in the input; for separators, the first line skipped.
+	invalidJSON bool // If true, the raw line could not be parsed as a JSON object.
+	isRaw       bool // If true, the line is displayed exactly as it was read.
+	repeats     int  // With OutputSchema.Dedupe, the number of times the line was repeated.
+
+	// lastTime is the time of the previous line in the input that had a time, for filters to
+	// compare against.
+	lastTime time.Time
+
+	// preJQ is the fields as they were before a jq program replaced them, if one did.
+	preJQ map[string]interface{}
+
+	// ownFields is the map that reset allocated for fields.  It's cleared and reused for the
+	// next line, rather than allocating a new one.  jq can replace fields with a map that it
+	// owns, so only this map is ever cleared.
+	ownFields map[string]interface{}
+}
+
+// ParsedLine is a log line after being parsed by an InputSchema.  It is the exported equivalent
+// of the internal representation used by ReadLog.
+type ParsedLine struct {
+	Time    time.Time              // The time the line was logged at, or the zero time if unknown.
+	Level   Level                  // The log level.
+	Message string                 // The message.
+	Fields  map[string]interface{} // Any fields that aren't the time, level, or message.
+	Raw     []byte                 // The input that was parsed.
+}
+
+// toParsedLine converts an internal line to a ParsedLine.  The fields and raw data are shared.
+func (l *line) toParsedLine() ParsedLine {
+	return ParsedLine{
+		Time:    l.time,
+		Level:   l.lvl,
+		Message: l.msg,
+		Fields:  l.fields,
+		Raw:     l.raw,
+	}
+}
+
+// fromParsedLine converts a ParsedLine to an internal line.  The fields and raw data are shared.
+func fromParsedLine(p ParsedLine) *line {
+	return &line{
+		time:   p.Time,
+		lvl:    p.Level,
+		msg:    p.Message,
+		fields: p.Fields,
+		raw:    p.Raw,
+	}
+}
+
+// Parse parses a single log line, guessing the schema if necessary and applying DeleteKeys and
+// UpgradeKeys.  Like ReadLine, it returns as much of the line as could be parsed along with any
+// error.
+func (s *InputSchema) Parse(raw []byte) (ParsedLine, error) {
+	l := &line{raw: raw, fields: make(map[string]interface{})}
+	err := s.ReadLine(l)
+	return l.toParsedLine(), err
 }
 
 func (l *line) reset() {
 	l.raw = nil
 	l.msg = ""
-	l.fields = make(map[string]interface{})
+	if l.ownFields == nil {
+		l.ownFields = make(map[string]interface{})
+	} else {
+		for k := range l.ownFields {
+			delete(l.ownFields, k)
+		}
+	}
+	l.fields = l.ownFields
 	l.lvl = LevelUnknown
 	l.time = time.Time{}
 	l.highlight = false
+	l.invalidJSON = false
+	l.isRaw = false
+	l.number = 0
+	l.lastTime = time.Time{}
+	l.preJQ = nil
+}
+
+// clone returns a copy of the line that doesn't share any memory that reset reuses.
+func (l *line) clone() line {
+	c := *l
+	c.raw = append([]byte(nil), l.raw...)
+	c.fields = copyFields(l.fields)
+	if l.preJQ != nil {
+		c.preJQ = copyFields(l.preJQ)
+	}
+	c.ownFields = nil
+	return c
+}
+
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		result[k] = v
+	}
+	return result
+}
+
+// lineItem is a line of input on its way through ReadLog, along with the results of parsing and
+// filtering it.
+type lineItem struct {
+	l         line
+	truncated bool   // If true, the line was too long and was not parsed.
+	parsed    bool   // If true, the line has already been parsed.
+	parseErr  error  // The error returned by InputSchema.ReadLine.
+	filtered  bool   // If true, the filter rejected the line.
+	filterErr error  // The error returned by FilterScheme.Run.
+	panicErr  error  // Any panic encountered while parsing or filtering.
+	timeJump  string // A warning about the time of this line, if any.
+
+	// rawBuf holds a copy of the raw line, when it has to outlive the lineReader's buffer.  It
+	// is reused when the item is.
+	rawBuf []byte
+}
+
+func (it *lineItem) reset() {
+	it.l.reset()
+	it.truncated = false
+	it.parsed = false
+	it.parseErr = nil
+	it.filtered = false
+	it.filterErr = nil
+	it.panicErr = nil
+	it.timeJump = ""
+}
+
+// done returns true if the line will not be displayed no matter what the filter says, so there is
+// no need to run it.
+func (it *lineItem) done(ins *InputSchema) bool {
+	return it.panicErr != nil || it.truncated || (it.l.invalidJSON && ins.AbortOnInvalidJSON) || (it.parseErr != nil && ins.Strict)
+}
+
+// parse parses the raw line.
+func (it *lineItem) parse(ins *InputSchema) {
+	if it.truncated || it.parsed {
+		return
+	}
+	it.parsed = true
+	defer func() {
+		if err := recover(); err != nil {
+			it.panicErr = panicError(err, it.l.raw)
+		}
+	}()
+	it.parseErr = ins.ReadLine(&it.l)
+}
+
+// filter runs the filter against the parsed line.
+func (it *lineItem) filter(ins *InputSchema, f *FilterScheme) {
+	if it.done(ins) {
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			it.panicErr = panicError(err, it.l.raw)
+		}
+	}()
+	it.filtered, it.filterErr = f.Run(&it.l)
+}
+
+// panicLineWidth is the number of bytes of the offending line that panicError includes.
+const panicLineWidth = 200
+
+// maxPanicStack is the number of bytes of stack trace that panicError includes, at most.
+const maxPanicStack = 1 << 20
+
+// PanicError is the error that ReadLog returns when parsing, filtering, or formatting a line
+// panics, like when a custom OutputFormatter has a bug.  The message is kept to one line; the stack
+// trace is available for debugging.
+type PanicError struct {
+	Value interface{} // Value is the value that was passed to panic.
+	Line  string      // Line is the raw line that was being processed, truncated if it's long.
+	Stack []byte      // Stack is the stack trace of the goroutine that panicked, in full.
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v (while processing line %q)", e.Value, e.Line)
+}
+
+// panicError turns the value passed to panic into a *PanicError, with the start of the raw line
+// that was being processed and a stack trace.
+func panicError(err interface{}, raw []byte) error {
+	excerpt := string(raw)
+	if len(raw) > panicLineWidth {
+		excerpt = string(raw[:panicLineWidth]) + "..."
+	}
+	// runtime.Stack truncates the trace to fit the buffer, so grow the buffer until it fits.
+	stack := make([]byte, 2048)
+	for {
+		n := runtime.Stack(stack, false)
+		if n < len(stack) || len(stack) >= maxPanicStack {
+			stack = stack[:n]
+			break
+		}
+		stack = make([]byte, 2*len(stack))
+	}
+	return &PanicError{Value: err, Line: excerpt, Stack: stack}
+}
+
+// timeTracker remembers the time of the previous line, for $LAST_TS and for noticing unlikely
+// jumps in time.  It must see lines in input order.
+type timeTracker struct {
+	last   time.Time
+	warned bool
+}
+
+func (t *timeTracker) track(ins *InputSchema, it *lineItem) {
+	if it.done(ins) {
+		return
+	}
+	l := &it.l
+	l.lastTime = t.last
+	if l.time.IsZero() {
+		return
+	}
+	// Times that are years apart are probably a mix of seconds and milliseconds since the
+	// epoch, which makes for confusing output.
+	if jump := l.time.Sub(t.last); !t.last.IsZero() && !t.warned && (jump > implausibleTimeJump || jump < -implausibleTimeJump) {
+		t.warned = true
+		it.timeJump = fmt.Sprintf("warning: time jumped from %s to %s; the input may mix seconds and milliseconds since the epoch (try --epoch-unit)", t.last.UTC().Format(time.RFC3339), l.time.UTC().Format(time.RFC3339))
+	}
+	t.last = l.time
 }
 
 type Summary struct {
 	Lines    int
 	Errors   int
 	Filtered int
+
+	// FieldCounts is the number of displayed lines that each field appeared on, if
+	// OutputSchema.CountFields is set.
+	FieldCounts map[string]int
+
+	// Schema describes the fields of the displayed lines, if OutputSchema.InferSchema is set.
+	Schema *InferredSchema
+
+	// If OutputSchema.CollectStats is set, the number of displayed lines at each level and with
+	// each message, and the earliest and latest times among them.
+	LevelCounts         map[Level]int
+	MessageCounts       map[string]int
+	FirstTime, LastTime time.Time
 }
 
 func (s Summary) String() string {
@@ -164,162 +697,616 @@ func (s Summary) String() string {
 	return fmt.Sprintf("%s%s.", lines, errmsg)
 }
 
+// FieldStats returns a table of the fields in FieldCounts, most frequent first, for helping users
+// get acquainted with unfamiliar logs.  Each line is indented by indent.
+func (s Summary) FieldStats(indent string) string {
+	keys := make([]string, 0, len(s.FieldCounts))
+	width := len("lines")
+	for k, n := range s.FieldCounts {
+		keys = append(keys, k)
+		if w := len(strconv.Itoa(n)); w > width {
+			width = w
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if s.FieldCounts[a] != s.FieldCounts[b] {
+			return s.FieldCounts[a] > s.FieldCounts[b]
+		}
+		return a < b
+	})
+	result := new(strings.Builder)
+	fmt.Fprintf(result, "%s%*s  %s\n", indent, width, "lines", "field")
+	for _, k := range keys {
+		fmt.Fprintf(result, "%s%*d  %s\n", indent, width, s.FieldCounts[k], k)
+	}
+	return result.String()
+}
+
+// errHeadDone stops readParallel once OutputSchema.Head lines have been displayed.
+var errHeadDone = errors.New("displayed enough lines")
+
 // ReadLog reads a stream of JSON-formatted log lines from the provided reader according to the
 // input schema, reformatting it and writing to the provided writer according to the output schema.
 // Parse errors are handled according to the input schema.  Any other errors, not including io.EOF
 // on the reader, are returned.
 func ReadLog(r io.Reader, w io.Writer, ins *InputSchema, outs *OutputSchema, filter *FilterScheme) (Summary, error) {
-	s := bufio.NewScanner(r)
-	s.Buffer(make([]byte, 0, LineBufferSize), LineBufferSize)
-	var l line
+	s := newLineReader(r, LineBufferSize)
 	outs.state = State{
 		lastFields: make(map[string][]byte),
 	}
-	if outs.Formatter == nil {
-		outs.Formatter = &DefaultOutputFormatter{
-			Aurora: aurora.NewAurora(false),
-		}
-	}
+	outs.setDefaultFormatter()
+	outs.lastError, outs.errorRepeats = "", 0
+	filter.sampleCount = 0
+	defer outs.flushErrors()
 	var sum Summary
+	if outs.CountFields {
+		sum.FieldCounts = make(map[string]int)
+		outs.state.fieldCounts = sum.FieldCounts
+	}
+	if outs.InferSchema {
+		sum.Schema = &InferredSchema{Fields: make(map[string]*FieldSchema)}
+		outs.state.schema = sum.Schema
+	}
+	if outs.CollectStats {
+		sum.LevelCounts = make(map[Level]int)
+		sum.MessageCounts = make(map[string]int)
+		outs.state.stats = &sum
+	}
 
 	buf := new(bytes.Buffer)
 	ctx := &context{
 		After:  outs.AfterContext,
 		Before: outs.BeforeContext,
 	}
+	// With context, lines that are displayed as they were read are context lines like any
+	// other, instead of being printed no matter where they appear.
+	rawInContext := outs.AfterContext > 0 || outs.BeforeContext > 0
 
-	for s.Scan() {
-		sum.Lines++
+	// With Dedupe, the line that started the current run of identical lines is held back until
+	// the run ends.
+	dedupe := outs.Dedupe
+	if _, ok := outs.Formatter.(lineFormatter); ok {
+		dedupe = false
+	}
+	var pending *line
 
-		err := func() (retErr error) {
-			var addError, writeRawLine, recoverable bool
+	// With --tail, displayed lines are held back until the input has been read.
+	var tail *tailBuffer
+	if outs.Tail > 0 {
+		tail = &tailBuffer{n: outs.Tail}
+	}
+	// With GroupBy, displayed lines are held back until they can be printed with their group.
+	var groups *groupBuffer
+	if _, ok := outs.Formatter.(lineFormatter); !ok && outs.GroupBy != "" {
+		groups = &groupBuffer{field: outs.GroupBy, max: outs.GroupWindow}
+	}
+	// shown is the number of lines displayed so far, for --head.
+	var shown int
 
-			// Adjust counters, print debugging information, flush buffers on the way
-			// out, no matter what.
-			defer func() {
-				if addError {
-					sum.Errors++
-				}
-				var writeError bool
-				if buf.Len() > 0 {
-					if _, err := buf.WriteTo(w); err != nil {
-						recoverable = false
-						writeError = true
-						if retErr != nil {
-							retErr = fmt.Errorf("write remaining buffer content: %w (while flushing buffer after error %v)", err, retErr)
-						} else {
-							retErr = fmt.Errorf("write remaining buffer content: %w", err)
-						}
+	// emitLine formats a line into the buffer.
+	emitLine := func(l *line) {
+		if !outs.suppressionConfigured {
+			outs.noTime = ins.NoTimeKey
+			outs.noLevel = ins.NoLevelKey
+			outs.noMessage = ins.NoMessageKey
+			outs.suppressionConfigured = true
+		}
+		outs.Emit(l, buf)
+		if !l.isSeparator {
+			shown++
+		}
+	}
+
+	// flushGroups prints the lines buffered for GroupBy.
+	flushGroups := func() {
+		for _, g := range groups.flush() {
+			buf.WriteString(g.header(outs.GroupBy))
+			for i := range g.lines {
+				emitLine(&g.lines[i])
+			}
+		}
+	}
+
+	// display displays a line, or adds it to its group with GroupBy.
+	display := func(l *line) {
+		if groups != nil {
+			if groups.add(l) {
+				flushGroups()
+			}
+			return
+		}
+		emitLine(l)
+	}
+
+	// show displays a line, or saves it for later with --tail.
+	show := func(l *line) {
+		if l.isRaw && outs.NoRawEcho {
+			// Nothing would be written, so the line mustn't count towards --head or take
+			// up a place in --tail.
+			return
+		}
+		if tail != nil {
+			tail.add(l)
+			return
+		}
+		display(l)
+	}
+
+	// flushPending shows the line held back by Dedupe, if any.
+	flushPending := func() {
+		if pending != nil {
+			show(pending)
+			pending = nil
+		}
+	}
+
+	// emit prints a line, and any lines around it that are able to be printed based on the
+	// context settings.
+	emit := func(l *line, selected bool) {
+		for _, toEmit := range ctx.Print(l, selected) {
+			if !dedupe {
+				show(toEmit)
+				continue
+			}
+			if pending != nil && !toEmit.isSeparator && sameLine(pending, toEmit) {
+				pending.repeats++
+				continue
+			}
+			flushPending()
+			if toEmit.isSeparator {
+				show(toEmit)
+				continue
+			}
+			c := toEmit.clone()
+			c.repeats = 1
+			pending = &c
+		}
+	}
+
+	// emitRaw prints a line that can't be displayed normally as it was read.  Without context,
+	// it's always printed; with context, only if it's near a selected line.
+	emitRaw := func(l *line) {
+		l.isRaw = true
+		emit(l, !rawInContext)
+	}
+
+	// lastError is the last recoverable error, and errorRepeats is how many times it has been
+	// repeated since, for MaxErrorRepeats.  Unlike the count kept by EmitError, errors are
+	// counted even if they aren't printed.
+	var lastError string
+	var errorRepeats int
+
+	// handle prints a line that has been parsed and filtered.
+	handle := func(it *lineItem) (retErr error) {
+		var addError, writeRawLine, recoverable bool
+		l := &it.l
+
+		// Adjust counters, print debugging information, flush buffers on the way out, no
+		// matter what.
+		defer func() {
+			if addError {
+				sum.Errors++
+			}
+			var writeError bool
+			if buf.Len() > 0 {
+				if _, err := buf.WriteTo(w); err != nil {
+					recoverable = false
+					writeError = true
+					if retErr != nil {
+						retErr = fmt.Errorf("write remaining buffer content: %w (while flushing buffer after error %v)", err, retErr)
+					} else {
+						retErr = fmt.Errorf("write remaining buffer content: %w", err)
 					}
 				}
-				if writeRawLine {
-					buf.Write(l.raw)
-					buf.WriteString("\n")
-					if _, err := buf.WriteTo(w); err != nil {
-						writeError = true
-						recoverable = false
-						retErr = fmt.Errorf("write raw line: %w (while printing raw log that caused error %v)", err, retErr)
-					}
+			}
+			if writeRawLine && !outs.NoRawEcho {
+				outs.formatLineNumber(l.number, buf)
+				buf.Write(l.raw)
+				buf.WriteString("\n")
+				if _, err := buf.WriteTo(w); err != nil {
+					writeError = true
+					recoverable = false
+					retErr = fmt.Errorf("write raw line: %w (while printing raw log that caused error %v)", err, retErr)
 				}
-				if recoverable {
-					if ins.Strict {
-						outs.EmitError(retErr.Error())
-					}
-					retErr = nil
+			}
+			if recoverable {
+				msg := retErr.Error()
+				if msg == lastError {
+					errorRepeats++
+				} else {
+					lastError, errorRepeats = msg, 0
 				}
-				if writeError && !addError {
-					sum.Errors++
+				if ins.Strict {
+					outs.EmitError(msg)
 				}
-			}()
-
-			// Scope panics to the line that caused them.
-			defer func() {
-				if err := recover(); err != nil {
-					addError = true
-					writeRawLine = true
-					recoverable = false
-					stack := make([]byte, 2048)
-					runtime.Stack(stack, false)
-					retErr = fmt.Errorf("%s\n%s", err, stack)
+				if n := errorRepeats; outs.MaxErrorRepeats > 0 && n >= outs.MaxErrorRepeats {
+					retErr = fmt.Errorf("giving up after the same error was repeated %d times in a row: %w", n, retErr)
+				} else {
+					retErr = nil
 				}
-			}()
+			}
+			if writeError && !addError {
+				sum.Errors++
+			}
+		}()
+
+		// Scope panics to the line that caused them.
+		defer func() {
+			if err := recover(); err != nil {
+				addError = true
+				writeRawLine = true
+				recoverable = false
+				retErr = panicError(err, l.raw)
+			}
+		}()
 
-			// Reset state from the last line.
-			buf.Reset()
-			l.reset()
-			l.raw = s.Bytes()
+		// Reset state from the last line.
+		buf.Reset()
+		l.number = sum.Lines
 
-			// Parse input.
-			parseErr := ins.ReadLine(&l)
+		// Parsing and filtering panics are caught where they happen, and handled here.
+		if it.panicErr != nil {
+			addError = true
+			writeRawLine = true
+			recoverable = false
+			return it.panicErr
+		}
 
-			// Show parse errors in strict mode.
-			if parseErr != nil && ins.Strict {
-				addError = true
+		// Handle lines that are too long to parse.
+		if it.truncated {
+			addError = true
+			switch ins.LongLines {
+			case LongLineTruncate:
+				recoverable = true
+				outs.formatLineNumber(l.number, buf)
+				buf.Write(l.raw)
+				buf.WriteString(" (truncated)\n")
+				return fmt.Errorf("line longer than %d bytes; truncated", LineBufferSize)
+			case LongLineError:
+				recoverable = false
+				return fmt.Errorf("line longer than %d bytes: %w", LineBufferSize, bufio.ErrTooLong)
+			default:
+				recoverable = true
+				return fmt.Errorf("line longer than %d bytes; skipped", LineBufferSize)
+			}
+		}
+
+		// Stop at invalid JSON, if requested.
+		parseErr := it.parseErr
+		if l.invalidJSON && ins.AbortOnInvalidJSON {
+			addError = true
+			writeRawLine = true
+			recoverable = false
+			return fmt.Errorf("aborting at invalid json: %w", parseErr)
+		}
+
+		// Show parse errors in strict mode.
+		if parseErr != nil && ins.Strict {
+			addError = true
+			emitRaw(l)
+			recoverable = true
+			return fmt.Errorf("parse: %w", parseErr)
+		}
+
+		// Copy lines that aren't JSON to the output untouched, if requested.
+		if l.invalidJSON && outs.PassthroughNonJSON {
+			addError = true
+			emitRaw(l)
+			recoverable = true
+			return fmt.Errorf("parse: %w", parseErr)
+		}
+
+		// Filter.
+		if it.timeJump != "" {
+			outs.EmitError(it.timeJump)
+		}
+		filtered, err := it.filtered, it.filterErr
+		var filterErr error
+		if err != nil {
+			addError = true
+			switch filter.JQErrorMode {
+			case JQErrorSkip:
+				// Show the line as if there were no jq program, and report the error
+				// afterwards.
+				if l.preJQ != nil {
+					l.fields, l.preJQ = l.preJQ, nil
+				}
+				filtered = false
+				filterErr = fmt.Errorf("filter: %w", err)
+			case JQErrorRaw:
+				emitRaw(l)
+				recoverable = true
+				return fmt.Errorf("filter: %w", err)
+			default:
 				writeRawLine = true
+				recoverable = false
+				return fmt.Errorf("filter: %w", err)
+			}
+		}
+		if !filtered && !filter.sample() {
+			filtered = true
+		}
+		// Filtered lines still go through the context, which may print them later.
+		emit(l, !filtered)
+		if filtered {
+			sum.Filtered++
+			if parseErr != nil {
+				addError = true
 				recoverable = true
+				writeRawLine = false
 				return fmt.Errorf("parse: %w", parseErr)
 			}
+		}
+
+		// Copying the buffer to the output writer is handled in defer.
+		if filterErr != nil {
+			recoverable = true
+			return filterErr
+		}
+		if parseErr != nil {
+			addError = true
+			writeRawLine = false
+			recoverable = true
+			return fmt.Errorf("parse: %w", parseErr)
+		}
+		return nil
+	}
+
+	// headDone returns true once --head lines have been displayed.
+	headDone := func() bool {
+		return outs.Head > 0 && shown >= outs.Head
+	}
+
+	var readErr, scanErr error
+	if ins.Jobs > 1 && outs.AfterContext == 0 && outs.BeforeContext == 0 && !outs.elides() {
+		scanErr, readErr = readParallel(s, ins, filter, ins.Jobs, func(it *lineItem) error {
+			sum.Lines++
+			if err := handle(it); err != nil {
+				return fmt.Errorf("input line %d: %w", sum.Lines, err)
+			}
+			if headDone() {
+				return errHeadDone
+			}
+			return nil
+		})
+		if errors.Is(readErr, errHeadDone) {
+			readErr = nil
+		}
+	} else {
+		var it lineItem
+		var times timeTracker
+		for !headDone() && s.Scan() {
+			sum.Lines++
+			it.reset()
+			it.l.raw = s.Bytes()
+			it.truncated = s.Truncated()
+			it.parse(ins)
+			times.track(ins, &it)
+			it.filter(ins, filter)
+			if err := handle(&it); err != nil {
+				readErr = fmt.Errorf("input line %d: %w", sum.Lines, err)
+				break
+			}
+		}
+		scanErr = s.Err()
+	}
+	// The end of the input ends any run of duplicate lines.  With --head, the pending line is
+	// one more than was asked for.
+	if pending != nil && !headDone() {
+		buf.Reset()
+		flushPending()
+		if _, err := buf.WriteTo(w); err != nil && readErr == nil {
+			readErr = fmt.Errorf("write deduped line: %w", err)
+		}
+	}
+	// The tail is printed even if reading failed, so that the lines leading up to the problem
+	// can be seen.
+	if tail != nil {
+		buf.Reset()
+		for _, l := range tail.lines() {
+			display(l)
+		}
+		if _, err := buf.WriteTo(w); err != nil && readErr == nil {
+			readErr = fmt.Errorf("write tail: %w", err)
+		}
+	}
+	// Likewise for the groups.
+	if groups != nil {
+		buf.Reset()
+		flushGroups()
+		if _, err := buf.WriteTo(w); err != nil && readErr == nil {
+			readErr = fmt.Errorf("write groups: %w", err)
+		}
+	}
+	if readErr != nil {
+		return sum, readErr
+	}
+	if ff, ok := outs.Formatter.(finishingFormatter); ok {
+		buf.Reset()
+		ff.finish(outs, buf)
+		if _, err := buf.WriteTo(w); err != nil {
+			return sum, fmt.Errorf("write final output: %w", err)
+		}
+	}
+	return sum, scanErr
+}
+
+// maxSchemas is the number of schemas that MultiSchema mode remembers.
+const maxSchemas = 8
+
+// knownSchema is a schema that has been recognized in MultiSchema mode.
+type knownSchema struct {
+	schema *InputSchema
+	// markers are keys that guessing the schema added to DeleteKeys or UpgradeKeys.  They're
+	// characteristic of the logger, so they have to be present for the schema to fit a line.
+	markers []string
+}
+
+// fit returns how well the schema fits the line, or -1 if it doesn't fit at all.  A schema fits a
+// line if the line has its time, level, and message keys, and all of its markers.  Schemas with
+// more markers are a better fit, being more specific.
+func (k *knownSchema) fit(l *line) int {
+	has := func(key string) bool {
+		_, ok := l.fields[key]
+		return ok
+	}
+	s := k.schema
+	if (!s.NoTimeKey && !has(s.TimeKey)) || (!s.NoLevelKey && !has(s.LevelKey)) || (!s.NoMessageKey && !has(s.MessageKey)) {
+		return -1
+	}
+	for _, m := range k.markers {
+		if !has(m) {
+			return -1
+		}
+	}
+	return len(k.markers)
+}
+
+// is returns true if the schema is the same as a newly-guessed one.
+func (k *knownSchema) is(s *InputSchema, markers []string) bool {
+	if k.schema.TimeKey != s.TimeKey || k.schema.LevelKey != s.LevelKey || k.schema.MessageKey != s.MessageKey || k.schema.NoLevelKey != s.NoLevelKey || len(k.markers) != len(markers) {
+		return false
+	}
+	for i := range markers {
+		if k.markers[i] != markers[i] {
+			return false
+		}
+	}
+	return true
+}
 
-			// Filter.
-			filtered, err := filter.Run(&l)
-			if err != nil {
-				addError = true
-				writeRawLine = true
-				recoverable = false
-				// It is questionable as to whether or not a filter breaking means
-				// that we should stop processing the log entirely.  It's probably a
-				// bug in the filter that affects every line, so the sooner we
-				// return the error, the sooner the user can fix their filter.  But
-				// on the other hand, is it worth it to spend the time debugging a
-				// jq program that's only broken on one line out of a billion?
-				return fmt.Errorf("filter: %w", err)
-			}
-			if filtered {
-				sum.Filtered++
-				if parseErr != nil {
-					addError = true
-					recoverable = true
-					writeRawLine = false
-					return fmt.Errorf("parse: %w", parseErr)
-				}
-			}
+// schemaFor guesses the schema of the line, and returns the remembered copy of that schema.  If
+// the line can't be recognized on its own, it returns the remembered schema that fits it best, or
+// the first one recognized in case of a tie.  If none fit, it returns s, which parses the line
+// without a schema.
+func (s *InputSchema) schemaFor(l *line) *InputSchema {
+	// Guess into a copy, so that s stays unguessed for the next line.  The capacity of the
+	// copied slices is limited so that guessSchema appending to them doesn't modify s.
+	guess := *s
+	guess.MultiSchema = false
+	guess.schemas = nil
+	guess.DeleteKeys = s.DeleteKeys[:len(s.DeleteKeys):len(s.DeleteKeys)]
+	guess.UpgradeKeys = s.UpgradeKeys[:len(s.UpgradeKeys):len(s.UpgradeKeys)]
+	guess.guessSchema(l)
 
-			// Emit any lines that are able to be printed based on the context settings.
-			for _, toEmit := range ctx.Print(&l, !filtered) {
-				if !outs.suppressionConfigured {
-					outs.noTime = ins.NoTimeKey
-					outs.noLevel = ins.NoLevelKey
-					outs.noMessage = ins.NoMessageKey
-					outs.suppressionConfigured = true
-				}
-				outs.Emit(toEmit, buf)
+	if !guess.canGuessSchema() {
+		var markers []string
+		markers = append(markers, guess.DeleteKeys[len(s.DeleteKeys):]...)
+		markers = append(markers, guess.UpgradeKeys[len(s.UpgradeKeys):]...)
+		for i := range s.schemas {
+			if s.schemas[i].is(&guess, markers) {
+				return s.schemas[i].schema
 			}
+		}
+		known := guess
+		if len(s.schemas) < maxSchemas {
+			s.schemas = append(s.schemas, knownSchema{schema: &known, markers: markers})
+		}
+		return &known
+	}
 
-			// Copying the buffer to the output writer is handled in defer.
-			if parseErr != nil {
-				addError = true
-				writeRawLine = false
-				recoverable = true
-				return fmt.Errorf("parse: %w", err)
-			}
-			return nil
-		}()
-		if err != nil {
-			return sum, fmt.Errorf("input line %d: %w", sum.Lines, err)
+	var best *InputSchema
+	bestFit := -1
+	for i := range s.schemas {
+		if fit := s.schemas[i].fit(l); fit > bestFit {
+			best, bestFit = s.schemas[i].schema, fit
 		}
 	}
-	return sum, s.Err()
+	if best != nil {
+		return best
+	}
+	return s
 }
 
-// guessSchema tries to guess the schema if one has not been explicitly configured.
-func (s *InputSchema) guessSchema(l *line) {
+// canGuessSchema returns true if guessSchema might still change the schema.
+func (s *InputSchema) canGuessSchema() bool {
 	if s.TimeKey != "" || s.LevelKey != "" || s.MessageKey != "" {
-		// Explicitly turn off guessing, as per the docs.
-		return
+		// An explicitly configured schema, or one that has already been guessed, turns off
+		// guessing, as per the docs.
+		return false
 	}
 	if s.NoTimeKey || s.NoLevelKey || s.NoMessageKey {
 		// We can guess the schema in the presence of these options, but we currently don't
 		// have any such schemas.
+		return false
+	}
+	return true
+}
+
+// levelFromMessage sets the level of l from its message with the LevelFromMessage regex, returning
+// true if the message contained a level.
+func (s *InputSchema) levelFromMessage(l *line) bool {
+	rx := s.LevelFromMessage
+	if rx == nil {
+		return false
+	}
+	m := rx.FindStringSubmatchIndex(l.msg)
+	i := rx.SubexpIndex("level")
+	if m == nil || i < 0 || m[2*i] < 0 {
+		return false
+	}
+	lvl, err := DefaultLevelParser(l.msg[m[2*i]:m[2*i+1]])
+	if err != nil || lvl == LevelUnknown {
+		// "[main] starting up" shouldn't lose "[main]".
+		return false
+	}
+	l.lvl = lvl
+	if s.StripLevelFromMessage {
+		l.msg = l.msg[:m[0]] + l.msg[m[1]:]
+	}
+	return true
+}
+
+// parseMessageJSON moves a JSON object at the end of l's message into its fields, for
+// InputSchema.ParseMessageJSON.  The object starts at the first '{' that makes the rest of the
+// message a valid JSON object.
+func parseMessageJSON(l *line) {
+	msg := strings.TrimRight(l.msg, " \t\r\n")
+	if !strings.HasSuffix(msg, "}") {
+		return
+	}
+	for i := strings.IndexByte(msg, '{'); i >= 0; {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(msg[i:]), &obj); err == nil && obj != nil {
+			if l.fields == nil {
+				l.fields = make(map[string]interface{}, len(obj))
+			}
+			for k, v := range obj {
+				l.fields[k] = v
+			}
+			l.msg = strings.TrimRight(msg[:i], " \t")
+			return
+		}
+		next := strings.IndexByte(msg[i+1:], '{')
+		if next < 0 {
+			return
+		}
+		i += next + 1
+	}
+}
+
+// parseJSONField replaces the value of fields[k] with the object or array it encodes, if it's a
+// string containing one, for InputSchema.ParseJSONFields.
+func parseJSONField(fields map[string]interface{}, k string) {
+	str, ok := fields[k].(string)
+	if !ok {
+		return
+	}
+	str = strings.TrimSpace(str)
+	if !strings.HasPrefix(str, "{") && !strings.HasPrefix(str, "[") {
+		return
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(str), &v); err != nil {
+		return
+	}
+	fields[k] = v
+}
+
+// guessSchema tries to guess the schema if one has not been explicitly configured.
+func (s *InputSchema) guessSchema(l *line) {
+	if !s.canGuessSchema() {
 		return
 	}
 	has := func(key string) bool {
@@ -335,6 +1322,31 @@ func (s *InputSchema) guessSchema(l *line) {
 		s.MessageKey = "msg"
 		return
 	}
+	if has("@timestamp") && has("log.level") && has("message") {
+		// Elastic Common Schema, as written by the ecs-logging libraries
+		s.TimeKey = "@timestamp"
+		s.TimeFormat = DefaultTimeParser
+		s.LevelKey = "log.level"
+		s.LevelFormat = DefaultLevelParser
+		s.MessageKey = "message"
+		if has("ecs.version") {
+			s.DeleteKeys = append(s.DeleteKeys, "ecs.version")
+		}
+		return
+	}
+	if log, ok := l.fields["log"].(map[string]interface{}); ok && has("@timestamp") && has("message") {
+		// Elastic Common Schema, with nested rather than dotted keys; the rest of the "log"
+		// object is removed along with the level.
+		if _, ok := log["level"]; ok {
+			s.TimeKey = "@timestamp"
+			s.TimeFormat = DefaultTimeParser
+			s.LevelKey = "log"
+			s.LevelSubkey = "level"
+			s.LevelFormat = DefaultLevelParser
+			s.MessageKey = "message"
+			return
+		}
+	}
 	if has("timestamp") && has("severity") && has("message") {
 		// stackdriver
 		s.TimeKey = "timestamp"
@@ -407,8 +1419,44 @@ func (s *InputSchema) guessSchema(l *line) {
 		}
 		return
 	}
+	if s.LevelFromMessage != nil {
+		// Loggers that put the level in the message, like "[INFO] starting up", only need a
+		// time and a message.  The level key stays empty, so the level comes from the
+		// message, as with --format docker.
+		for _, c := range []struct {
+			time, msg string
+			format    TimeParser
+		}{
+			{"ts", "msg", StrictUnixTimeParser},
+			{"time", "msg", DefaultTimeParser},
+			{"time", "message", DefaultTimeParser},
+			{"timestamp", "message", DefaultTimeParser},
+			{"@timestamp", "message", DefaultTimeParser},
+		} {
+			if has(c.time) && has(c.msg) {
+				s.TimeKey = c.time
+				s.TimeFormat = c.format
+				s.MessageKey = c.msg
+				return
+			}
+		}
+	}
+}
+
+// removeExtractedKey removes a key whose value was extracted as the time, level, or message from
+// the line's fields, unless the user wants to keep it.
+func (s *InputSchema) removeExtractedKey(l *line, key string) {
+	for _, k := range s.PreserveKeys {
+		if k == key {
+			return
+		}
+	}
+	delete(l.fields, key)
 }
 
+// utf8BOM is the UTF-8 encoding of the byte order mark, U+FEFF.
+var utf8BOM = []byte("\ufeff")
+
 // ReadLine parses a log line into the provided line object.
 func (s *InputSchema) ReadLine(l *line) error {
 	var retErr error
@@ -420,59 +1468,148 @@ func (s *InputSchema) ReadLine(l *line) error {
 		retErr = fmt.Errorf("%v; %v", retErr, err)
 	}
 
+	// Windows programs like to start files with a byte order mark, and some writers pad lines
+	// with NUL bytes; neither is valid JSON, and neither is worth reporting.
+	l.raw = bytes.TrimRight(bytes.TrimPrefix(l.raw, utf8BOM), "\x00")
+
 	if !s.Strict && ((len(l.raw) > 0 && l.raw[0] != '{') || len(l.raw) == 0) {
 		l.time = time.Time{}
 		l.msg = string(l.raw)
+		if s.StripANSI {
+			l.msg = stripANSI(l.msg)
+		}
+		l.invalidJSON = true
 		return errors.New("not a JSON object")
 	}
 	if err := json.Unmarshal(l.raw, &l.fields); err != nil {
+		l.invalidJSON = true
 		pushError(fmt.Errorf("unmarshal json: %w", err))
 		if !s.Strict {
 			l.msg = string(l.raw)
+			if s.StripANSI {
+				l.msg = stripANSI(l.msg)
+			}
+		}
+	}
+	if s.MultiSchema && s.canGuessSchema() {
+		if err := s.schemaFor(l).readFields(l); err != nil {
+			pushError(err)
+		}
+		return retErr
+	}
+	// Once a schema has been guessed, it's kept in s, so there's no need to look at the fields
+	// again.
+	if s.canGuessSchema() {
+		s.guessSchema(l)
+	}
+	if err := s.readFields(l); err != nil {
+		pushError(err)
+	}
+	return retErr
+}
+
+// findKey returns the first of key and alts that is present in the line, along with its value.
+func findKey(l *line, key string, alts []string) (string, interface{}, bool) {
+	if v, ok := l.fields[key]; ok {
+		return key, v, true
+	}
+	for _, k := range alts {
+		if v, ok := l.fields[k]; ok {
+			return k, v, true
+		}
+	}
+	return key, nil, false
+}
+
+// keyNames describes key and its alternatives for error messages, like "a" or "a", "b", or "c".
+func keyNames(key string, alts []string) string {
+	names := []string{strconv.Quote(key)}
+	for _, k := range alts {
+		names = append(names, strconv.Quote(k))
+	}
+	switch len(names) {
+	case 1:
+		return names[0]
+	case 2:
+		return names[0] + " or " + names[1]
+	default:
+		return strings.Join(names[:len(names)-1], ", ") + ", or " + names[len(names)-1]
+	}
+}
+
+// readFields extracts the time, level, and message from the fields of a line that has been
+// unmarshaled, and applies UpgradeKeys and DeleteKeys.
+func (s *InputSchema) readFields(l *line) error {
+	var retErr error
+	pushError := func(err error) {
+		if retErr == nil {
+			retErr = err
+			return
 		}
+		retErr = fmt.Errorf("%v; %v", retErr, err)
 	}
-	s.guessSchema(l)
+
 	if !s.NoTimeKey {
-		if raw, ok := l.fields[s.TimeKey]; s.TimeFormat != nil && ok {
+		if key, raw, ok := findKey(l, s.TimeKey, s.AltTimeKeys); s.TimeFormat != nil && ok {
 			t, err := s.TimeFormat(raw)
-			if err != nil {
-				pushError(fmt.Errorf("parse time %T(%v) in key %q: %w", raw, raw, s.TimeKey, err))
-			} else {
-				delete(l.fields, s.TimeKey)
+			switch {
+			case err == nil:
+				s.removeExtractedKey(l, key)
 				l.time = t
+			case !s.LenientTime:
+				pushError(fmt.Errorf("parse time %T(%v) in key %q: %w", raw, raw, key, err))
 			}
-		} else {
-			pushError(fmt.Errorf("no time key %q in incoming log", s.TimeKey))
+		} else if !s.LenientTime {
+			pushError(fmt.Errorf("no time key %s in incoming log", keyNames(s.TimeKey, s.AltTimeKeys)))
 		}
 	}
 	if !s.NoMessageKey {
-		if msg, ok := l.fields[s.MessageKey]; ok {
+		if key, msg, ok := findKey(l, s.MessageKey, s.AltMessageKeys); ok {
 			switch x := msg.(type) {
 			case string:
 				l.msg = x
-				delete(l.fields, s.MessageKey)
+				if s.TrimMessage {
+					l.msg = strings.TrimRight(x, "\r\n")
+				}
+				if s.StripANSI {
+					l.msg = stripANSI(l.msg)
+				}
+				s.removeExtractedKey(l, key)
 			default:
 				l.msg = string(l.raw)
-				pushError(fmt.Errorf("message key %q contains non-string data (%q of type %T)", s.MessageKey, msg, msg))
+				pushError(fmt.Errorf("message key %q contains non-string data (%q of type %T)", key, msg, msg))
 			}
 		} else {
-			pushError(fmt.Errorf("no message key %q in incoming log", s.MessageKey))
+			pushError(fmt.Errorf("no message key %s in incoming log", keyNames(s.MessageKey, s.AltMessageKeys)))
 		}
 	}
 	if !s.NoLevelKey {
-		if lvl, ok := l.fields[s.LevelKey]; s.LevelFormat != nil && ok {
+		if key, lvl, ok := findKey(l, s.LevelKey, s.AltLevelKeys); s.LevelFormat != nil && ok {
+			if obj, isObj := lvl.(map[string]interface{}); isObj && s.LevelSubkey != "" {
+				lvl = obj[s.LevelSubkey]
+			}
 			if parsed, err := s.LevelFormat(lvl); err != nil {
-				pushError(fmt.Errorf("level key %q: %w", s.LevelKey, err))
+				pushError(fmt.Errorf("level key %q: %w", key, err))
 			} else {
 				l.lvl = parsed
-				delete(l.fields, s.LevelKey)
+				s.removeExtractedKey(l, key)
 			}
-		} else {
-			pushError(fmt.Errorf("no level key %q in incoming log", s.LevelKey))
+		} else if !s.levelFromMessage(l) {
+			pushError(fmt.Errorf("no level key %s in incoming log", keyNames(s.LevelKey, s.AltLevelKeys)))
+		}
+		if l.lvl == LevelUnknown {
+			l.lvl = s.UnknownLevel
 		}
 	}
+	if s.ParseMessageJSON {
+		parseMessageJSON(l)
+	}
+	for _, k := range s.ParseJSONFields {
+		parseJSONField(l.fields, k)
+	}
 	for _, name := range s.UpgradeKeys {
-		raw, ok := l.fields[name]
+		parents, key := upgradePath(l.fields, name)
+		raw, ok := parents[len(parents)-1][key]
 		if !ok {
 			// Skip upgrade if the key is absent.
 			continue
@@ -481,7 +1618,8 @@ func (s *InputSchema) ReadLine(l *line) error {
 		if ok {
 			// Delete original first, so that foo:{foo:42} will overwrite to foo:42,
 			// rather than {}.
-			delete(l.fields, name)
+			delete(parents[len(parents)-1], key)
+			pruneEmpty(parents, name)
 			for k, v := range toMerge {
 				l.fields[k] = v
 			}
@@ -490,19 +1628,357 @@ func (s *InputSchema) ReadLine(l *line) error {
 		}
 	}
 	for _, k := range s.DeleteKeys {
-		delete(l.fields, k)
+		if !isGlob(k) {
+			delete(l.fields, k)
+			continue
+		}
+		for field := range l.fields {
+			if matchKey(k, field) {
+				delete(l.fields, field)
+			}
+		}
+	}
+	s.renameKeys(l)
+	if s.LowercaseKeys {
+		lowercaseKeys(l.fields)
+	}
+	if s.StripANSI {
+		stripANSIValue(l.fields)
 	}
 	return retErr
 }
 
+// renameKeys applies RenameKeys to a line.
+func (s *InputSchema) renameKeys(l *line) {
+	if len(s.RenameKeys) == 0 {
+		return
+	}
+	olds := make([]string, 0, len(s.RenameKeys))
+	for old := range s.RenameKeys {
+		if _, ok := l.fields[old]; ok {
+			olds = append(olds, old)
+		}
+	}
+	sort.Strings(olds)
+	values := make([]interface{}, len(olds))
+	for i, old := range olds {
+		values[i] = l.fields[old]
+		delete(l.fields, old)
+	}
+	for i, old := range olds {
+		l.fields[s.RenameKeys[old]] = values[i]
+	}
+}
+
+// lowercaseKeys changes the keys of fields to lower case, for InputSchema.LowercaseKeys.
+func lowercaseKeys(fields map[string]interface{}) {
+	var keys []string
+	for k := range fields {
+		if strings.ToLower(k) != k {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		lower := strings.ToLower(k)
+		if _, ok := fields[lower]; ok {
+			continue
+		}
+		fields[lower] = fields[k]
+		delete(fields, k)
+	}
+}
+
+// upgradePath finds the object that contains the key named by an UpgradeKeys entry.  It returns
+// the objects along the way, starting with fields, and the name of the key in the last one.  If
+// an object along the way is missing, the whole name is looked up in fields, where it won't be.
+func upgradePath(fields map[string]interface{}, name string) ([]map[string]interface{}, string) {
+	parents := []map[string]interface{}{fields}
+	if _, ok := fields[name]; ok || !strings.Contains(name, ".") {
+		return parents, name
+	}
+	parts := strings.Split(name, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := parents[len(parents)-1][part].(map[string]interface{})
+		if !ok {
+			return parents[:1], name
+		}
+		parents = append(parents, next)
+	}
+	return parents, parts[len(parts)-1]
+}
+
+// pruneEmpty removes objects that upgrading a dotted path left empty from their parents.
+func pruneEmpty(parents []map[string]interface{}, name string) {
+	parts := strings.Split(name, ".")
+	for i := len(parents) - 1; i > 0 && len(parents[i]) == 0; i-- {
+		delete(parents[i-1], parts[i-1])
+	}
+}
+
+// isGlob returns true if a key in DeleteKeys is a glob pattern.
+func isGlob(k string) bool {
+	return strings.ContainsAny(k, "*?[")
+}
+
+// matchKey returns true if a key matches a glob pattern from DeleteKeys.  The syntax is that of
+// path.Match, except that * and ? match '/' too, since a key like "kubernetes.io/name" isn't a
+// path.
+func matchKey(pattern, key string) bool {
+	// path.Match only treats '/' specially, so it's swapped for a byte that keys practically never
+	// contain.
+	if !strings.Contains(key, "\x00") {
+		pattern = strings.ReplaceAll(pattern, "/", "\x00")
+		key = strings.ReplaceAll(key, "/", "\x00")
+	}
+	ok, _ := path.Match(pattern, key)
+	return ok
+}
+
+// elides returns true if the formatter hides fields that are the same as on the previous line.
+func (s *OutputSchema) elides() bool {
+	f, ok := s.Formatter.(*DefaultOutputFormatter)
+	return ok && f.ElideDuplicateFields
+}
+
+// setDefaultFormatter installs a monochrome DefaultOutputFormatter if no formatter is configured.
+func (s *OutputSchema) setDefaultFormatter() {
+	if s.Formatter == nil {
+		s.Formatter = &DefaultOutputFormatter{
+			Aurora: aurora.NewAurora(false),
+		}
+	}
+}
+
+// FormatLine formats a single already-parsed log line, for programs that want to use this package
+// as a formatting library rather than reading logs with ReadLog.  State, like the fields seen on
+// previous lines, is kept between calls, so a series of calls formats lines the same way ReadLog
+// would.  The provided fields are not modified.  If the formatter panics, the panic is returned as
+// an error.
+func (s *OutputSchema) FormatLine(t time.Time, lvl Level, msg string, fields map[string]interface{}) (result []byte, retErr error) {
+	s.setDefaultFormatter()
+	if s.state.lastFields == nil {
+		s.state.lastFields = make(map[string][]byte)
+	}
+	l := fromParsedLine(ParsedLine{
+		Time:    t,
+		Level:   lvl,
+		Message: msg,
+		Fields:  make(map[string]interface{}, len(fields)),
+	})
+	for k, v := range fields {
+		l.fields[k] = v
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			result = nil
+			retErr = fmt.Errorf("format line: %v", err)
+		}
+	}()
+	buf := new(bytes.Buffer)
+	s.Emit(l, buf)
+	return buf.Bytes(), nil
+}
+
+// FieldSort is an order to display new fields in.
+type FieldSort int
+
+const (
+	FieldSortKey         FieldSort = iota // Sort by name.
+	FieldSortValueLength                  // Sort by the length of the value, shortest first.
+	FieldSortType                         // Sort by the JSON type of the value: null, bool, number, string, array, then object.
+)
+
+// fieldTypeOrder is the position of each JSON type for FieldSortType.
+var fieldTypeOrder = map[string]int{
+	"null":   0,
+	"bool":   1,
+	"number": 2,
+	"string": 3,
+	"array":  4,
+	"object": 5,
+}
+
+// valueLength returns the displayed length of a value for FieldSortValueLength: the length of a
+// string, or the length of anything else as JSON.
+func valueLength(v interface{}) int {
+	if str, ok := v.(string); ok {
+		return len(str)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return len(fmt.Sprintf("%v", v))
+	}
+	return len(b)
+}
+
+// sortNewFields sorts keys, the names of some of fields, in the order that FieldSort requests.  Ties
+// are broken by name, so the order is always deterministic.
+func (s *OutputSchema) sortNewFields(keys []string, fields map[string]interface{}) {
+	var rank func(k string) int
+	switch s.FieldSort {
+	case FieldSortValueLength:
+		rank = func(k string) int { return valueLength(fields[k]) }
+	case FieldSortType:
+		rank = func(k string) int {
+			if r, ok := fieldTypeOrder[jsonType(fields[k])]; ok {
+				return r
+			}
+			return len(fieldTypeOrder)
+		}
+	default:
+		sort.Strings(keys)
+		return
+	}
+	ranks := make(map[string]int, len(keys))
+	for _, k := range keys {
+		ranks[k] = rank(k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if ranks[a] != ranks[b] {
+			return ranks[a] < ranks[b]
+		}
+		return a < b
+	})
+}
+
+// fieldOrder returns the keys of fields in the order they should be displayed: the fields the user
+// explicitly wants to see, then fields seen on past lines, then any new fields (in the order
+// FieldSort requests).  New fields are remembered for future lines.  If SortFields is set, past
+// lines are ignored and everything but the priority fields is sorted.
+func (s *OutputSchema) fieldOrder(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	added := make(map[string]struct{}, len(fields))
+	add := func(k string) {
+		if _, ok := fields[k]; !ok {
+			return
+		}
+		if _, ok := added[k]; ok {
+			return
+		}
+		added[k] = struct{}{}
+		keys = append(keys, k)
+	}
+	for _, k := range s.PriorityFields {
+		add(k)
+	}
+	if !s.SortFields {
+		for _, k := range s.state.seenFields {
+			add(k)
+		}
+	}
+	newFields := make([]string, 0, len(fields)-len(keys))
+	for k := range fields {
+		if _, ok := added[k]; !ok {
+			newFields = append(newFields, k)
+		}
+	}
+	s.sortNewFields(newFields, fields)
+	for _, k := range newFields {
+		add(k)
+		if !s.SortFields {
+			s.state.seenFields = append(s.state.seenFields, k)
+		}
+	}
+	return keys
+}
+
+// formatRepeats writes the number of times a deduped line was repeated, if it was.
+func formatRepeats(n int, w *bytes.Buffer) {
+	if n > 1 {
+		fmt.Fprintf(w, " (x%d)", n)
+	}
+}
+
+// sameLine returns true if two lines would be displayed the same way, ignoring their times, for
+// OutputSchema.Dedupe.
+func sameLine(a, b *line) bool {
+	if a.isRaw || b.isRaw {
+		return a.isRaw && b.isRaw && bytes.Equal(a.raw, b.raw)
+	}
+	return a.lvl == b.lvl && a.msg == b.msg && a.highlight == b.highlight && reflect.DeepEqual(a.fields, b.fields)
+}
+
+// formatLineNumber writes a line number to the provided buffer, if line numbers are enabled.  Line
+// numbers are right-aligned to the widest one printed so far.
+func (s *OutputSchema) formatLineNumber(n int, w *bytes.Buffer) {
+	if !s.LineNumbers {
+		return
+	}
+	num := strconv.Itoa(n)
+	if len(num) > s.state.lineNumberWidth {
+		s.state.lineNumberWidth = len(num)
+	}
+	fmt.Fprintf(w, "%*s ", s.state.lineNumberWidth, num)
+}
+
 // Emit emits a formatted line to the provided buffer.  Emit must not mutate line.
 func (s *OutputSchema) Emit(l *line, w *bytes.Buffer) {
+	// Lines displayed as they were read aren't counted, and don't go through the formatter.
+	if l.isRaw {
+		if !s.NoRawEcho {
+			s.formatLineNumber(l.number, w)
+			w.Write(l.raw)
+			formatRepeats(l.repeats, w)
+			w.WriteString("\n")
+		}
+		return
+	}
+
+	// Count fields for the summary.  A deduped line counts once for each time it appeared.
+	count := 1
+	if l.repeats > 1 {
+		count = l.repeats
+	}
+	if s.state.fieldCounts != nil && !l.isSeparator {
+		for k := range l.fields {
+			s.state.fieldCounts[k] += count
+		}
+	}
+	if s.state.schema != nil && !l.isSeparator {
+		s.state.schema.add(l.fields, count)
+	}
+	if sum := s.state.stats; sum != nil && !l.isSeparator {
+		sum.LevelCounts[l.lvl] += count
+		sum.MessageCounts[l.msg] += count
+		if t := l.time; !t.IsZero() {
+			if sum.FirstTime.IsZero() || t.Before(sum.FirstTime) {
+				sum.FirstTime = t
+			}
+			if t.After(sum.LastTime) {
+				sum.LastTime = t
+			}
+		}
+	}
+
+	// Does the formatter want to handle the entire line?  Separators are omitted in that case,
+	// as they would only break up a table.
+	if lf, ok := s.Formatter.(lineFormatter); ok {
+		if !l.isSeparator {
+			lf.formatLine(s, l, w)
+		}
+		return
+	}
+
+	s.formatLineNumber(l.number, w)
+
 	// Is this a line separating unrelated contexts?  If so, print a separator and do nothing else.
 	if l.isSeparator {
+		if s.ContextSeparatorStats && l.skipped > 0 {
+			fmt.Fprintf(w, "--- %s ---\n", linesSkipped(l.skipped))
+			return
+		}
 		w.WriteString("---\n")
 		return
 	}
 
+	// Prefix.
+	if pf, ok := s.Formatter.(prefixFormatter); ok {
+		pf.formatPrefix(&s.state, l.fields, w)
+	}
+
+	start := w.Len()
 	var needSpace bool
 
 	// Level.
@@ -517,56 +1993,75 @@ func (s *OutputSchema) Emit(l *line, w *bytes.Buffer) {
 		w.WriteString(" ")
 	}
 
+	// Columns.
+	var columns []string
+	if cf, ok := s.Formatter.(columnFormatter); ok {
+		columns = cf.columns()
+		for _, k := range columns {
+			v, ok := l.fields[k]
+			cf.formatColumn(&s.state, k, v, ok, w)
+			w.WriteString(" ")
+		}
+	}
+
 	// Message.
 	if !s.noMessage {
 		s.Formatter.FormatMessage(&s.state, l.msg, l.highlight, w)
 		needSpace = true
 	}
 
-	seenFieldsThisIteration := make(map[string]struct{})
-	write := func(k string, v interface{}) {
+	// Expanded fields are shown after the line, not in it.
+	var expanded []string
+	ef, expands := s.Formatter.(expandingFormatter)
+	if expands {
+		expanded = ef.expandedFields(l.fields)
+	}
+
+fields:
+	for _, k := range s.fieldOrder(l.fields) {
+		for _, c := range columns {
+			if k == c {
+				continue fields
+			}
+		}
+		for _, e := range expanded {
+			if k == e {
+				continue fields
+			}
+		}
 		if needSpace {
 			w.WriteString(" ")
 		}
-		seenFieldsThisIteration[k] = struct{}{}
-		delete(l.fields, k)
-		s.Formatter.FormatField(&s.state, k, v, w)
+		s.Formatter.FormatField(&s.state, k, l.fields[k], w)
 		needSpace = true
 	}
+	formatRepeats(l.repeats, w)
 
-	// Fields the user explicitly wants to see.
-	for _, k := range s.PriorityFields {
-		if v, ok := l.fields[k]; ok {
-			write(k, v)
+	// Keep state for field eliding.
+	for k := range s.state.lastFields {
+		if _, ok := l.fields[k]; !ok {
+			delete(s.state.lastFields, k)
 		}
 	}
 
-	// Fields we've seen on past lines.
-	for _, k := range s.state.seenFields {
-		if v, ok := l.fields[k]; ok {
-			write(k, v)
-		}
+	// Highlight the entire line, if the formatter wants to.
+	if lh, ok := s.Formatter.(lineHighlighter); ok {
+		highlighted := lh.highlightLine(l.lvl, w.Bytes()[start:])
+		w.Truncate(start)
+		w.Write(highlighted)
 	}
 
-	// Any new fields (in a deterministic order, mostly for tests).
-	newFields := make([]string, 0, len(l.fields))
-	for k := range l.fields {
-		newFields = append(newFields, k)
-	}
-	sort.Strings(newFields)
-	for _, k := range newFields {
-		v := l.fields[k]
-		write(k, v)
-		s.state.seenFields = append(s.state.seenFields, k)
-	}
+	// Final newline is our responsibility.
+	w.WriteString("\n")
 
-	// Keep state for field eliding.
-	for k := range s.state.lastFields {
-		if _, ok := seenFieldsThisIteration[k]; !ok {
-			delete(s.state.lastFields, k)
+	for _, k := range expanded {
+		if v, ok := l.fields[k]; ok {
+			ef.formatExpanded(&s.state, k, v, w)
 		}
 	}
 
-	// Final newline is our responsibility.
-	w.WriteString("\n")
+	// Show what the line looked like before jq changed it.
+	if of, ok := s.Formatter.(originalFormatter); ok && s.ShowOriginal && l.preJQ != nil && !reflect.DeepEqual(l.preJQ, l.fields) {
+		of.formatOriginal(&s.state, l.raw, w)
+	}
 }
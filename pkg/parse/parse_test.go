@@ -82,14 +82,14 @@ func TestRead(t *testing.T) {
 			name:  "empty message",
 			s:     basicSchema,
 			input: ``,
-			want:  &line{},
+			want:  &line{invalidJSON: true},
 			err:   Match("unexpected end of JSON input.*no time key.*no message key.*no level key"),
 		},
 		{
 			name:  "empty message in lax mode",
 			s:     laxSchema,
 			input: ``,
-			want:  &line{},
+			want:  &line{invalidJSON: true},
 			err:   Match("not a JSON object"),
 		},
 		{
@@ -114,7 +114,8 @@ func TestRead(t *testing.T) {
 			s:     basicSchema,
 			input: `{"not":"json"`,
 			want: &line{
-				msg: "",
+				msg:         "",
+				invalidJSON: true,
 			},
 			err: Match("unmarshal json: unexpected end of JSON input"),
 		},
@@ -123,7 +124,8 @@ func TestRead(t *testing.T) {
 			s:     laxSchema,
 			input: `{"not":"json"`,
 			want: &line{
-				msg: `{"not":"json"`,
+				msg:         `{"not":"json"`,
+				invalidJSON: true,
 			},
 			err: Match("unmarshal json: unexpected end of JSON input"),
 		},
@@ -138,6 +140,39 @@ func TestRead(t *testing.T) {
 				fields: nil,
 			},
 		},
+		{
+			name:  "byte order mark and trailing nuls",
+			s:     basicSchema,
+			input: "\ufeff{\"t\":1.0,\"l\":\"info\",\"m\":\"hi\"}\x00\x00",
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "hi",
+				raw:  []byte(`{"t":1.0,"l":"info","m":"hi"}`),
+			},
+		},
+		{
+			name:  "byte order mark in lax mode",
+			s:     laxSchema,
+			input: "\ufeff{\"t\":1.0,\"l\":\"info\",\"m\":\"hi\"}",
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "hi",
+				raw:  []byte(`{"t":1.0,"l":"info","m":"hi"}`),
+			},
+		},
+		{
+			name:  "byte order mark on text in lax mode",
+			s:     laxSchema,
+			input: "\ufeffhello\x00",
+			want: &line{
+				msg:         "hello",
+				raw:         []byte("hello"),
+				invalidJSON: true,
+			},
+			err: Match("not a JSON object"),
+		},
 		{
 			name:  "basic successful parse with extra fields",
 			s:     basicSchema,
@@ -258,6 +293,80 @@ func TestRead(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "valid nested upgrade",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.UpgradeKeys = []string{"data.request"} }),
+			input: `{"t":1,"l":"info","m":"test","existed":true,"overwritten":"nope","data":{"request":{"key":"value","num":42.1,"overwritten":true},"other":1}}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "test",
+				fields: map[string]interface{}{
+					"existed":     true,
+					"key":         "value",
+					"num":         float64(42.1),
+					"overwritten": true,
+					"data":        map[string]interface{}{"other": float64(1)},
+				},
+			},
+		},
+		{
+			name:  "valid nested upgrade, overwrite self",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.UpgradeKeys = []string{"data.request"} }),
+			input: `{"t":1,"l":"info","m":"test","existed":true,"data":{"request":{"data":"hello","request":"world"}}}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "test",
+				fields: map[string]interface{}{
+					"existed": true,
+					"data":    "hello",
+					"request": "world",
+				},
+			},
+		},
+		{
+			name:  "valid upgrade of a top-level key with a dot",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.UpgradeKeys = []string{"data.request"} }),
+			input: `{"t":1,"l":"info","m":"test","data.request":{"key":"value"},"data":{"request":{"nested":true}}}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "test",
+				fields: map[string]interface{}{
+					"key":  "value",
+					"data": map[string]interface{}{"request": map[string]interface{}{"nested": true}},
+				},
+			},
+		},
+		{
+			name:  "valid nested upgrade, but nothing to upgrade",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.UpgradeKeys = []string{"data.request"} }),
+			input: `{"t":1,"l":"info","m":"test","existed":true,"data":"request"}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "test",
+				fields: map[string]interface{}{
+					"existed": true,
+					"data":    "request",
+				},
+			},
+		},
+		{
+			name:  "invalid nested upgrade",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.UpgradeKeys = []string{"data.request"} }),
+			input: `{"t":1,"l":"info","m":"test","data":{"request":["foo"]}}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "test",
+				fields: map[string]interface{}{
+					"data": map[string]interface{}{"request": []interface{}{"foo"}},
+				},
+			},
+			err: Match(`upgrade key "data.request": invalid data type.*got \[\]`),
+		},
 		{
 			name:  "valid upgrade, but nothing to upgrade",
 			s:     modifyBasicSchema(func(s *InputSchema) { s.UpgradeKeys = []string{"upgrade"} }),
@@ -303,6 +412,159 @@ func TestRead(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "delete exact and glob keys",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.DeleteKeys = []string{"gone", "debug.*", "x?"} }),
+			input: `{"t":1,"l":"info","m":"test","gone":1,"debug.a":2,"debug.b":3,"debug":4,"xy":5,"xyz":6}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "test",
+				fields: map[string]interface{}{
+					"debug": float64(4),
+					"xyz":   float64(6),
+				},
+			},
+		},
+		{
+			name:  "delete glob matching keys with slashes",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.DeleteKeys = []string{"kubernetes.*", "a?b", "x/*"} }),
+			input: `{"t":1,"l":"info","m":"test","kubernetes.io/name":"web","kubernetes.pod":"web-1","a/b":1,"x/y/z":2,"app":"web"}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "test",
+				fields: map[string]interface{}{
+					"app": "web",
+				},
+			},
+		},
+		{
+			name:  "delete glob after upgrade",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.UpgradeKeys = []string{"data"}; s.DeleteKeys = []string{"trace_*"} }),
+			input: `{"t":1,"l":"info","m":"test","data":{"trace_id":"abc","trace_span":"def","user":"me"}}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "test",
+				fields: map[string]interface{}{
+					"user": "me",
+				},
+			},
+		},
+		{
+			name:  "rename keys",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.RenameKeys = map[string]string{"http.request.method": "method", "absent": "x"} }),
+			input: `{"t":1,"l":"info","m":"test","http.request.method":"GET","path":"/"}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "test",
+				fields: map[string]interface{}{
+					"method": "GET",
+					"path":   "/",
+				},
+			},
+		},
+		{
+			name: "rename keys after upgrade and delete",
+			s: modifyBasicSchema(func(s *InputSchema) {
+				s.UpgradeKeys = []string{"data"}
+				s.DeleteKeys = []string{"method"}
+				s.RenameKeys = map[string]string{"verb": "method", "a": "b", "b": "a"}
+			}),
+			input: `{"t":1,"l":"info","m":"test","data":{"verb":"GET","method":"get"},"a":1,"b":2}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "test",
+				fields: map[string]interface{}{
+					"method": "GET",
+					"a":      float64(2),
+					"b":      float64(1),
+				},
+			},
+		},
+		{
+			name:  "rename keys to the same name",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.RenameKeys = map[string]string{"x": "y", "z": "y", "w": "y"} }),
+			input: `{"t":1,"l":"info","m":"test","x":1,"y":2,"z":3,"w":4}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "test",
+				fields: map[string]interface{}{
+					"y": float64(3),
+				},
+			},
+		},
+		{
+			name: "lowercase keys",
+			s: modifyBasicSchema(func(s *InputSchema) {
+				s.RenameKeys = map[string]string{"A": "B"}
+				s.LowercaseKeys = true
+			}),
+			input: `{"t":1,"l":"info","m":"test","A":1,"_PID":"1","Foo":2,"FOO":3,"x":4,"X":5}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "test",
+				fields: map[string]interface{}{
+					"b":    float64(1),
+					"_pid": "1",
+					"foo":  float64(3),
+					"Foo":  float64(2),
+					"x":    float64(4),
+					"X":    float64(5),
+				},
+			},
+		},
+		{
+			name:  "json in message",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.ParseMessageJSON = true; s.UpgradeKeys = []string{"req"} }),
+			input: `{"t":1,"l":"info","m":"request {id} completed {\"status\":200,\"a\":2,\"req\":{\"path\":\"/\"}} ","a":1}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "request {id} completed",
+				fields: map[string]interface{}{
+					"status": float64(200),
+					"a":      float64(2),
+					"path":   "/",
+				},
+			},
+		},
+		{
+			name:  "invalid json in message",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.ParseMessageJSON = true }),
+			input: `{"t":1,"l":"info","m":"template {name} has {braces}"}`,
+			want: &line{
+				time:   time.Unix(1, 0),
+				lvl:    LevelInfo,
+				msg:    "template {name} has {braces}",
+				fields: map[string]interface{}{},
+			},
+		},
+		{
+			name: "json in fields",
+			s: modifyBasicSchema(func(s *InputSchema) {
+				s.ParseJSONFields = []string{"payload", "list", "bad", "number", "object", "missing"}
+				s.UpgradeKeys = []string{"payload"}
+			}),
+			input: `{"t":1,"l":"info","m":"test","payload":"{\"a\":1}","list":" [1,2] ","bad":"{nope}","number":"42","object":{"b":2}}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "test",
+				fields: map[string]interface{}{
+					"a":      float64(1),
+					"list":   []interface{}{float64(1), float64(2)},
+					"bad":    "{nope}",
+					"number": "42",
+					"object": map[string]interface{}{"b": float64(2)},
+				},
+			},
+		},
 		{
 			name:  "log without time",
 			s:     modifyBasicSchema(func(s *InputSchema) { s.TimeKey = ""; s.NoTimeKey = true; s.TimeFormat = NoopTimeParser }),
@@ -367,6 +629,161 @@ func TestRead(t *testing.T) {
 			},
 		},
 
+		{
+			name: "alternate keys",
+			s: modifyBasicSchema(func(s *InputSchema) {
+				s.AltTimeKeys = []string{"time"}
+				s.AltLevelKeys = []string{"severity"}
+				s.AltMessageKeys = []string{"message", "log"}
+			}),
+			input: `{"time":1,"severity":"warn","log":"from log","message":"from message","extra":"is here"}`,
+			want: &line{
+				time:   time.Unix(1, 0),
+				lvl:    LevelWarn,
+				msg:    "from message",
+				fields: map[string]interface{}{"log": "from log", "extra": "is here"},
+			},
+		},
+		{
+			name: "missing alternate keys",
+			s: modifyBasicSchema(func(s *InputSchema) {
+				s.AltTimeKeys = []string{"time"}
+				s.AltMessageKeys = []string{"message", "log"}
+			}),
+			input: `{"l":"info"}`,
+			want: &line{
+				lvl: LevelInfo,
+			},
+			err: Match(`no time key "t" or "time" in incoming log; no message key "m", "message", or "log" in incoming log`),
+		},
+		{
+			name:  "trimmed message",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.TrimMessage = true }),
+			input: `{"t":1,"l":"info","m":"hi\r\n\n"}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "hi",
+			},
+		},
+		{
+			name:  "level from message",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.LevelFromMessage = regexp.MustCompile(`^\[(?P<level>\w+)\] `) }),
+			input: `{"t":1,"m":"[WARN] disk is full"}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelWarn,
+				msg:  "[WARN] disk is full",
+			},
+		},
+		{
+			name: "level stripped from message",
+			s: modifyBasicSchema(func(s *InputSchema) {
+				s.LevelFromMessage = regexp.MustCompile(`^\[(?P<level>\w+)\] `)
+				s.StripLevelFromMessage = true
+			}),
+			input: `{"t":1,"m":"[WARN] disk is full"}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelWarn,
+				msg:  "disk is full",
+			},
+		},
+		{
+			name: "level key preferred over level from message",
+			s: modifyBasicSchema(func(s *InputSchema) {
+				s.LevelFromMessage = regexp.MustCompile(`^\[(?P<level>\w+)\] `)
+				s.StripLevelFromMessage = true
+			}),
+			input: `{"t":1,"l":"error","m":"[WARN] disk is full"}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelError,
+				msg:  "[WARN] disk is full",
+			},
+		},
+		{
+			name: "unknown level in message",
+			s: modifyBasicSchema(func(s *InputSchema) {
+				s.LevelFromMessage = regexp.MustCompile(`^\[(?P<level>\w+)\] `)
+				s.StripLevelFromMessage = true
+			}),
+			input: `{"t":1,"m":"[main] starting up"}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				msg:  "[main] starting up",
+			},
+			err: Match(`no level key "l" in incoming log`),
+		},
+		{
+			name:  "ANSI escapes stripped",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.StripANSI = true }),
+			input: `{"t":1,"l":"info","m":"\u001b[1;31mfailed\u001b[0m","link":"\u001b]8;;http://example.com\u001b\\here\u001b]8;;\u001b\\","nested":{"list":["\u001b[32mok\u001b[m",1]}}`,
+			want: &line{
+				time:   time.Unix(1, 0),
+				lvl:    LevelInfo,
+				msg:    "failed",
+				fields: map[string]interface{}{"link": "here", "nested": map[string]interface{}{"list": []interface{}{"ok", float64(1)}}},
+			},
+		},
+		{
+			name:  "ANSI escapes kept by default",
+			s:     basicSchema,
+			input: `{"t":1,"l":"info","m":"\u001b[31mfailed\u001b[0m"}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelInfo,
+				msg:  "\x1b[31mfailed\x1b[0m",
+			},
+		},
+		{
+			name:  "ANSI escapes stripped from non-JSON lines",
+			s:     &InputSchema{Strict: false, StripANSI: true},
+			input: "\x1b[33mwarning:\x1b[0m something",
+			want: &line{
+				msg:         "warning: something",
+				invalidJSON: true,
+			},
+			err: Match("not a JSON object"),
+		},
+		{
+			name:  "lenient time, missing",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.LenientTime = true }),
+			input: `{"l":"info","m":"hi"}`,
+			want: &line{
+				lvl: LevelInfo,
+				msg: "hi",
+			},
+		},
+		{
+			name:  "lenient time, unparseable",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.LenientTime = true }),
+			input: `{"t":"yesterday","l":"info","m":"hi"}`,
+			want: &line{
+				lvl:    LevelInfo,
+				msg:    "hi",
+				fields: map[string]interface{}{"t": "yesterday"},
+			},
+		},
+		{
+			name:  "lenient time, other errors",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.LenientTime = true }),
+			input: `{"m":"hi"}`,
+			want: &line{
+				msg: "hi",
+			},
+			err: Match(`^no level key "l" in incoming log$`),
+		},
+		{
+			name:  "unknown level mapped",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.UnknownLevel = LevelWarn }),
+			input: `{"t":1,"l":"notice","m":"hi"}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelWarn,
+				msg:  "hi",
+			},
+		},
 		// Auto-guess tests
 		{
 			name:  "auto-guess zap",
@@ -393,21 +810,131 @@ func TestRead(t *testing.T) {
 			err: nil,
 		},
 		{
-			name:  "auto-guess stackdriver",
-			s:     &InputSchema{Strict: true},
-			input: `{"timestamp":{"seconds":1,"nanos":1},"message":"hi","severity":"info","extra":"is here"}`,
+			name:  "level object with name subkey",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.LevelSubkey = "name" }),
+			input: `{"t":1,"l":{"name":"WARN","value":40},"m":"hi"}`,
 			want: &line{
-				time:   time.Unix(1, 1),
-				lvl:    LevelInfo,
-				msg:    `hi`,
-				fields: map[string]interface{}{"extra": "is here"},
+				time: time.Unix(1, 0),
+				lvl:  LevelWarn,
+				msg:  "hi",
 			},
-			err: nil,
 		},
 		{
-			name:  "auto-guess logrus",
-			s:     &InputSchema{Strict: true},
-			input: `{"time":"1970-01-01T00:00:01.001Z","msg":"hi","level":"info","extra":"is here"}`,
+			name: "level object with value subkey",
+			s: modifyBasicSchema(func(s *InputSchema) {
+				s.LevelSubkey = "value"
+				s.LevelFormat = BunyanV0LevelParser
+			}),
+			input: `{"t":1,"l":{"name":"WARN","value":40},"m":"hi"}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelWarn,
+				msg:  "hi",
+			},
+		},
+		{
+			name:  "level object missing subkey",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.LevelSubkey = "name" }),
+			input: `{"t":1,"l":{"value":40},"m":"hi"}`,
+			want: &line{
+				time:   time.Unix(1, 0),
+				msg:    "hi",
+				fields: map[string]interface{}{"l": map[string]interface{}{"value": float64(40)}},
+			},
+			err: Match(`level key "l": invalid <nil>`),
+		},
+		{
+			name:  "level object without subkey configured",
+			s:     basicSchema,
+			input: `{"t":1,"l":{"name":"WARN"},"m":"hi"}`,
+			want: &line{
+				time:   time.Unix(1, 0),
+				msg:    "hi",
+				fields: map[string]interface{}{"l": map[string]interface{}{"name": "WARN"}},
+			},
+			err: Match(`level key "l": invalid map`),
+		},
+		{
+			name:  "preserved level key",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.PreserveKeys = []string{"l"} }),
+			input: `{"t":1,"l":"warning","m":"hi"}`,
+			want: &line{
+				time:   time.Unix(1, 0),
+				lvl:    LevelWarn,
+				msg:    "hi",
+				fields: map[string]interface{}{"l": "warning"},
+			},
+		},
+		{
+			name:  "all keys preserved",
+			s:     modifyBasicSchema(func(s *InputSchema) { s.PreserveKeys = []string{"t", "l", "m", "unused"} }),
+			input: `{"t":1,"l":"info","m":"hi"}`,
+			want: &line{
+				time:   time.Unix(1, 0),
+				lvl:    LevelInfo,
+				msg:    "hi",
+				fields: map[string]interface{}{"t": float64(1), "l": "info", "m": "hi"},
+			},
+		},
+		{
+			name:  "auto-guess stackdriver",
+			s:     &InputSchema{Strict: true},
+			input: `{"timestamp":{"seconds":1,"nanos":1},"message":"hi","severity":"info","extra":"is here"}`,
+			want: &line{
+				time:   time.Unix(1, 1),
+				lvl:    LevelInfo,
+				msg:    `hi`,
+				fields: map[string]interface{}{"extra": "is here"},
+			},
+			err: nil,
+		},
+		{
+			name:  "auto-guess ecs",
+			s:     &InputSchema{Strict: true},
+			input: `{"@timestamp":"1970-01-01T00:00:01.001Z","log.level":"warn","message":"hi","ecs.version":"1.6.0","log.logger":"test"}`,
+			want: &line{
+				time:   time.Unix(1, 1e6),
+				lvl:    LevelWarn,
+				msg:    `hi`,
+				fields: map[string]interface{}{"log.logger": "test"},
+			},
+			err: nil,
+		},
+		{
+			name:  "auto-guess ecs (nested)",
+			s:     &InputSchema{Strict: true},
+			input: `{"@timestamp":"1970-01-01T00:00:01.001Z","log":{"level":"warn","logger":"test"},"message":"hi","service":{"name":"foo"}}`,
+			want: &line{
+				time:   time.Unix(1, 1e6),
+				lvl:    LevelWarn,
+				msg:    `hi`,
+				fields: map[string]interface{}{"service": map[string]interface{}{"name": "foo"}},
+			},
+			err: nil,
+		},
+		{
+			name:  "auto-guess without a level key",
+			s:     &InputSchema{Strict: true, LevelFromMessage: regexp.MustCompile(`^\[(?P<level>\w+)\] `)},
+			input: `{"ts":1,"msg":"[WARN] disk low"}`,
+			want: &line{
+				time: time.Unix(1, 0),
+				lvl:  LevelWarn,
+				msg:  "[WARN] disk low",
+			},
+		},
+		{
+			name:  "no auto-guess without a level key or --level-from-message",
+			s:     &InputSchema{Strict: true},
+			input: `{"ts":1,"msg":"[WARN] disk low"}`,
+			want: &line{
+				fields: map[string]interface{}{"ts": float64(1), "msg": "[WARN] disk low"},
+			},
+			err: Match(`no time key`),
+		},
+		{
+			name:  "auto-guess logrus",
+			s:     &InputSchema{Strict: true},
+			input: `{"time":"1970-01-01T00:00:01.001Z","msg":"hi","level":"info","extra":"is here"}`,
 			want: &line{
 				time:   time.Unix(1, 1e6),
 				lvl:    LevelInfo,
@@ -446,7 +973,9 @@ func TestRead(t *testing.T) {
 			l := new(line)
 			l.fields = make(map[string]interface{})
 			l.raw = []byte(test.input)
-			test.want.raw = []byte(test.input)
+			if test.want.raw == nil {
+				test.want.raw = []byte(test.input)
+			}
 			err := test.s.ReadLine(l)
 			if diff := cmp.Diff(l, test.want, cmp.AllowUnexported(line{}), cmpopts.EquateEmpty()); diff != "" {
 				t.Errorf("parsed line differs: %v", diff)
@@ -522,11 +1051,14 @@ func (f *testFormatter) FormatField(s *State, k string, v interface{}, w *bytes.
 
 func TestEmit(t *testing.T) {
 	tests := []struct {
-		name      string
-		state     State
-		line      line
-		want      string
-		wantState State
+		name           string
+		state          State
+		sortFields     bool
+		fieldSort      FieldSort
+		separatorStats bool
+		line           line
+		want           string
+		wantState      State
 	}{
 
 		{
@@ -593,6 +1125,85 @@ func TestEmit(t *testing.T) {
 				seenFields: []string{"foo", "bar"},
 			},
 		},
+		{
+			name: "sorted fields ignore remembered fields",
+			line: line{
+				time: time.Unix(4, 0),
+				lvl:  LevelDebug,
+				msg:  "hi",
+				fields: map[string]interface{}{
+					"foo": "this is foo",
+					"bar": "this is bar",
+					"baz": "this is baz",
+				},
+			},
+			sortFields: true,
+			state:      State{seenFields: []string{"foo"}},
+			want:       "{LVL:D} {TS:4} {MSG:hi} {F:BAZ:this is baz} {F:BAR:this is bar} {F:FOO:this is foo}\n",
+			wantState:  State{seenFields: []string{"foo"}},
+		},
+		{
+			name: "new fields by value length",
+			line: line{
+				time: time.Unix(5, 0),
+				lvl:  LevelInfo,
+				msg:  "hi",
+				fields: map[string]interface{}{
+					"a":    "a long string",
+					"b":    float64(42),
+					"c":    "x",
+					"d":    map[string]interface{}{"k": "v"},
+					"seen": "remembered fields stay first",
+				},
+			},
+			fieldSort: FieldSortValueLength,
+			state:     State{seenFields: []string{"seen"}},
+			want:      "{LVL:I} {TS:5} {MSG:hi} {F:SEEN:remembered fields stay first} {F:C:x} {F:B:42} {F:D:map[k:v]} {F:A:a long string}\n",
+			wantState: State{seenFields: []string{"seen", "c", "b", "d", "a"}},
+		},
+		{
+			name: "new fields by type",
+			line: line{
+				time: time.Unix(6, 0),
+				lvl:  LevelInfo,
+				msg:  "hi",
+				fields: map[string]interface{}{
+					"a":   []interface{}{"x"},
+					"b":   "string",
+					"c":   true,
+					"d":   nil,
+					"e":   float64(1),
+					"f":   "another string",
+					"baz": map[string]interface{}{},
+				},
+			},
+			fieldSort: FieldSortType,
+			want:      "{LVL:I} {TS:6} {MSG:hi} {F:BAZ:map[]} {F:D:<nil>} {F:C:true} {F:E:1} {F:B:string} {F:F:another string} {F:A:[x]}\n",
+			wantState: State{seenFields: []string{"d", "c", "e", "b", "f", "a"}},
+		},
+		{
+			name: "separator",
+			line: line{isSeparator: true, skipped: 1240},
+			want: "---\n",
+		},
+		{
+			name:           "separator with stats",
+			separatorStats: true,
+			line:           line{isSeparator: true, skipped: 1240},
+			want:           "--- 1,240 lines ---\n",
+		},
+		{
+			name:           "separator with stats, one line",
+			separatorStats: true,
+			line:           line{isSeparator: true, skipped: 1},
+			want:           "--- 1 line ---\n",
+		},
+		{
+			name:           "separator with stats, many lines",
+			separatorStats: true,
+			line:           line{isSeparator: true, skipped: 123456789},
+			want:           "--- 123,456,789 lines ---\n",
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -602,7 +1213,11 @@ func TestEmit(t *testing.T) {
 				Formatter:      f,
 				EmitErrorFn:    func(x string) { panic("unused") },
 				PriorityFields: []string{"baz"},
+				SortFields:     test.sortFields,
+				FieldSort:      test.fieldSort,
 				state:          test.state,
+
+				ContextSeparatorStats: test.separatorStats,
 			}
 			s.Emit(&test.line, w)
 			if diff := cmp.Diff(w.String(), test.want); diff != "" {
@@ -723,6 +1338,55 @@ func TestReadLog(t *testing.T) {
 			wantErrs:     nil,
 			wantFinalErr: nil,
 		},
+		{
+			name: "jq program using the time of the previous line",
+			r: strings.NewReader(strings.Join([]string{
+				`{"t":1,"l":"info","m":"first"}`,
+				`{"t":2,"l":"info","m":"fast"}`,
+				`{"t":5,"l":"info","m":"slow"}`,
+				`{"t":5.5,"l":"info","m":"fast"}`,
+			}, "\n")),
+			w:            new(bytes.Buffer),
+			is:           basicSchema,
+			jq:           `select(elapsed > 1) | {elapsed: elapsed, last: $LAST_TS}`,
+			wantOutput:   "{LVL:I} {TS:5} {MSG:slow} {F:ELAPSED:3} {F:LAST:2}\n",
+			wantSummary:  Summary{Lines: 4, Filtered: 3},
+			wantErrs:     nil,
+			wantFinalErr: nil,
+		},
+		{
+			// Filtered lines still count as the previous line; otherwise, filtering on
+			// elapsed could never select anything.
+			name: "jq program using the time of a filtered previous line",
+			r: strings.NewReader(strings.Join([]string{
+				`{"t":1,"l":"info","m":"first"}`,
+				`{"t":5,"l":"debug","m":"filtered"}`,
+				`{"t":6,"l":"info","m":"third"}`,
+			}, "\n")),
+			w:            new(bytes.Buffer),
+			is:           basicSchema,
+			jq:           `select($LVL>=$INFO) | .e = elapsed`,
+			wantOutput:   "{LVL:I} {TS:1} {MSG:first} {F:E:0}\n{LVL:I} {TS:6} {MSG:third} {F:E:1}\n",
+			wantSummary:  Summary{Lines: 3, Filtered: 1},
+			wantErrs:     nil,
+			wantFinalErr: nil,
+		},
+		{
+			name: "mixed time units",
+			r: strings.NewReader(strings.Join([]string{
+				`{"t":1600000000,"l":"info","m":"seconds"}`,
+				`{"t":1600000001000,"l":"info","m":"milliseconds"}`,
+				`{"t":1600000002,"l":"info","m":"seconds"}`,
+			}, "\n")),
+			w:  new(bytes.Buffer),
+			is: basicSchema,
+			wantOutput: "{LVL:I} {TS:1600000000} {MSG:seconds}\n" +
+				"{LVL:I} {TS:1600000001000} {MSG:milliseconds}\n" +
+				"{LVL:I} {TS:1600000002} {MSG:seconds}\n",
+			wantSummary:  Summary{Lines: 3},
+			wantErrs:     []error{Match(`^warning: time jumped from 2020-09-13T12:26:40Z to 52671-.*--epoch-unit`)},
+			wantFinalErr: nil,
+		},
 		{
 			name:         "broken json",
 			r:            strings.NewReader("this is not json\n{\"t\":1,\"m\":\"but this is\",\"l\":\"info\"}\n"),
@@ -733,6 +1397,56 @@ func TestReadLog(t *testing.T) {
 			wantErrs:     []error{Match("unmarshal json")},
 			wantFinalErr: nil,
 		},
+		{
+			name: "repeated errors",
+			r: strings.NewReader(strings.Repeat(`{"t":1,"m":"no level"}`+"\n", 3) +
+				goodLine +
+				`{"t":1,"m":"no level"}` + "\n" +
+				"this is not json\n"),
+			w:  new(bytes.Buffer),
+			is: basicSchema,
+			wantOutput: strings.Repeat(`{"t":1,"m":"no level"}`+"\n", 3) +
+				"{LVL:I} {TS:1} {MSG:hi} {F:A:42}\n" +
+				`{"t":1,"m":"no level"}` + "\n" +
+				"this is not json\n",
+			wantSummary: Summary{Lines: 6, Errors: 5},
+			wantErrs: []error{
+				Match(`^parse: no level key "l" in incoming log$`),
+				Match(`^\(repeated 3 more times\)$`),
+				Match("unmarshal json"),
+			},
+			wantFinalErr: nil,
+		},
+		{
+			name:         "aborting at broken json",
+			r:            strings.NewReader(goodLine + "this is not json\n" + goodLine),
+			w:            new(bytes.Buffer),
+			is:           modifyBasicSchema(func(s *InputSchema) { s.AbortOnInvalidJSON = true }),
+			wantOutput:   "{LVL:I} {TS:1} {MSG:hi} {F:A:42}\nthis is not json\n",
+			wantSummary:  Summary{Lines: 2, Errors: 1},
+			wantErrs:     nil,
+			wantFinalErr: Match("input line 2: aborting at invalid json: unmarshal json"),
+		},
+		{
+			name:         "aborting at broken json with lax schema",
+			r:            strings.NewReader(goodLine + "this is not json\n" + goodLine),
+			w:            new(bytes.Buffer),
+			is:           modifyBasicSchema(func(s *InputSchema) { s.AbortOnInvalidJSON = true; s.Strict = false }),
+			wantOutput:   "{LVL:I} {TS:1} {MSG:hi} {F:A:42}\nthis is not json\n",
+			wantSummary:  Summary{Lines: 2, Errors: 1},
+			wantErrs:     nil,
+			wantFinalErr: Match("input line 2: aborting at invalid json: not a JSON object"),
+		},
+		{
+			name:         "not aborting at other parse errors",
+			r:            strings.NewReader(`{"t":1,"m":"no level"}` + "\n" + goodLine),
+			w:            new(bytes.Buffer),
+			is:           modifyBasicSchema(func(s *InputSchema) { s.AbortOnInvalidJSON = true }),
+			wantOutput:   "{\"t\":1,\"m\":\"no level\"}\n{LVL:I} {TS:1} {MSG:hi} {F:A:42}\n",
+			wantSummary:  Summary{Lines: 2, Errors: 1},
+			wantErrs:     []error{Match("no level key")},
+			wantFinalErr: nil,
+		},
 		{
 			name:         "broken json with lax schema",
 			r:            strings.NewReader("this is not json\n{\"t\":1,\"m\":\"but this is\",\"l\":\"info\"}\n"),
@@ -765,6 +1479,36 @@ func TestReadLog(t *testing.T) {
 			wantErrs:     []error{Match("no time key")},
 			wantFinalErr: nil,
 		},
+		{
+			name:         "line that's too long",
+			r:            strings.NewReader(goodLine + strings.Repeat("x", LineBufferSize+1) + "\n" + goodLine),
+			w:            new(bytes.Buffer),
+			is:           basicSchema,
+			wantOutput:   "{LVL:I} {TS:1} {MSG:hi} {F:A:42}\n{LVL:I} {TS:1} {MSG:hi} {F:A:<same>}\n",
+			wantSummary:  Summary{Lines: 3, Errors: 1},
+			wantErrs:     []error{Match("line longer than 1048576 bytes; skipped")},
+			wantFinalErr: nil,
+		},
+		{
+			name:         "line that's too long, truncated",
+			r:            strings.NewReader(goodLine + strings.Repeat("x", LineBufferSize+1) + "\n" + goodLine),
+			w:            new(bytes.Buffer),
+			is:           modifyBasicSchema(func(s *InputSchema) { s.LongLines = LongLineTruncate }),
+			wantOutput:   "{LVL:I} {TS:1} {MSG:hi} {F:A:42}\n" + strings.Repeat("x", LineBufferSize) + " (truncated)\n{LVL:I} {TS:1} {MSG:hi} {F:A:<same>}\n",
+			wantSummary:  Summary{Lines: 3, Errors: 1},
+			wantErrs:     []error{Match("line longer than 1048576 bytes; truncated")},
+			wantFinalErr: nil,
+		},
+		{
+			name:         "line that's too long, error",
+			r:            strings.NewReader(goodLine + strings.Repeat("x", LineBufferSize+1) + "\n" + goodLine),
+			w:            new(bytes.Buffer),
+			is:           modifyBasicSchema(func(s *InputSchema) { s.LongLines = LongLineError }),
+			wantOutput:   "{LVL:I} {TS:1} {MSG:hi} {F:A:42}\n",
+			wantSummary:  Summary{Lines: 2, Errors: 1},
+			wantErrs:     nil,
+			wantFinalErr: Match("input line 2: line longer than 1048576 bytes: bufio.Scanner: token too long"),
+		},
 		{
 			name:         "read error midway through a line",
 			r:            &errReader{data: []byte(goodLine + goodLine), err: errors.New("explosion"), n: len(goodLine) + 5},
@@ -805,6 +1549,16 @@ func TestReadLog(t *testing.T) {
 			wantErrs:     nil,
 			wantFinalErr: Match("broken pipe.*while flushing buffer after error"),
 		},
+		{
+			name:         "write error after a line that only partially parsed",
+			r:            strings.NewReader(`{"t":1,"m":"hi","a":42}`),
+			w:            &errWriter{n: 9},
+			is:           laxSchema,
+			wantOutput:   "{LVL:X} {",
+			wantSummary:  Summary{Lines: 1, Errors: 1},
+			wantErrs:     nil,
+			wantFinalErr: Match(`broken pipe \(while flushing buffer after error parse: no level key "l" in incoming log\)`),
+		},
 		{
 			name:         "filtering out a line with select",
 			r:            strings.NewReader(goodLine + goodLine),
@@ -865,7 +1619,7 @@ func TestReadLog(t *testing.T) {
 			wantOutput:   `{LVL:I} {TS:1} {MSG:m} {F:A:first} ` + `{"t":1,"l":"info","m":"m","a":"first","foo":"panic"}` + "\n",
 			wantSummary:  Summary{Lines: 1, Errors: 1, Filtered: 0},
 			wantErrs:     nil,
-			wantFinalErr: Match("panic"),
+			wantFinalErr: Match(`^input line 1: panic: panic \(while processing line .*\\"foo\\":\\"panic\\"}"\)$`),
 		},
 		{
 			name: "log without time, level, and message",
@@ -921,60 +1675,810 @@ func TestReadLog(t *testing.T) {
 			wantFinalErr: Match("goodbye"),
 		},
 		{
-			name:         "returning multiple lines from jq",
-			r:            strings.NewReader(goodLine),
-			w:            new(bytes.Buffer),
-			is:           basicSchema,
-			jq:           "{},{}",
-			wantOutput:   goodLine,
-			wantSummary:  Summary{Lines: 1, Errors: 1, Filtered: 0},
-			wantErrs:     nil,
-			wantFinalErr: Match("unexpectedly produced more than 1 output"),
+			name:         "returning multiple lines from jq",
+			r:            strings.NewReader(goodLine),
+			w:            new(bytes.Buffer),
+			is:           basicSchema,
+			jq:           "{},{}",
+			wantOutput:   goodLine,
+			wantSummary:  Summary{Lines: 1, Errors: 1, Filtered: 0},
+			wantErrs:     nil,
+			wantFinalErr: Match("unexpectedly produced more than 1 output"),
+		},
+		{
+			name:         "highlighting messages",
+			r:            strings.NewReader(`{"t":1,"l":"info","m":"hi","a":42}` + "\n" + `{"t":1,"l":"warn","m":"hi","a":42}` + "\n"),
+			w:            new(bytes.Buffer),
+			is:           basicSchema,
+			jq:           `highlight($LVL==$WARN)`,
+			wantOutput:   "{LVL:I} {TS:1} {MSG:hi} {F:A:42}\n{LVL:W} {TS:1} {MSG:[hi]} {F:A:<same>}\n",
+			wantSummary:  Summary{Lines: 2},
+			wantErrs:     nil,
+			wantFinalErr: nil,
+		},
+	}
+	for _, test := range testData {
+		var gotErrs []error
+		os := &OutputSchema{
+			Formatter:      &testFormatter{},
+			EmitErrorFn:    func(x string) { gotErrs = append(gotErrs, errors.New(x)) },
+			PriorityFields: []string{"a", "t", "l", "m"},
+			state:          State{lastFields: make(map[string][]byte)},
+		}
+
+		t.Run(test.name, func(t *testing.T) {
+			fs := new(FilterScheme)
+			if err := fs.AddJQ(test.jq, nil); err != nil {
+				t.Fatalf("add jq: %v", err)
+			}
+			if err := fs.AddMatchRegex(test.matchrx); err != nil {
+				t.Fatalf("add matchregex: %v", err)
+			}
+			if err := fs.AddNoMatchRegex(test.nomatchrx); err != nil {
+				t.Fatalf("add nomatchregex: %v", err)
+			}
+			summary, err := ReadLog(test.r, test.w, test.is, os, fs)
+			if diff := cmp.Diff(test.w.String(), test.wantOutput); diff != "" {
+				t.Errorf("output: %v", diff)
+			}
+			if diff := cmp.Diff(summary, test.wantSummary); diff != "" {
+				t.Errorf("summary: %v", diff)
+			}
+			if diff := cmp.Diff(gotErrs, test.wantErrs, cmp.Comparer(comperror)); diff != "" {
+				t.Errorf("intermediate errors: %v", diff)
+			}
+			if got, want := err, test.wantFinalErr; !comperror(got, want) {
+				t.Errorf("final error:\n  got: %v\n want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestReadLogNoRawEcho(t *testing.T) {
+	r := strings.NewReader("this is not json\n" + goodLine)
+	w := new(bytes.Buffer)
+	var gotErrs []error
+	os := &OutputSchema{
+		Formatter:   &testFormatter{},
+		EmitErrorFn: func(x string) { gotErrs = append(gotErrs, errors.New(x)) },
+		NoRawEcho:   true,
+	}
+	summary, err := ReadLog(r, w, basicSchema, os, new(FilterScheme))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(w.String(), "{LVL:I} {TS:1} {MSG:hi} {F:A:42}\n"); diff != "" {
+		t.Errorf("output: %v", diff)
+	}
+	if diff := cmp.Diff(summary, Summary{Lines: 2, Errors: 1}); diff != "" {
+		t.Errorf("summary: %v", diff)
+	}
+	if diff := cmp.Diff(gotErrs, []error{Match("unmarshal json")}, cmp.Comparer(comperror)); diff != "" {
+		t.Errorf("errors: %v", diff)
+	}
+}
+
+func TestReadLogMaxErrorRepeats(t *testing.T) {
+	r := strings.NewReader(strings.Repeat(`{"t":1,"m":"no level"}`+"\n", 5) + goodLine)
+	var gotErrs []error
+	os := &OutputSchema{
+		Formatter:       &testFormatter{},
+		EmitErrorFn:     func(x string) { gotErrs = append(gotErrs, errors.New(x)) },
+		NoRawEcho:       true,
+		MaxErrorRepeats: 2,
+	}
+	summary, err := ReadLog(r, io.Discard, basicSchema, os, new(FilterScheme))
+	if want := Match(`^input line 3: giving up after the same error was repeated 2 times in a row: parse: no level key`); !comperror(err, want) {
+		t.Errorf("final error:\n  got: %v\n want: %v", err, want)
+	}
+	if diff := cmp.Diff(summary, Summary{Lines: 3, Errors: 3}); diff != "" {
+		t.Errorf("summary: %v", diff)
+	}
+	wantErrs := []error{Match("no level key"), Match(`^\(repeated 2 more times\)$`)}
+	if diff := cmp.Diff(gotErrs, wantErrs, cmp.Comparer(comperror)); diff != "" {
+		t.Errorf("errors: %v", diff)
+	}
+}
+
+func TestReadLogMaxErrorRepeatsLax(t *testing.T) {
+	r := strings.NewReader(strings.Repeat(`{"t":1,"m":"no level"}`+"\n", 5) + goodLine)
+	var gotErrs []string
+	os := &OutputSchema{
+		Formatter:       &testFormatter{},
+		EmitErrorFn:     func(x string) { gotErrs = append(gotErrs, x) },
+		MaxErrorRepeats: 2,
+	}
+	ins := modifyBasicSchema(func(s *InputSchema) { s.Strict = false })
+	summary, err := ReadLog(r, io.Discard, ins, os, new(FilterScheme))
+	if want := Match(`^input line 3: giving up after the same error was repeated 2 times in a row: parse: no level key`); !comperror(err, want) {
+		t.Errorf("final error:\n  got: %v\n want: %v", err, want)
+	}
+	if got, want := summary.Lines, 3; got != want {
+		t.Errorf("lines read:\n  got: %v\n want: %v", got, want)
+	}
+	if len(gotErrs) > 0 {
+		t.Errorf("lax mode printed errors: %v", gotErrs)
+	}
+}
+
+func TestReadLogSample(t *testing.T) {
+	var input []string
+	for i := 1; i <= 10; i++ {
+		lvl := "info"
+		if i%2 == 0 {
+			lvl = "error"
+		}
+		input = append(input, fmt.Sprintf(`{"t":%d,"l":"%s","m":"line %d"}`, i, lvl, i))
+	}
+	testData := []struct {
+		name         string
+		every        int
+		jq           string
+		jobs         int
+		want         []string
+		wantFiltered int
+	}{
+		{
+			name:  "every third line",
+			every: 3,
+			want: []string{
+				"{LVL:I} {TS:1} {MSG:line 1}",
+				"{LVL:X} {TS:4} {MSG:line 4}",
+				"{LVL:I} {TS:7} {MSG:line 7}",
+				"{LVL:X} {TS:10} {MSG:line 10}",
+			},
+			wantFiltered: 6,
+		},
+		{
+			name:  "after filtering",
+			every: 2,
+			jq:    `select($LVL==$ERROR)`,
+			want: []string{
+				"{LVL:X} {TS:2} {MSG:line 2}",
+				"{LVL:X} {TS:6} {MSG:line 6}",
+				"{LVL:X} {TS:10} {MSG:line 10}",
+			},
+			wantFiltered: 7,
+		},
+		{
+			name:  "in parallel",
+			every: 3,
+			jobs:  4,
+			want: []string{
+				"{LVL:I} {TS:1} {MSG:line 1}",
+				"{LVL:X} {TS:4} {MSG:line 4}",
+				"{LVL:I} {TS:7} {MSG:line 7}",
+				"{LVL:X} {TS:10} {MSG:line 10}",
+			},
+			wantFiltered: 6,
+		},
+		{
+			name:         "off",
+			every:        1,
+			jq:           `select($LVL==$ERROR)`,
+			want:         []string{"{LVL:X} {TS:2} {MSG:line 2}", "{LVL:X} {TS:4} {MSG:line 4}", "{LVL:X} {TS:6} {MSG:line 6}", "{LVL:X} {TS:8} {MSG:line 8}", "{LVL:X} {TS:10} {MSG:line 10}"},
+			wantFiltered: 5,
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			w := new(bytes.Buffer)
+			os := &OutputSchema{Formatter: &testFormatter{}, EmitErrorFn: func(string) {}}
+			fs := &FilterScheme{SampleEvery: test.every}
+			if test.jq != "" {
+				if err := fs.AddJQ(test.jq, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ins := modifyBasicSchema(func(s *InputSchema) { s.Jobs = test.jobs })
+			sum, err := ReadLog(strings.NewReader(strings.Join(input, "\n")+"\n"), w, ins, os, fs)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n"), test.want); diff != "" {
+				t.Errorf("output:\n%s", diff)
+			}
+			if got, want := sum.Filtered, test.wantFiltered; got != want {
+				t.Errorf("filtered:\n  got: %v\n want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPanicError(t *testing.T) {
+	var deep func(n int) error
+	deep = func(n int) error {
+		if n == 0 {
+			return panicError("oh no", []byte(strings.Repeat("x", 300)))
+		}
+		return deep(n - 1)
+	}
+	err := fmt.Errorf("input line 1: %w", deep(50))
+	if got, want := err.Error(), `input line 1: panic: oh no (while processing line "`+strings.Repeat("x", 200)+`...")`; got != want {
+		t.Errorf("message:\n  got: %q\n want: %q", got, want)
+	}
+	var pe *PanicError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected a *PanicError; got %T", err)
+	}
+	stack := string(pe.Stack)
+	// 50 frames don't fit in the initial buffer.
+	if n := strings.Count(stack, "TestPanicError.func"); n < 50 {
+		t.Errorf("stack trace has %d frames of the test; want at least 50:\n%s", n, stack)
+	}
+	if strings.Contains(stack, "\x00") {
+		t.Error("stack trace contains unused buffer")
+	}
+}
+
+func TestReadLogJQErrorMode(t *testing.T) {
+	input := `{"t":1,"l":"info","m":"hi","a":1}` + "\n" +
+		`{"t":2,"l":"info","m":"hi","a":2}` + "\n" +
+		`{"t":3,"l":"info","m":"hi","a":3}` + "\n"
+	jq := `if .a == 2 then error("boom") elif .a == 3 then (., .) else .b = 1 end`
+	testData := []struct {
+		name       string
+		mode       JQErrorMode
+		wantOutput string
+	}{
+		{
+			name: "skip",
+			mode: JQErrorSkip,
+			wantOutput: "{LVL:I} {TS:1} {MSG:hi} {F:A:1} {F:B:1}\n" +
+				"{LVL:I} {TS:2} {MSG:hi} {F:A:2}\n" +
+				"{LVL:I} {TS:3} {MSG:hi} {F:A:3}\n",
+		},
+		{
+			name: "raw",
+			mode: JQErrorRaw,
+			wantOutput: "{LVL:I} {TS:1} {MSG:hi} {F:A:1} {F:B:1}\n" +
+				`{"t":2,"l":"info","m":"hi","a":2}` + "\n" +
+				`{"t":3,"l":"info","m":"hi","a":3}` + "\n",
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			var gotErrs []error
+			w := new(bytes.Buffer)
+			os := &OutputSchema{
+				Formatter:      &testFormatter{},
+				PriorityFields: []string{"a", "t", "l", "m"},
+				EmitErrorFn:    func(x string) { gotErrs = append(gotErrs, errors.New(x)) },
+			}
+			fs := &FilterScheme{JQErrorMode: test.mode}
+			if err := fs.AddJQ(jq, nil); err != nil {
+				t.Fatal(err)
+			}
+			summary, err := ReadLog(strings.NewReader(input), w, basicSchema, os, fs)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(summary, Summary{Lines: 3, Errors: 2}); diff != "" {
+				t.Errorf("summary: %v", diff)
+			}
+			if diff := cmp.Diff(w.String(), test.wantOutput); diff != "" {
+				t.Errorf("output: %v", diff)
+			}
+			wantErrs := []error{Match("boom"), Match("unexpectedly produced more than 1 output")}
+			if diff := cmp.Diff(gotErrs, wantErrs, cmp.Comparer(comperror)); diff != "" {
+				t.Errorf("errors: %v", diff)
+			}
+		})
+	}
+}
+
+func TestReadLogRawLinesInContext(t *testing.T) {
+	input := strings.Join([]string{
+		`{"t":1,"l":"info","m":"one"}`,
+		`{"t":2,"l":"error","m":"two"}`,
+		"panic: oh no",
+		"goroutine 1 [running]:",
+		"main.main()",
+		`{"t":3,"l":"info","m":"three"}`,
+		"not json",
+		`{"t":4,"l":"error","m":"four"}`,
+	}, "\n") + "\n"
+	testData := []struct {
+		name          string
+		before, after int
+		wantOutput    []string
+	}{
+		{
+			name:  "after",
+			after: 2,
+			wantOutput: []string{
+				"{LVL:X} {TS:2} {MSG:two}",
+				"panic: oh no",
+				"goroutine 1 [running]:",
+				"---",
+				"{LVL:X} {TS:4} {MSG:four}",
+			},
+		},
+		{
+			name:   "before",
+			before: 1,
+			wantOutput: []string{
+				"{LVL:I} {TS:1} {MSG:one}",
+				"{LVL:X} {TS:2} {MSG:two}",
+				"---",
+				"not json",
+				"{LVL:X} {TS:4} {MSG:four}",
+			},
+		},
+		{
+			name:   "contiguous",
+			before: 2,
+			after:  3,
+			wantOutput: []string{
+				"{LVL:I} {TS:1} {MSG:one}",
+				"{LVL:X} {TS:2} {MSG:two}",
+				"panic: oh no",
+				"goroutine 1 [running]:",
+				"main.main()",
+				"{LVL:I} {TS:3} {MSG:three}",
+				"not json",
+				"{LVL:X} {TS:4} {MSG:four}",
+			},
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			var gotErrs []error
+			w := new(bytes.Buffer)
+			os := &OutputSchema{
+				Formatter:     &testFormatter{},
+				EmitErrorFn:   func(x string) { gotErrs = append(gotErrs, errors.New(x)) },
+				BeforeContext: test.before,
+				AfterContext:  test.after,
+			}
+			fs := new(FilterScheme)
+			if err := fs.AddJQ(`select($LVL==$ERROR)`, nil); err != nil {
+				t.Fatal(err)
+			}
+			summary, err := ReadLog(strings.NewReader(input), w, basicSchema, os, fs)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(summary, Summary{Lines: 8, Errors: 4, Filtered: 2}); diff != "" {
+				t.Errorf("summary: %v", diff)
+			}
+			if diff := cmp.Diff(strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n"), test.wantOutput); diff != "" {
+				t.Errorf("output: %v", diff)
+			}
+			// Errors are reported whether or not the line is displayed.
+			if got, want := len(gotErrs), 4; got != want {
+				t.Errorf("errors:\n  got: %v\n want: %v", gotErrs, want)
+			}
+		})
+	}
+}
+
+func TestReadLogLineNumbers(t *testing.T) {
+	var input []string
+	for i := 1; i <= 12; i++ {
+		lvl := "info"
+		if i%4 == 0 {
+			lvl = "error"
+		}
+		input = append(input, fmt.Sprintf(`{"t":%d,"l":"%s","m":"line %d"}`, i, lvl, i))
+	}
+	input[4] = "not json"
+	w := new(bytes.Buffer)
+	os := &OutputSchema{
+		Formatter:             &testFormatter{},
+		EmitErrorFn:           func(string) {},
+		AfterContext:          1,
+		LineNumbers:           true,
+		ContextSeparatorStats: true,
+	}
+	fs := new(FilterScheme)
+	if err := fs.AddJQ(`select($LVL==$ERROR)`, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadLog(strings.NewReader(strings.Join(input, "\n")+"\n"), w, basicSchema, os, fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"4 {LVL:X} {TS:4} {MSG:line 4}",
+		"5 not json",
+		"6 --- 2 lines ---",
+		"8 {LVL:X} {TS:8} {MSG:line 8}",
+		"9 {LVL:I} {TS:9} {MSG:line 9}",
+		"10 --- 2 lines ---",
+		"12 {LVL:X} {TS:12} {MSG:line 12}",
+	}
+	if diff := cmp.Diff(strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n"), want); diff != "" {
+		t.Errorf("output: %v", diff)
+	}
+}
+
+func TestReadLogDedupe(t *testing.T) {
+	input := []string{
+		`{"t":1,"l":"info","m":"retrying","a":1}`,
+		`{"t":2,"l":"info","m":"retrying","a":1}`,
+		`{"t":3,"l":"info","m":"retrying","a":1}`,
+		`{"t":4,"l":"info","m":"retrying","a":2}`,
+		`not json`,
+		`not json`,
+		`{"t":5,"l":"error","m":"gave up"}`,
+		`{"t":6,"l":"info","m":"retrying","a":2}`,
+		`{"t":7,"l":"info","m":"retrying","a":2}`,
+	}
+	testData := []struct {
+		name       string
+		head, tail int
+		after      int
+		jq         string
+		want       []string
+	}{
+		{
+			name: "all",
+			want: []string{
+				"{LVL:I} {TS:1} {MSG:retrying} {F:A:1} (x3)",
+				"{LVL:I} {TS:4} {MSG:retrying} {F:A:2}",
+				"not json (x2)",
+				"{LVL:X} {TS:5} {MSG:gave up}",
+				"{LVL:I} {TS:6} {MSG:retrying} {F:A:2} (x2)",
+			},
+		},
+		{
+			name: "head",
+			head: 2,
+			want: []string{
+				"{LVL:I} {TS:1} {MSG:retrying} {F:A:1} (x3)",
+				"{LVL:I} {TS:4} {MSG:retrying} {F:A:2}",
+			},
+		},
+		{
+			name: "tail",
+			tail: 2,
+			want: []string{
+				"{LVL:X} {TS:5} {MSG:gave up}",
+				"{LVL:I} {TS:6} {MSG:retrying} {F:A:2} (x2)",
+			},
+		},
+		{
+			name:  "context",
+			after: 1,
+			jq:    `select($MSG == "gave up")`,
+			want: []string{
+				"{LVL:X} {TS:5} {MSG:gave up}",
+				"{LVL:I} {TS:6} {MSG:retrying} {F:A:2}",
+			},
+		},
+		{
+			name: "filtered",
+			jq:   `select(.a != 2)`,
+			want: []string{
+				"{LVL:I} {TS:1} {MSG:retrying} {F:A:1} (x3)",
+				"not json (x2)",
+				"{LVL:X} {TS:5} {MSG:gave up}",
+			},
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			w := new(bytes.Buffer)
+			os := &OutputSchema{
+				Formatter:    &testFormatter{},
+				EmitErrorFn:  func(string) {},
+				Dedupe:       true,
+				Head:         test.head,
+				Tail:         test.tail,
+				AfterContext: test.after,
+				CollectStats: true,
+			}
+			fs := new(FilterScheme)
+			if test.jq != "" {
+				if err := fs.AddJQ(test.jq, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sum, err := ReadLog(strings.NewReader(strings.Join(input, "\n")+"\n"), w, basicSchema, os, fs)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n"), test.want); diff != "" {
+				t.Errorf("output:\n%s", diff)
+			}
+			if test.name == "all" {
+				if got, want := sum.MessageCounts["retrying"], 6; got != want {
+					t.Errorf("deduped lines should be counted for each repeat: got %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadLogPassthroughNonJSON(t *testing.T) {
+	input := strings.Join([]string{
+		`=== starting up ===`,
+		`{"t":1,"l":"info","m":"hello","a":1}`,
+		"  \x1b[1mbanner\x1b[0m  ",
+		`{"t":2,"l":"info","m":"bye"}`,
+		`{"t":3,"l":"info","m":"bye"`,
+	}, "\n")
+	w := new(bytes.Buffer)
+	var errs []string
+	outs := &OutputSchema{
+		Formatter:          &testFormatter{},
+		EmitErrorFn:        func(msg string) { errs = append(errs, msg) },
+		PassthroughNonJSON: true,
+	}
+	fs := new(FilterScheme)
+	if err := fs.AddJQ(`select($MSG != "bye")`, nil); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := ReadLog(strings.NewReader(input), w, laxSchema, outs, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"=== starting up ===",
+		"{LVL:I} {TS:1} {MSG:hello} {F:A:1}",
+		"  \x1b[1mbanner\x1b[0m  ",
+		`{"t":3,"l":"info","m":"bye"`,
+	}
+	if diff := cmp.Diff(strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n"), want); diff != "" {
+		t.Errorf("output:\n%s", diff)
+	}
+	if len(errs) > 0 {
+		t.Errorf("lax mode should not report errors; got %v", errs)
+	}
+	if got, want := sum.Errors, 3; got != want {
+		t.Errorf("errors: got %v, want %v", got, want)
+	}
+}
+
+func TestReadLogHeadTail(t *testing.T) {
+	var input []string
+	for i := 1; i <= 10; i++ {
+		lvl := "info"
+		if i%3 == 0 {
+			lvl = "error"
+		}
+		input = append(input, fmt.Sprintf(`{"t":%d,"l":"%s","m":"line %d"}`, i, lvl, i))
+	}
+	input[6] = "not json"
+	testData := []struct {
+		name          string
+		head, tail    int
+		jq            string
+		after, jobs   int
+		noRawEcho     bool
+		wantOutput    []string
+		wantLinesRead int
+	}{
+		{
+			name: "head",
+			head: 2,
+			wantOutput: []string{
+				"{LVL:I} {TS:1} {MSG:line 1}",
+				"{LVL:I} {TS:2} {MSG:line 2}",
+			},
+			wantLinesRead: 2,
+		},
+		{
+			name: "head of matching lines",
+			head: 2,
+			jq:   `select($LVL==$ERROR)`,
+			wantOutput: []string{
+				"{LVL:X} {TS:3} {MSG:line 3}",
+				"{LVL:X} {TS:6} {MSG:line 6}",
+			},
+			wantLinesRead: 6,
+		},
+		{
+			name:  "head with context",
+			head:  3,
+			jq:    `select($LVL==$ERROR)`,
+			after: 1,
+			wantOutput: []string{
+				"{LVL:X} {TS:3} {MSG:line 3}",
+				"{LVL:I} {TS:4} {MSG:line 4}",
+				"---",
+				"{LVL:X} {TS:6} {MSG:line 6}",
+			},
+			wantLinesRead: 6,
+		},
+		{
+			name: "head, parallel",
+			head: 2,
+			jobs: 4,
+			wantOutput: []string{
+				"{LVL:I} {TS:1} {MSG:line 1}",
+				"{LVL:I} {TS:2} {MSG:line 2}",
+			},
+			wantLinesRead: 2,
+		},
+		{
+			name: "more head than lines",
+			head: 100,
+			jq:   `select($LVL==$ERROR)`,
+			wantOutput: []string{
+				"{LVL:X} {TS:3} {MSG:line 3}",
+				"{LVL:X} {TS:6} {MSG:line 6}",
+				"not json",
+				"{LVL:X} {TS:9} {MSG:line 9}",
+			},
+			wantLinesRead: 10,
+		},
+		{
+			name:      "head without raw echo",
+			head:      3,
+			jq:        `select($LVL==$ERROR)`,
+			noRawEcho: true,
+			wantOutput: []string{
+				"{LVL:X} {TS:3} {MSG:line 3}",
+				"{LVL:X} {TS:6} {MSG:line 6}",
+				"{LVL:X} {TS:9} {MSG:line 9}",
+			},
+			wantLinesRead: 9,
+		},
+		{
+			name:      "tail without raw echo",
+			tail:      4,
+			noRawEcho: true,
+			wantOutput: []string{
+				"{LVL:X} {TS:6} {MSG:line 6}",
+				"{LVL:I} {TS:8} {MSG:line 8}",
+				"{LVL:X} {TS:9} {MSG:line 9}",
+				"{LVL:I} {TS:10} {MSG:line 10}",
+			},
+			wantLinesRead: 10,
+		},
+		{
+			name: "tail",
+			tail: 4,
+			wantOutput: []string{
+				"not json",
+				"{LVL:I} {TS:8} {MSG:line 8}",
+				"{LVL:X} {TS:9} {MSG:line 9}",
+				"{LVL:I} {TS:10} {MSG:line 10}",
+			},
+			wantLinesRead: 10,
 		},
 		{
-			name:         "highlighting messages",
-			r:            strings.NewReader(`{"t":1,"l":"info","m":"hi","a":42}` + "\n" + `{"t":1,"l":"warn","m":"hi","a":42}` + "\n"),
-			w:            new(bytes.Buffer),
-			is:           basicSchema,
-			jq:           `highlight($LVL==$WARN)`,
-			wantOutput:   "{LVL:I} {TS:1} {MSG:hi} {F:A:42}\n{LVL:W} {TS:1} {MSG:[hi]} {F:A:<same>}\n",
-			wantSummary:  Summary{Lines: 2},
-			wantErrs:     nil,
-			wantFinalErr: nil,
+			name:  "tail with context",
+			tail:  3,
+			jq:    `select($LVL==$ERROR)`,
+			after: 1,
+			wantOutput: []string{
+				"not json",
+				"---",
+				"{LVL:X} {TS:9} {MSG:line 9}",
+				"{LVL:I} {TS:10} {MSG:line 10}",
+			},
+			wantLinesRead: 10,
 		},
 	}
 	for _, test := range testData {
-		var gotErrs []error
-		os := &OutputSchema{
-			Formatter:      &testFormatter{},
-			EmitErrorFn:    func(x string) { gotErrs = append(gotErrs, errors.New(x)) },
-			PriorityFields: []string{"a", "t", "l", "m"},
-			state:          State{lastFields: make(map[string][]byte)},
-		}
-
 		t.Run(test.name, func(t *testing.T) {
+			w := new(bytes.Buffer)
+			os := &OutputSchema{
+				Formatter:    &testFormatter{},
+				EmitErrorFn:  func(string) {},
+				AfterContext: test.after,
+				Head:         test.head,
+				Tail:         test.tail,
+				NoRawEcho:    test.noRawEcho,
+			}
 			fs := new(FilterScheme)
 			if err := fs.AddJQ(test.jq, nil); err != nil {
-				t.Fatalf("add jq: %v", err)
+				t.Fatal(err)
 			}
-			if err := fs.AddMatchRegex(test.matchrx); err != nil {
-				t.Fatalf("add matchregex: %v", err)
+			is := *basicSchema
+			is.Jobs = test.jobs
+			summary, err := ReadLog(strings.NewReader(strings.Join(input, "\n")+"\n"), w, &is, os, fs)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
 			}
-			if err := fs.AddNoMatchRegex(test.nomatchrx); err != nil {
-				t.Fatalf("add nomatchregex: %v", err)
+			if got, want := summary.Lines, test.wantLinesRead; got != want {
+				t.Errorf("lines read:\n  got: %v\n want: %v", got, want)
 			}
-			summary, err := ReadLog(test.r, test.w, test.is, os, fs)
-			if diff := cmp.Diff(test.w.String(), test.wantOutput); diff != "" {
+			if diff := cmp.Diff(strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n"), test.wantOutput); diff != "" {
 				t.Errorf("output: %v", diff)
 			}
-			if diff := cmp.Diff(summary, test.wantSummary); diff != "" {
-				t.Errorf("summary: %v", diff)
+		})
+	}
+}
+
+func TestReadLogGroupBy(t *testing.T) {
+	input := strings.Join([]string{
+		`{"t":1,"l":"info","m":"start","req":"a"}`,
+		`{"t":2,"l":"info","m":"start","req":"b"}`,
+		`{"t":3,"l":"info","m":"startup done"}`,
+		`{"t":4,"l":"error","m":"failed","req":"a"}`,
+		`{"t":5,"l":"info","m":"done","req":"b"}`,
+		`{"t":6,"l":"info","m":"start","req":42}`,
+	}, "\n") + "\n"
+	testData := []struct {
+		name       string
+		window     int
+		tail       int
+		jq         string
+		after      int
+		wantOutput []string
+	}{
+		{
+			name: "whole input",
+			wantOutput: []string{
+				"=== req=a: 2 lines ===",
+				"{LVL:I} {TS:1} {MSG:start} {F:REQ:a}",
+				"{LVL:X} {TS:4} {MSG:failed} {F:REQ:<same>}",
+				"=== req=b: 2 lines ===",
+				"{LVL:I} {TS:2} {MSG:start} {F:REQ:b}",
+				"{LVL:I} {TS:5} {MSG:done} {F:REQ:<same>}",
+				"=== no req: 1 line ===",
+				"{LVL:I} {TS:3} {MSG:startup done}",
+				"=== req=42: 1 line ===",
+				"{LVL:I} {TS:6} {MSG:start} {F:REQ:42}",
+			},
+		},
+		{
+			name:   "window",
+			window: 4,
+			wantOutput: []string{
+				"=== req=a: 2 lines ===",
+				"{LVL:I} {TS:1} {MSG:start} {F:REQ:a}",
+				"{LVL:X} {TS:4} {MSG:failed} {F:REQ:<same>}",
+				"=== req=b: 1 line ===",
+				"{LVL:I} {TS:2} {MSG:start} {F:REQ:b}",
+				"=== no req: 1 line ===",
+				"{LVL:I} {TS:3} {MSG:startup done}",
+				"=== req=b: 1 line ===",
+				"{LVL:I} {TS:5} {MSG:done} {F:REQ:b}",
+				"=== req=42: 1 line ===",
+				"{LVL:I} {TS:6} {MSG:start} {F:REQ:42}",
+			},
+		},
+		{
+			name: "tail",
+			tail: 3,
+			wantOutput: []string{
+				"=== req=a: 1 line ===",
+				"{LVL:X} {TS:4} {MSG:failed} {F:REQ:a}",
+				"=== req=b: 1 line ===",
+				"{LVL:I} {TS:5} {MSG:done} {F:REQ:b}",
+				"=== req=42: 1 line ===",
+				"{LVL:I} {TS:6} {MSG:start} {F:REQ:42}",
+			},
+		},
+		{
+			name:  "context separators are dropped",
+			jq:    `select(.req == "b")`,
+			after: 1,
+			wantOutput: []string{
+				"=== req=b: 2 lines ===",
+				"{LVL:I} {TS:2} {MSG:start} {F:REQ:b}",
+				"{LVL:I} {TS:5} {MSG:done} {F:REQ:<same>}",
+				"=== no req: 1 line ===",
+				"{LVL:I} {TS:3} {MSG:startup done}",
+				"=== req=42: 1 line ===",
+				"{LVL:I} {TS:6} {MSG:start} {F:REQ:42}",
+			},
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			w := new(bytes.Buffer)
+			os := &OutputSchema{
+				Formatter:    &testFormatter{},
+				EmitErrorFn:  func(string) {},
+				AfterContext: test.after,
+				Tail:         test.tail,
+				GroupBy:      "req",
+				GroupWindow:  test.window,
 			}
-			if diff := cmp.Diff(gotErrs, test.wantErrs, cmp.Comparer(comperror)); diff != "" {
-				t.Errorf("intermediate errors: %v", diff)
+			fs := new(FilterScheme)
+			if err := fs.AddJQ(test.jq, nil); err != nil {
+				t.Fatal(err)
 			}
-			if got, want := err, test.wantFinalErr; !comperror(got, want) {
-				t.Errorf("final error:\n  got: %v\n want: %v", got, want)
+			if _, err := ReadLog(strings.NewReader(input), w, basicSchema, os, fs); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n"), test.wantOutput); diff != "" {
+				t.Errorf("output: %v", diff)
 			}
 		})
 	}
@@ -1048,6 +2552,171 @@ var (
 	}
 )
 
+func TestReadLogParallel(t *testing.T) {
+	input := new(strings.Builder)
+	for i := 0; i < 1000; i++ {
+		switch {
+		case i%97 == 0:
+			fmt.Fprintf(input, "not json %d\n", i)
+		case i%89 == 0:
+			fmt.Fprintf(input, `{"ts":%d,"level":"info","msg":"broken %d"`+"\n", 1000+i, i)
+		default:
+			fmt.Fprintf(input, `{"ts":%d,"level":"info","msg":"line %d","a":%d}`+"\n", 1000+i, i, i%7)
+		}
+	}
+	testData := []struct {
+		name    string
+		strict  bool
+		jq      string
+		wantErr bool
+	}{
+		{
+			name: "guessed schema",
+		},
+		{
+			name:   "strict",
+			strict: true,
+		},
+		{
+			name: "jq",
+			jq:   `select(.a != 3) | .e = elapsed`,
+		},
+		{
+			name:    "filter error",
+			jq:      `if .a == 5 and $TS > 1500 then error("boom") else . end`,
+			wantErr: true,
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			read := func(jobs int) (string, Summary, []string, error) {
+				var errs []string
+				fs := new(FilterScheme)
+				if err := fs.AddJQ(test.jq, nil); err != nil {
+					t.Fatalf("add jq: %v", err)
+				}
+				outs := &OutputSchema{
+					Formatter:   &testFormatter{},
+					EmitErrorFn: func(x string) { errs = append(errs, x) },
+				}
+				ins := &InputSchema{Strict: test.strict, Jobs: jobs}
+				w := new(bytes.Buffer)
+				sum, err := ReadLog(strings.NewReader(input.String()), w, ins, outs, fs)
+				return w.String(), sum, errs, err
+			}
+			wantOutput, wantSummary, wantErrs, wantErr := read(1)
+			if got, want := wantErr != nil, test.wantErr; got != want {
+				t.Fatalf("sequential read: unexpected error %v", wantErr)
+			}
+			gotOutput, gotSummary, gotErrs, gotErr := read(4)
+			if diff := cmp.Diff(gotOutput, wantOutput); diff != "" {
+				t.Errorf("output:\n%s", diff)
+			}
+			if diff := cmp.Diff(gotSummary, wantSummary); diff != "" {
+				t.Errorf("summary:\n%s", diff)
+			}
+			if diff := cmp.Diff(gotErrs, wantErrs); diff != "" {
+				t.Errorf("intermediate errors:\n%s", diff)
+			}
+			if !comperror(gotErr, wantErr) {
+				t.Errorf("final error:\n  got: %v\n want: %v", gotErr, wantErr)
+			}
+		})
+	}
+}
+
+func TestReadLogParallelBlockedInput(t *testing.T) {
+	r, w := io.Pipe()
+	defer r.Close()
+	go func() {
+		// The input stays open, like a followed log, until the test is over.
+		w.Write([]byte(`{"ts":1,"level":"info","msg":"line 0"}` + "\nnot json\n"))
+	}()
+	out := new(bytes.Buffer)
+	outs := &OutputSchema{
+		Formatter:   &testFormatter{},
+		EmitErrorFn: func(string) {},
+	}
+	ins := &InputSchema{Jobs: 4, Strict: true, AbortOnInvalidJSON: true}
+	errCh := make(chan error)
+	go func() {
+		_, err := ReadLog(r, out, ins, outs, new(FilterScheme))
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		if want := Match(`^input line 2: aborting at invalid json`); !comperror(err, want) {
+			t.Errorf("error:\n  got: %v\n want: %v", err, want)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("ReadLog did not return while waiting for more input")
+	}
+	// Nothing may still be using the schema once ReadLog has returned; run with -race.
+	*ins = InputSchema{}
+}
+
+// Run with -race; nothing that ReadLog returns to the caller may still be in use by the parallel
+// goroutines once it returns.
+func TestReadLogParallelHead(t *testing.T) {
+	input := new(strings.Builder)
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(input, `{"ts":%d,"level":"info","msg":"line %d"}`+"\n", 1000+i, i)
+	}
+	for i := 0; i < 20; i++ {
+		w := new(bytes.Buffer)
+		ins := &InputSchema{Jobs: 4}
+		outs := &OutputSchema{
+			Formatter:   &testFormatter{},
+			EmitErrorFn: func(string) {},
+			Head:        3,
+		}
+		sum, err := ReadLog(strings.NewReader(input.String()), w, ins, outs, new(FilterScheme))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := "{LVL:I} {TS:1000} {MSG:line 0}\n{LVL:I} {TS:1001} {MSG:line 1}\n{LVL:I} {TS:1002} {MSG:line 2}\n"
+		if diff := cmp.Diff(w.String(), want); diff != "" {
+			t.Fatalf("output:\n%s", diff)
+		}
+		if got, want := sum.Lines, 3; got != want {
+			t.Errorf("lines read:\n  got: %v\n want: %v", got, want)
+		}
+		// Modify the schema, as a caller reusing it might.
+		*ins = InputSchema{}
+	}
+}
+
+func TestReadLogParallelHeadBlockedInput(t *testing.T) {
+	r, w := io.Pipe()
+	defer r.Close()
+	go func() {
+		// The input stays open, like a followed log, until the test is over.
+		w.Write([]byte(`{"ts":1,"level":"info","msg":"line 0"}` + "\n" + `{"ts":2,"level":"info","msg":"line 1"}` + "\n"))
+	}()
+	out := new(bytes.Buffer)
+	outs := &OutputSchema{
+		Formatter:   &testFormatter{},
+		EmitErrorFn: func(string) {},
+		Head:        1,
+	}
+	errCh := make(chan error)
+	go func() {
+		_, err := ReadLog(r, out, &InputSchema{Jobs: 4}, outs, new(FilterScheme))
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("ReadLog did not return while waiting for more input")
+	}
+	if diff := cmp.Diff(out.String(), "{LVL:I} {TS:1} {MSG:line 0}\n"); diff != "" {
+		t.Errorf("output:\n%s", diff)
+	}
+}
+
 func TestFullLog(t *testing.T) {
 	testData := []struct {
 		name                         string
@@ -1347,6 +3016,103 @@ func TestFullLog(t *testing.T) {
 	}
 }
 
+func TestFieldStats(t *testing.T) {
+	input := strings.Join([]string{
+		`{"t":1,"l":"info","m":"hi","a":1,"b":2}`,
+		`{"t":2,"l":"info","m":"hi","a":1,"c":3}`,
+		`{"t":3,"l":"info","m":"hi","a":1,"b":2,"drop":true}`,
+		`{"t":4,"l":"info","m":"hi","a":1,"b":2,"ccc":3}`,
+	}, "\n")
+	fs := new(FilterScheme)
+	if err := fs.AddJQ("select(.drop|not)", nil); err != nil {
+		t.Fatal(err)
+	}
+	outs := &OutputSchema{
+		Formatter:   &testFormatter{},
+		CountFields: true,
+		EmitErrorFn: func(msg string) { t.Errorf("unexpected error: %v", msg) },
+	}
+	sum, err := ReadLog(strings.NewReader(input), io.Discard, modifyBasicSchema(func(s *InputSchema) {}), outs, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(sum.FieldCounts, map[string]int{"a": 3, "b": 2, "c": 1, "ccc": 1}); diff != "" {
+		t.Errorf("field counts:\n%s", diff)
+	}
+	want := "  lines  field\n" +
+		"      3  a\n" +
+		"      2  b\n" +
+		"      1  c\n" +
+		"      1  ccc\n"
+	if diff := cmp.Diff(sum.FieldStats("  "), want); diff != "" {
+		t.Errorf("field stats:\n%s", diff)
+	}
+
+	sum, err = ReadLog(strings.NewReader(input), io.Discard, modifyBasicSchema(func(s *InputSchema) {}), &OutputSchema{Formatter: &testFormatter{}}, new(FilterScheme))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.FieldCounts != nil {
+		t.Errorf("expected no field counts when not counting; got %v", sum.FieldCounts)
+	}
+}
+
+func TestShowOriginal(t *testing.T) {
+	input := `{"t":1,"l":"info","m":"hi","a":1}` + "\n" + `{"t":2,"l":"info","m":"hi","a":2}` + "\n"
+	testData := []struct {
+		name, jq string
+		want     string
+	}{
+		{
+			name: "no jq",
+			want: "INFO  1970-01-01T00:00:01Z hi a:1\n" +
+				"INFO  1970-01-01T00:00:02Z hi a:2\n",
+		},
+		{
+			name: "identity",
+			jq:   ".",
+			want: "INFO  1970-01-01T00:00:01Z hi a:1\n" +
+				"INFO  1970-01-01T00:00:02Z hi a:2\n",
+		},
+		{
+			name: "select and highlight",
+			jq:   "select(.a > 1) | highlight(true)",
+			want: "INFO  1970-01-01T00:00:02Z hi a:2\n",
+		},
+		{
+			name: "transforming some lines",
+			jq:   "if .a > 1 then .b = .a * 2 else . end",
+			want: "INFO  1970-01-01T00:00:01Z hi a:1\n" +
+				"INFO  1970-01-01T00:00:02Z hi a:2 b:4\n" +
+				`  {"t":2,"l":"info","m":"hi","a":2}` + "\n",
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			fs := new(FilterScheme)
+			if err := fs.AddJQ(test.jq, nil); err != nil {
+				t.Fatal(err)
+			}
+			outs := &OutputSchema{
+				Formatter: &DefaultOutputFormatter{
+					Aurora:             aurora.NewAurora(false),
+					AbsoluteTimeFormat: time.RFC3339,
+					Zone:               time.UTC,
+				},
+				ShowOriginal: true,
+				EmitErrorFn:  func(msg string) { t.Errorf("unexpected error: %v", msg) },
+			}
+			w := new(bytes.Buffer)
+			if _, err := ReadLog(strings.NewReader(input), w, basicSchema, outs, fs); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(w.String(), test.want); diff != "" {
+				t.Errorf("output:\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestFormatSummary(t *testing.T) {
 	testData := []struct {
 		in   Summary
@@ -1387,3 +3153,247 @@ func TestFormatSummary(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatLine(t *testing.T) {
+	s := &OutputSchema{
+		Formatter:      &testFormatter{},
+		PriorityFields: []string{"a"},
+	}
+	fields := map[string]interface{}{"a": 1, "b": "foo"}
+	testData := []struct {
+		t       time.Time
+		lvl     Level
+		msg     string
+		want    string
+		wantErr error
+	}{
+		{
+			t:    time.Unix(1, 0),
+			lvl:  LevelInfo,
+			msg:  "hello",
+			want: "{LVL:I} {TS:1} {MSG:hello} {F:A:1} {F:B:foo}\n",
+		},
+		{
+			t:    time.Unix(2, 0),
+			lvl:  LevelWarn,
+			msg:  "hello again",
+			want: "{LVL:W} {TS:2} {MSG:hello again} {F:A:<same>} {F:B:<same>}\n",
+		},
+		{
+			t:       time.Unix(3, 0),
+			lvl:     LevelInfo,
+			msg:     panicMessage,
+			wantErr: Match("format line: panic"),
+		},
+	}
+	for _, test := range testData {
+		got, err := s.FormatLine(test.t, test.lvl, test.msg, fields)
+		if diff := cmp.Diff(string(got), test.want); diff != "" {
+			t.Errorf("output:\n%s", diff)
+		}
+		if !comperror(err, test.wantErr) {
+			t.Errorf("error:\n  got: %v\n want: %v", err, test.wantErr)
+		}
+	}
+	if diff := cmp.Diff(fields, map[string]interface{}{"a": 1, "b": "foo"}); diff != "" {
+		t.Errorf("fields were modified:\n%s", diff)
+	}
+
+	// A zero OutputSchema should work.
+	got, err := new(OutputSchema).FormatLine(time.Time{}, LevelInfo, "hi", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "INFO  ??? hi\n"; string(got) != want {
+		t.Errorf("output with default formatter:\n  got: %q\n want: %q", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	testData := []struct {
+		name    string
+		s       *InputSchema
+		input   string
+		want    ParsedLine
+		wantErr error
+	}{
+		{
+			name:  "basic",
+			s:     basicSchema,
+			input: `{"t":1,"l":"info","m":"hi","a":"test"}`,
+			want: ParsedLine{
+				Time:    time.Unix(1, 0),
+				Level:   LevelInfo,
+				Message: "hi",
+				Fields:  map[string]interface{}{"a": "test"},
+			},
+		},
+		{
+			name:  "guessed lager with upgrade",
+			s:     &InputSchema{Strict: true},
+			input: `{"timestamp":1.1,"message":"hi","log_level":1,"source":"test","data":{"extra":"is here"}}`,
+			want: ParsedLine{
+				Time:    time.Unix(1, 1e8),
+				Level:   LevelInfo,
+				Message: "hi",
+				Fields:  map[string]interface{}{"source": "test", "extra": "is here"},
+			},
+		},
+		{
+			name:  "not json",
+			s:     laxSchema,
+			input: `hello`,
+			want: ParsedLine{
+				Message: "hello",
+			},
+			wantErr: Match("not a JSON object"),
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.s.Parse([]byte(test.input))
+			test.want.Raw = []byte(test.input)
+			if diff := cmp.Diff(got, test.want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("parsed line:\n%s", diff)
+			}
+			if !comperror(err, test.wantErr) {
+				t.Errorf("error:\n  got: %v\n want: %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(fromParsedLine(got).toParsedLine(), got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("round trip:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMultiSchema(t *testing.T) {
+	zap := `{"ts":1,"level":"info","msg":"zap"}`
+	logrus := `{"time":"1970-01-01T00:00:02Z","level":"warning","msg":"logrus"}`
+	bunyan := `{"time":"1970-01-01T00:00:03Z","level":50,"v":0,"msg":"bunyan","hostname":"h"}`
+
+	t.Run("sticky", func(t *testing.T) {
+		s := &InputSchema{Strict: true}
+		if _, err := s.Parse([]byte(zap)); err != nil {
+			t.Fatalf("parse zap line: %v", err)
+		}
+		if _, err := s.Parse([]byte(logrus)); !comperror(err, Match(`no time key "ts"`)) {
+			t.Errorf("parse logrus line: unexpected error %v", err)
+		}
+	})
+
+	t.Run("multi schema", func(t *testing.T) {
+		s := &InputSchema{Strict: true, MultiSchema: true}
+		testData := []struct {
+			input string
+			want  ParsedLine
+		}{
+			{
+				input: zap,
+				want:  ParsedLine{Time: time.Unix(1, 0), Level: LevelInfo, Message: "zap"},
+			},
+			{
+				input: logrus,
+				want:  ParsedLine{Time: time.Unix(2, 0), Level: LevelWarn, Message: "logrus"},
+			},
+			{
+				// The logrus schema fits this line too, but it's recognized as bunyan.
+				input: bunyan,
+				want:  ParsedLine{Time: time.Unix(3, 0), Level: LevelError, Message: "bunyan", Fields: map[string]interface{}{"hostname": "h"}},
+			},
+			{
+				input: logrus,
+				want:  ParsedLine{Time: time.Unix(2, 0), Level: LevelWarn, Message: "logrus"},
+			},
+			{
+				input: zap,
+				want:  ParsedLine{Time: time.Unix(1, 0), Level: LevelInfo, Message: "zap"},
+			},
+			{
+				input: `{"timestamp":"1970-01-01T00:00:05Z","level":"info","message":"lager","data":{"a":1},"source":"s"}`,
+				want:  ParsedLine{Time: time.Unix(5, 0), Level: LevelInfo, Message: "lager", Fields: map[string]interface{}{"a": float64(1), "source": "s"}},
+			},
+			{
+				// Lager's schema is only guessed for lines with exactly 5 fields, but a
+				// remembered lager schema fits this line.
+				input: `{"timestamp":"1970-01-01T00:00:06Z","level":"info","message":"lager","data":{"a":2},"source":"s","extra":true}`,
+				want:  ParsedLine{Time: time.Unix(6, 0), Level: LevelInfo, Message: "lager", Fields: map[string]interface{}{"a": float64(2), "source": "s", "extra": true}},
+			},
+		}
+		for i, test := range testData {
+			got, err := s.Parse([]byte(test.input))
+			if err != nil {
+				t.Errorf("line %d: parse: %v", i, err)
+			}
+			test.want.Raw = []byte(test.input)
+			if diff := cmp.Diff(got, test.want, cmpopts.EquateEmpty(), cmpopts.EquateApproxTime(0)); diff != "" {
+				t.Errorf("line %d: parsed line:\n%s", i, diff)
+			}
+		}
+		if got, want := len(s.schemas), 4; got != want {
+			t.Errorf("remembered schemas:\n  got: %v\n want: %v", got, want)
+		}
+		if s.TimeKey != "" {
+			t.Errorf("schema was modified: time key %q", s.TimeKey)
+		}
+	})
+}
+
+func BenchmarkReadLog(b *testing.B) {
+	testData := []struct {
+		name   string
+		strict bool
+		line   func(i int) string
+	}{
+		{
+			name:   "zap",
+			strict: true,
+			line: func(i int) string {
+				return fmt.Sprintf(`{"ts":%d.%03d,"level":"info","msg":"request %d","method":"GET","route":"/api/items","status":200,"duration":0.0%02d,"user":{"id":%d,"name":"user%d"}}`, 1600000000+i/1000, i%1000, i, i%100, i%37, i%37)
+			},
+		},
+		{
+			name:   "logrus",
+			strict: true,
+			line: func(i int) string {
+				t := time.Unix(1600000000, 0).Add(time.Duration(i) * time.Millisecond).UTC().Format(time.RFC3339Nano)
+				return fmt.Sprintf(`{"time":%q,"level":"info","msg":"request %d","method":"GET","route":"/api/items","status":200}`, t, i)
+			},
+		},
+		{
+			name: "lax",
+			line: func(i int) string {
+				if i%2 == 0 {
+					return fmt.Sprintf("I1012 12:34:56.%06d    1 server.go:123] request %d", i, i)
+				}
+				return fmt.Sprintf(`{"message":"request %d","status":200}`, i)
+			},
+		},
+	}
+	for _, test := range testData {
+		b.Run(test.name, func(b *testing.B) {
+			input := new(bytes.Buffer)
+			for i := 0; i < 10000; i++ {
+				input.WriteString(test.line(i))
+				input.WriteString("\n")
+			}
+			b.SetBytes(int64(input.Len()))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ins := &InputSchema{Strict: test.strict}
+				outs := &OutputSchema{
+					Formatter: &DefaultOutputFormatter{
+						Aurora:               aurora.NewAurora(true),
+						ElideDuplicateFields: true,
+						AbsoluteTimeFormat:   time.RFC3339,
+						Zone:                 time.UTC,
+					},
+					EmitErrorFn: func(msg string) { b.Fatalf("unexpected error: %v", msg) },
+				}
+				if _, err := ReadLog(bytes.NewReader(input.Bytes()), io.Discard, ins, outs, new(FilterScheme)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
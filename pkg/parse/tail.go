@@ -0,0 +1,46 @@
+package parse
+
+// tailBuffer keeps the last n lines that were displayed, for OutputSchema.Tail.  A context
+// separator is kept with the line after it, so that it's dropped along with that line.
+type tailBuffer struct {
+	n       int
+	entries []tailEntry // entries is a ring buffer of up to n lines.
+	next    int         // next is the index in entries that the next line is stored at.
+	sep     *line       // sep is a separator waiting for the line after it.
+}
+
+type tailEntry struct {
+	l   line
+	sep *line
+}
+
+// add adds a line to the buffer, evicting the oldest line if the buffer is full.
+func (t *tailBuffer) add(l *line) {
+	if l.isSeparator {
+		sep := *l
+		t.sep = &sep
+		return
+	}
+	e := tailEntry{l: l.clone(), sep: t.sep}
+	t.sep = nil
+	if len(t.entries) < t.n {
+		t.entries = append(t.entries, e)
+		return
+	}
+	t.entries[t.next] = e
+	t.next = (t.next + 1) % t.n
+}
+
+// lines returns the buffered lines in input order, with the separators between them.
+func (t *tailBuffer) lines() []*line {
+	var result []*line
+	for i := range t.entries {
+		e := &t.entries[(t.next+i)%len(t.entries)]
+		// The first line has nothing before it to be separated from.
+		if e.sep != nil && i > 0 {
+			result = append(result, e.sep)
+		}
+		result = append(result, &e.l)
+	}
+	return result
+}